@@ -1,43 +1,46 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"net/http"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
-)
-
-type Config struct {
-	APIToken string `json:"api_token"`
-}
-
-type RunRequest struct {
-	Command string   `json:"command"`
-	Args    []string `json:"args"`
-	CWD     string   `json:"cwd"`
-}
 
-type RunResponse struct {
-	Stdout   string `json:"stdout"`
-	Stderr   string `json:"stderr"`
-	ExitCode int    `json:"exit_code"`
-}
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+	"github.com/mscrnt/DevProxy/pkg/client"
+)
 
 func main() {
 	var (
-		token   string
-		cwd     string
-		verbose bool
+		token     string
+		tokenFile string
+		cwd       string
+		addr      string
+		profile   string
+		retries   int
+		verbose   bool
+		noWSL     bool
+		tlsOpts   client.TLSFiles
 	)
 
-	flag.StringVar(&token, "token", "", "API token (reads from config if not provided)")
+	flag.StringVar(&token, "token", "", "API token; visible to other processes, prefer $"+client.TokenEnv+" or -token-file")
+	flag.StringVar(&tokenFile, "token-file", "", "Read the API token from this file, which only you may access (not checked on Windows)")
 	flag.StringVar(&cwd, "cwd", "", "Working directory (uses current directory if not provided)")
+	flag.StringVar(&addr, "addr", os.Getenv("DEVPROXY_ADDR"), "Server address: http(s)://host:port, unix:///path or npipe:////./pipe/name (default "+client.DefaultAddr+")")
+	flag.StringVar(&profile, "profile", os.Getenv(client.ProfileEnv), "Client config profile to use")
+	flag.StringVar(&tlsOpts.CAFile, "ca", "", "Trust this CA or self-signed certificate (PEM) for https://")
+	flag.StringVar(&tlsOpts.Pin, "pin", "", "Require the server certificate to have this SHA-256 fingerprint")
+	flag.StringVar(&tlsOpts.CertFile, "cert", "", "Client certificate (PEM) for mutual TLS")
+	flag.StringVar(&tlsOpts.KeyFile, "key", "", "Client private key (PEM) for mutual TLS")
+	flag.IntVar(&retries, "retries", 0, "Retry this many times when the server is unreachable or busy")
 	flag.BoolVar(&verbose, "v", false, "Verbose output")
+	flag.BoolVar(&noWSL, "no-wsl", os.Getenv("DEVPROXY_NO_WSL") != "", "Do not translate WSL paths in arguments and output")
 	flag.Parse()
 
 	if flag.NArg() < 1 {
@@ -48,72 +51,220 @@ func main() {
 	command := flag.Arg(0)
 	args := flag.Args()[1:]
 
-	if token == "" {
-		var err error
-		token, err = loadToken()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: Could not load token: %v\n", err)
-			fmt.Fprintf(os.Stderr, "Use -token flag or ensure config.json exists\n")
-			os.Exit(1)
-		}
+	// Flags and the environment take precedence over the profile.
+	prof, err := loadProfile(profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	retriesSet := false
+	flag.Visit(func(f *flag.Flag) { retriesSet = retriesSet || f.Name == "retries" })
+	if !retriesSet {
+		retries = prof.Retries
+	}
+	addr = firstNonEmpty(addr, prof.Addr, client.DefaultAddr)
+	cwd = firstNonEmpty(cwd, prof.CWD)
+	noWSL = noWSL || prof.NoWSL
+	tlsOpts.CAFile = firstNonEmpty(tlsOpts.CAFile, prof.CAFile)
+	tlsOpts.Pin = firstNonEmpty(tlsOpts.Pin, prof.Pin)
+	if tlsOpts.CertFile == "" && tlsOpts.KeyFile == "" {
+		tlsOpts.CertFile, tlsOpts.KeyFile = prof.CertFile, prof.KeyFile
+	}
+	clientCert := tlsOpts.CertFile != ""
+
+	// A client certificate can stand in for the token.
+	var tokenErr error
+	switch {
+	case token != "":
+		fmt.Fprintf(os.Stderr, "Warning: -token is visible to other processes; use $%s, -token-file or a profile instead\n", client.TokenEnv)
+	case tokenFile != "":
+		token, tokenErr = client.ReadTokenFile(tokenFile)
+	case os.Getenv(client.TokenEnv) != "":
+		token = os.Getenv(client.TokenEnv)
+	case !prof.Token.IsZero():
+		token, tokenErr = prof.Token.Token(context.Background(), addr)
+	default:
+		token, tokenErr = loadToken()
+	}
+
+	tlsConfig, err := tlsOpts.Config()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	c, err := client.New(addr, client.Options{Token: token, TLSConfig: tlsConfig, Retries: retries})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if command == "status" {
+		os.Exit(runStatus(c, token != "" || clientCert))
+	}
+
+	if tokenErr != nil && !clientCert {
+		fmt.Fprintf(os.Stderr, "Error: Could not load token: %v\n", tokenErr)
+		fmt.Fprintf(os.Stderr, "Set $%s, use -token-file, add a profile to %s, or ensure config.json exists\n", client.TokenEnv, clientConfigPath())
+		os.Exit(1)
 	}
 
 	if cwd == "" {
-		var err error
 		cwd, err = os.Getwd()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: Could not get current directory: %v\n", err)
 			os.Exit(1)
 		}
 	}
+	if !noWSL {
+		wsl = client.DetectWSL()
+	}
+	if wsl != nil {
+		cwd, _ = wsl.ToWindows(cwd)
+	}
+
+	if command == "push" || command == "pull" {
+		os.Exit(runTransfer(c, command, args, cwd))
+	}
+	if command == "sync" {
+		os.Exit(runSync(c, args, cwd))
+	}
+	if command == "watch" {
+		os.Exit(runWatch(c, args, cwd))
+	}
+	if command == "search" {
+		os.Exit(runSearch(c, args, cwd))
+	}
+
+	if wsl != nil {
+		for i, arg := range args {
+			args[i] = wsl.TranslateArg(arg)
+		}
+	}
 
 	if verbose {
 		fmt.Printf("Command: %s\n", command)
 		fmt.Printf("Args: %v\n", args)
 		fmt.Printf("CWD: %s\n", cwd)
-		fmt.Printf("Token: %s...\n", token[:8])
+		if profile != "" {
+			fmt.Printf("Profile: %s\n", profile)
+		}
+		if len(token) >= 8 {
+			fmt.Printf("Token: %s...\n", token[:8])
+		}
 		fmt.Println()
 	}
 
-	req := RunRequest{
+	req := api.RunRequest{
 		Command: command,
 		Args:    args,
 		CWD:     cwd,
 	}
 
-	resp, err := executeCommand(token, req)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	var stdout, stderr io.Writer = os.Stdout, os.Stderr
+	if wsl != nil {
+		stdout, stderr = &wslWriter{w: os.Stdout}, &wslWriter{w: os.Stderr}
 	}
 
-	if resp.Stdout != "" {
-		fmt.Print(resp.Stdout)
+	exitCode, err := c.RunStream(context.Background(), req, func(stream string, data []byte) {
+		if stream == "stderr" {
+			stderr.Write(data)
+		} else {
+			stdout.Write(data)
+		}
+	})
+	if wsl != nil {
+		stdout.(*wslWriter).Flush()
+		stderr.(*wslWriter).Flush()
 	}
-
-	if resp.Stderr != "" {
-		fmt.Fprint(os.Stderr, resp.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	os.Exit(resp.ExitCode)
+	os.Exit(exitCode)
 }
 
 func printUsage() {
 	fmt.Println("devctl - DevProxy CLI client")
 	fmt.Println()
 	fmt.Println("Usage: devctl [flags] <command> [args...]")
+	fmt.Println("       devctl [flags] status")
+	fmt.Println("       devctl [flags] push [-parents] <local-file> <remote-file>")
+	fmt.Println("       devctl [flags] pull <remote-file> <local-file>")
+	fmt.Println("       devctl [flags] sync [-delete] [-dry-run] [-exclude pattern]... <local-dir> <remote-dir>")
+	fmt.Println("       devctl [flags] watch [-once] [-include pattern]... [-exclude pattern]... [remote-dir]")
+	fmt.Println("       devctl [flags] search [-i] [-F] [-C n] [-include pattern]... <pattern> [remote-dir]")
 	fmt.Println()
 	fmt.Println("Flags:")
-	fmt.Println("  -token string   API token (reads from config if not provided)")
+	fmt.Println("  -token string   API token; prefer $" + client.TokenEnv + ", as other processes can see flags")
+	fmt.Println("  -token-file f   Read the API token from a file only you may access")
+	fmt.Println("                  (enforced outside Windows; on Windows keep it under your profile)")
 	fmt.Println("  -cwd string     Working directory (uses current directory if not provided)")
+	fmt.Println("  -profile name   Client config profile (default $DEVPROXY_PROFILE or the config's default_profile)")
+	fmt.Println("  -addr string    Server address (default $DEVPROXY_ADDR, the profile's, or " + client.DefaultAddr + ")")
+	fmt.Println("                  e.g. unix:///run/devproxy/devproxy.sock or npipe:////./pipe/devproxy")
+	fmt.Println("  -ca file        Trust this CA or self-signed certificate for https://")
+	fmt.Println("  -pin sha256     Accept only a server certificate with this fingerprint")
+	fmt.Println("  -cert file      Client certificate for mutual TLS (with -key)")
+	fmt.Println("  -key file       Client private key for mutual TLS")
+	fmt.Println("  -retries n      Retry when the server is unreachable or busy (default 0)")
+	fmt.Println("  -no-wsl         Do not translate WSL paths (default $DEVPROXY_NO_WSL)")
 	fmt.Println("  -v              Verbose output")
 	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  devctl go version")
+	fmt.Println("  devctl status")
+	fmt.Println("  devctl -profile buildbox go test ./...")
 	fmt.Println("  devctl -cwd C:\\Dev\\MyApp go build -o app.exe")
-	fmt.Println("  devctl -token YOUR_TOKEN powershell -Command Get-Date")
+	fmt.Println("  devctl -cwd C:\\Dev\\MyApp pull bin\\app.exe ./app.exe")
+	fmt.Println("  devctl sync -delete ~/src/myapp C:\\Dev\\MyApp")
+	fmt.Println("  devctl -cwd C:\\Dev\\MyApp watch -once -timeout 120 -include *.exe bin")
+	fmt.Println("  devctl -cwd C:\\Dev\\MyApp search -C 2 -include *.go \"func main\"")
+	fmt.Println("  devctl -token-file ~/.devproxy/token powershell -Command Get-Date")
+	fmt.Println("  cd /mnt/d/Projects/x && devctl go build -o /mnt/d/out/x.exe   (from WSL)")
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// firstNonEmpty returns the first of values that is not empty.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func clientConfigPath() string {
+	return envOr("DEVPROXY_CLIENT_CONFIG", client.DefaultConfigPath())
 }
 
+// loadProfile returns the named profile, or the default one, from the
+// client config. Without a config file it returns the zero Profile unless
+// a profile was asked for.
+func loadProfile(name string) (client.Profile, error) {
+	path := clientConfigPath()
+	cf, err := client.LoadConfigFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if name != "" {
+			return client.Profile{}, fmt.Errorf("profile %q: no client config at %s", name, path)
+		}
+		return client.Profile{}, nil
+	}
+	if err != nil {
+		return client.Profile{}, err
+	}
+	return cf.Profile(name)
+}
+
+// loadToken reads the token from a server config, for setups without a
+// client config.
 func loadToken() (string, error) {
 	configPaths := []string{
 		"config/config.json",
@@ -127,7 +278,7 @@ func loadToken() (string, error) {
 			continue
 		}
 
-		var config Config
+		var config api.Config
 		if err := json.Unmarshal(data, &config); err != nil {
 			continue
 		}
@@ -140,40 +291,51 @@ func loadToken() (string, error) {
 	return "", fmt.Errorf("no config file found with API token")
 }
 
-func executeCommand(token string, req RunRequest) (*RunResponse, error) {
-	data, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %v", err)
-	}
+// runStatus reports the server's liveness, readiness and, when a token or
+// client certificate is available, its version. It returns the process exit code.
+func runStatus(c *client.Client, authenticated bool) int {
+	ctx := context.Background()
+	fmt.Printf("DevProxy at %s\n", c.Addr())
 
-	httpReq, err := http.NewRequest("POST", "http://127.0.0.1:2223/run", bytes.NewReader(data))
+	health, err := c.Health(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		fmt.Printf("  healthz: DOWN (%v)\n", err)
+		return 1
 	}
+	fmt.Printf("  healthz: %s\n", health.Status)
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("X-Admin-Token", token)
-
-	client := &http.Client{}
-	httpResp, err := client.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %v", err)
-	}
-	defer httpResp.Body.Close()
-
-	body, err := io.ReadAll(httpResp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+	exitCode := 0
+	ready, err := c.Ready(ctx)
+	if ready == nil {
+		fmt.Printf("  readyz:  error (%v)\n", err)
+		exitCode = 1
+	} else {
+		fmt.Printf("  readyz:  %s\n", ready.Status)
+		for _, name := range []string{"config", "log", "queue"} {
+			if msg, ok := ready.Checks[name]; ok {
+				fmt.Printf("    %-7s %s\n", name+":", msg)
+			}
+		}
+		if err != nil {
+			exitCode = 1
+		}
 	}
 
-	if httpResp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("server returned %d: %s", httpResp.StatusCode, strings.TrimSpace(string(body)))
+	if !authenticated {
+		fmt.Println("  version: (no token available)")
+		return exitCode
 	}
-
-	var resp RunResponse
-	if err := json.Unmarshal(body, &resp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
+	ver, err := c.Version(ctx)
+	if err != nil {
+		fmt.Printf("  version: error (%v)\n", err)
+		return 1
 	}
+	fmt.Printf("  version: %s (%s, %s)\n", ver.Version, ver.Commit, ver.GoVersion)
+	fmt.Printf("  uptime:  %s (since %s)\n", ver.Uptime, ver.StartedAt)
+	fmt.Printf("  port:    %d\n", ver.Config.Port)
+	fmt.Printf("  queue:   %d concurrent, %d queued max\n", ver.Config.MaxConcurrent, ver.Config.MaxQueued)
+	fmt.Printf("  commands: %s\n", strings.Join(ver.Config.AllowedCmds, ", "))
+	fmt.Printf("  paths:    %s\n", strings.Join(ver.Config.AllowedPaths, ", "))
 
-	return &resp, nil
-}
\ No newline at end of file
+	return exitCode
+}
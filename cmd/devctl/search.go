@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+	"github.com/mscrnt/DevProxy/pkg/client"
+)
+
+// runSearch implements search: it prints the lines matching a pattern
+// under a remote directory, grep style, or with -files the matching file
+// names. It returns the process exit code: 1 if nothing was found.
+func runSearch(c *client.Client, args []string, cwd string) int {
+	fs := flag.NewFlagSet("devctl search", flag.ContinueOnError)
+	var include, exclude patterns
+	fs.Var(&include, "include", "Only search files matching this pattern (repeatable)")
+	fs.Var(&exclude, "exclude", "Leave out paths matching this pattern (repeatable)")
+	filesOnly := fs.Bool("files", false, "List the files matching -include instead of searching them; takes no pattern")
+	ignoreCase := fs.Bool("i", false, "Ignore case")
+	literal := fs.Bool("F", false, "Treat the pattern as a plain string, not a regular expression")
+	ctxLines := fs.Int("C", 0, "Show this many lines of context around each match")
+	noIgnore := fs.Bool("no-ignore", false, "Do not skip files ignored by .gitignore")
+	maxResults := fs.Int("max", 0, "Stop after this many results (default 1000)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	rest := fs.Args()
+	req := api.SearchRequest{
+		Include:    include,
+		Exclude:    exclude,
+		IgnoreCase: *ignoreCase,
+		Literal:    *literal,
+		Context:    *ctxLines,
+		NoIgnore:   *noIgnore,
+		MaxResults: *maxResults,
+	}
+	if !*filesOnly && len(rest) > 0 {
+		req.Pattern, rest = rest[0], rest[1:]
+	}
+	if (!*filesOnly && req.Pattern == "") || len(rest) > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: devctl search [-i] [-F] [-C n] [-include pattern]... [-exclude pattern]... [-no-ignore] [-max n] <pattern> [remote-dir]")
+		fmt.Fprintln(os.Stderr, "       devctl search -files [-include pattern]... [-exclude pattern]... [-no-ignore] [-max n] [remote-dir]")
+		return 2
+	}
+	req.Path = cwd
+	if len(rest) == 1 {
+		req.Path = remotePath(cwd, rest[0])
+	}
+
+	resp, err := c.Search(context.Background(), req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if *filesOnly {
+		for _, f := range resp.Files {
+			fmt.Println(f)
+		}
+	}
+	for i, m := range resp.Matches {
+		if *ctxLines > 0 && i > 0 {
+			fmt.Println("--")
+		}
+		for j, line := range m.Before {
+			fmt.Printf("%s-%d-%s\n", m.Path, m.Line-len(m.Before)+j, line)
+		}
+		fmt.Printf("%s:%d:%s\n", m.Path, m.Line, m.Text)
+		for j, line := range m.After {
+			fmt.Printf("%s-%d-%s\n", m.Path, m.Line+1+j, line)
+		}
+	}
+	if resp.Truncated {
+		fmt.Fprintf(os.Stderr, "(stopped after %d results; use -max for more)\n", max(len(resp.Files), len(resp.Matches)))
+	}
+	if len(resp.Files) == 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mscrnt/DevProxy/pkg/client"
+)
+
+// patterns is a flag that may be given several times.
+type patterns []string
+
+func (p *patterns) String() string { return strings.Join(*p, ",") }
+
+func (p *patterns) Set(v string) error {
+	*p = append(*p, v)
+	return nil
+}
+
+// runSync implements sync: it mirrors a local directory into a remote one
+// and prints each change. It returns the process exit code.
+func runSync(c *client.Client, args []string, cwd string) int {
+	fs := flag.NewFlagSet("devctl sync", flag.ContinueOnError)
+	var exclude patterns
+	fs.Var(&exclude, "exclude", "Leave out paths matching this pattern (repeatable)")
+	noDefaults := fs.Bool("no-default-excludes", false, "Do not exclude "+strings.Join(client.DefaultExcludes, " and ")+" by default")
+	del := fs.Bool("delete", false, "Delete remote files that do not exist locally")
+	dryRun := fs.Bool("dry-run", false, "Only print what would be done")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: devctl sync [-delete] [-dry-run] [-exclude pattern]... [-no-default-excludes] <local-dir> <remote-dir>")
+		return 2
+	}
+
+	opts := client.SyncOptions{
+		Exclude: exclude,
+		Delete:  *del,
+		DryRun:  *dryRun,
+		Report: func(op, path string) {
+			fmt.Printf("%-6s %s\n", op, path)
+		},
+	}
+	if !*noDefaults {
+		opts.Exclude = append(append([]string(nil), client.DefaultExcludes...), exclude...)
+	}
+
+	res, err := c.Sync(context.Background(), fs.Arg(0), remotePath(cwd, fs.Arg(1)), opts)
+	if res != nil {
+		note := ""
+		if *dryRun {
+			note = " (dry run)"
+		}
+		fmt.Fprintf(os.Stderr, "%d copied (%s), %d created, %d deleted, %d unchanged%s\n",
+			len(res.Copied), formatBytes(res.Bytes), len(res.Created), len(res.Deleted), res.Unchanged, note)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mscrnt/DevProxy/pkg/client"
+)
+
+// runTransfer implements push and pull. Relative remote paths are taken
+// relative to cwd, like a command's working directory. It returns the
+// process exit code.
+func runTransfer(c *client.Client, command string, args []string, cwd string) int {
+	fs := flag.NewFlagSet("devctl "+command, flag.ContinueOnError)
+	parents := fs.Bool("parents", false, "Create missing remote directories (push only)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		if command == "push" {
+			fmt.Fprintln(os.Stderr, "Usage: devctl push [-parents] <local-file> <remote-file>")
+		} else {
+			fmt.Fprintln(os.Stderr, "Usage: devctl pull <remote-file> <local-file>")
+		}
+		return 2
+	}
+
+	opts := client.TransferOptions{Parents: *parents}
+	if fi, err := os.Stderr.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		opts.Progress = func(done, total int64) {
+			fmt.Fprintf(os.Stderr, "\r%s / %s", formatBytes(done), formatBytes(total))
+		}
+	}
+
+	ctx := context.Background()
+	var err error
+	var local, remote string
+	if command == "push" {
+		local, remote = fs.Arg(0), remotePath(cwd, fs.Arg(1))
+		_, err = c.Push(ctx, local, remote, opts)
+	} else {
+		remote, local = remotePath(cwd, fs.Arg(0)), fs.Arg(1)
+		_, err = c.Pull(ctx, remote, local, opts)
+	}
+	if opts.Progress != nil {
+		fmt.Fprintln(os.Stderr)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// remotePath resolves p against cwd unless it is already absolute, in
+// either Windows or Unix form, using cwd's separator. In WSL an absolute
+// path is translated to Windows form.
+func remotePath(cwd, p string) string {
+	if wsl != nil {
+		if w, ok := wsl.ToWindows(p); ok {
+			return w
+		}
+	}
+	if strings.HasPrefix(p, "/") || strings.HasPrefix(p, `\`) || (len(p) >= 2 && p[1] == ':') {
+		return p
+	}
+	sep := "/"
+	if strings.Contains(cwd, `\`) {
+		sep = `\`
+		p = strings.ReplaceAll(p, "/", `\`)
+	}
+	return strings.TrimRight(cwd, `/\`) + sep + p
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
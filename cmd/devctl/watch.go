@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+	"github.com/mscrnt/DevProxy/pkg/client"
+)
+
+// runWatch implements watch: it prints changes under a remote directory as
+// they happen, or with -once waits for the first batch. It returns the
+// process exit code.
+func runWatch(c *client.Client, args []string, cwd string) int {
+	fs := flag.NewFlagSet("devctl watch", flag.ContinueOnError)
+	var include, exclude patterns
+	fs.Var(&include, "include", "Only report paths matching this pattern (repeatable)")
+	fs.Var(&exclude, "exclude", "Ignore paths matching this pattern (repeatable)")
+	debounce := fs.Int("debounce", 0, "Report changes once the tree has been quiet this many milliseconds (default 200)")
+	timeout := fs.Int("timeout", 0, "Stop after this many seconds (with -once, default 30)")
+	once := fs.Bool("once", false, "Exit after the first batch of changes; exit status 1 if none came before the timeout")
+	asJSON := fs.Bool("json", false, "Print each event as a JSON line")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: devctl watch [-once] [-json] [-include pattern]... [-exclude pattern]... [-debounce ms] [-timeout s] [remote-dir]")
+		return 2
+	}
+	dir := cwd
+	if fs.NArg() == 1 {
+		dir = remotePath(cwd, fs.Arg(0))
+	}
+
+	show := func(ev api.WatchEvent) {
+		if *asJSON {
+			data, _ := json.Marshal(ev)
+			fmt.Println(string(data))
+			return
+		}
+		path := ev.Path
+		if ev.IsDir {
+			path += "/"
+		}
+		fmt.Printf("%-6s %s\n", ev.Type, path)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	req := api.WatchRequest{
+		Path:           dir,
+		Include:        include,
+		Exclude:        exclude,
+		DebounceMS:     *debounce,
+		TimeoutSeconds: *timeout,
+	}
+
+	if *once {
+		resp, err := c.Watch(ctx, req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		for _, ev := range resp.Events {
+			show(ev)
+		}
+		if len(resp.Events) == 0 {
+			return 1
+		}
+		return 0
+	}
+
+	err := c.WatchStream(ctx, req, show)
+	if err != nil && !errors.Is(err, context.Canceled) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
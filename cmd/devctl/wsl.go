@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/mscrnt/DevProxy/pkg/client"
+)
+
+// wsl translates paths when devctl runs in WSL, and is nil otherwise or
+// with -no-wsl.
+var wsl *client.WSL
+
+// maxPendingOutput is how much of an unfinished line wslWriter holds back
+// before writing it untranslated.
+const maxPendingOutput = 4096
+
+// wslWriter rewrites the Windows paths in a command's output to WSL form.
+// It translates whole lines, so that a path split across two chunks of
+// output is still found.
+type wslWriter struct {
+	w       io.Writer
+	pending []byte
+}
+
+func (lw *wslWriter) Write(p []byte) (int, error) {
+	lw.pending = append(lw.pending, p...)
+	i := bytes.LastIndexByte(lw.pending, '\n')
+	if i < 0 && len(lw.pending) < maxPendingOutput {
+		return len(p), nil
+	}
+	n := len(lw.pending)
+	if i >= 0 {
+		n = i + 1
+	}
+	_, err := io.WriteString(lw.w, wsl.TranslateOutput(string(lw.pending[:n])))
+	lw.pending = append(lw.pending[:0], lw.pending[n:]...)
+	return len(p), err
+}
+
+// Flush writes the last, unfinished line.
+func (lw *wslWriter) Flush() {
+	if len(lw.pending) > 0 {
+		io.WriteString(lw.w, wsl.TranslateOutput(string(lw.pending)))
+		lw.pending = lw.pending[:0]
+	}
+}
@@ -13,21 +13,15 @@ import (
 	"strings"
 	"syscall"
 
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+
 	"github.com/getlantern/systray"
 	"github.com/lxn/walk"
 	. "github.com/lxn/walk/declarative"
 )
 
-type Config struct {
-	APIToken     string   `json:"api_token"`
-	AllowedCmds  []string `json:"allowed_commands"`
-	AllowedPaths []string `json:"allowed_paths"`
-	LogFile      string   `json:"log_file"`
-	Port         int      `json:"port"`
-}
-
 var (
-	config       *Config
+	config       *api.Config
 	configPath   string
 	mainWindow   *walk.MainWindow
 	portEdit     *walk.NumberEdit
@@ -283,24 +277,19 @@ func loadConfig() {
 
 	data, err := os.ReadFile(configPath)
 	if err != nil {
-		config = &Config{
-			Port:         2223,
-			AllowedPaths: []string{"C:\\Dev"},
-			AllowedCmds:  []string{"go", "msbuild", "dotnet"},
-			LogFile:      "logs\\log.txt",
-		}
+		cfg := api.DefaultConfig()
+		config = &cfg
 		return
 	}
 
-	config = &Config{}
+	// Keep every field, including ones this panel does not edit, so that
+	// saving never drops settings such as bind or tls.
+	config = &api.Config{}
 	json.Unmarshal(data, config)
-	
-	if config.Port == 0 {
-		config.Port = 2223
-	}
 }
 
 func saveConfig() {
+	saved := *config
 	config.Port = int(portEdit.Value())
 	
 	paths := strings.Split(pathsEdit.Text(), "\r\n")
@@ -312,11 +301,29 @@ func saveConfig() {
 		}
 	}
 
+	effective := *config
+	api.ApplyDefaults(&effective)
+	if err := api.ValidateConfig(effective); err != nil {
+		walk.MsgBox(mainWindow, "Invalid configuration", err.Error(), walk.MsgBoxIconError)
+		return
+	}
+
 	data, _ := json.MarshalIndent(config, "", "  ")
 	os.MkdirAll(filepath.Dir(configPath), 0755)
 	os.WriteFile(configPath, data, 0600)
 
-	walk.MsgBox(mainWindow, "Success", "Configuration saved. Please restart the service for changes to take effect.", walk.MsgBoxIconInformation)
+	walk.MsgBox(mainWindow, "Success", saveMessage(saved, *config), walk.MsgBoxIconInformation)
+}
+
+// saveMessage says which of the changes from saved to next the service
+// picks up by itself and which wait for a restart.
+func saveMessage(saved, next api.Config) string {
+	msg := "Configuration saved. DevProxy reloads it automatically, except for " +
+		strings.Join(api.RestartOnlyFields, ", ") + ", which need a service restart."
+	if changed := api.RestartChanges(saved, next); len(changed) > 0 {
+		msg += "\n\nRestart the service to apply the new " + strings.Join(changed, ", ") + "."
+	}
+	return msg
 }
 
 func regenerateToken() {
@@ -379,9 +386,11 @@ func updateStatus() {
 }
 
 func getPort() int {
-	if config != nil && config.Port > 0 {
-		return config.Port
+	cfg := api.DefaultConfig()
+	if config != nil {
+		cfg = *config
 	}
-	return 2223
+	api.ApplyDefaults(&cfg)
+	return cfg.Port
 }
 
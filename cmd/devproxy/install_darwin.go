@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+const (
+	launchdLabel = "com.github.mscrnt.devproxy"
+	launchdPlist = "/Library/LaunchDaemons/" + launchdLabel + ".plist"
+)
+
+var launchdTemplate = template.Must(template.New("plist").Funcs(template.FuncMap{
+	"xml":         xmlEscape,
+	"stopTimeout": stopTimeout,
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<!-- Generated by "devproxy service install". Re-run it to regenerate. -->
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{.Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{xml .Exec}}</string>
+		<string>-config</string>
+		<string>{{xml .ConfigPath}}</string>
+	</array>
+{{- if .User}}
+	<key>UserName</key>
+	<string>{{xml .User}}</string>
+{{- end}}
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>ExitTimeOut</key>
+	<integer>{{stopTimeout .Config.ShutdownGrace}}</integer>
+	<key>StandardOutPath</key>
+	<string>/var/log/devproxy.log</string>
+	<key>StandardErrorPath</key>
+	<string>/var/log/devproxy.log</string>
+</dict>
+</plist>
+`))
+
+func installService(opts serviceOptions) error {
+	if opts.Socket {
+		return fmt.Errorf("socket activation is only supported with systemd")
+	}
+
+	data := struct {
+		serviceOptions
+		Label string
+	}{opts, launchdLabel}
+
+	var plist bytes.Buffer
+	if err := launchdTemplate.Execute(&plist, data); err != nil {
+		return err
+	}
+
+	// Replace any loaded copy so the new plist takes effect.
+	exec.Command("launchctl", "bootout", "system/"+launchdLabel).Run()
+
+	if err := os.WriteFile(launchdPlist, plist.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", launchdPlist)
+
+	return launchctl("bootstrap", "system", launchdPlist)
+}
+
+func uninstallService() error {
+	exec.Command("launchctl", "bootout", "system/"+launchdLabel).Run()
+
+	if err := os.Remove(launchdPlist); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fmt.Printf("Removed %s\n", launchdPlist)
+	return nil
+}
+
+func serviceStatus() error {
+	if _, err := os.Stat(launchdPlist); os.IsNotExist(err) {
+		fmt.Println("Not installed")
+		return nil
+	}
+	out, err := exec.Command("launchctl", "print", "system/"+launchdLabel).Output()
+	if err != nil {
+		fmt.Printf("Installed at %s but not loaded\n", launchdPlist)
+		return nil
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "state =") || strings.HasPrefix(line, "pid =") || strings.HasPrefix(line, "last exit code =") {
+			fmt.Println(line)
+		}
+	}
+	return nil
+}
+
+func launchctl(args ...string) error {
+	cmd := exec.Command("launchctl", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("launchctl %s: %v", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(s)
+}
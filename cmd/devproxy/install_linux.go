@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+	"github.com/mscrnt/DevProxy/pkg/server"
+)
+
+const systemdUnitDir = "/etc/systemd/system"
+
+var systemdServiceTemplate = template.Must(template.New("service").Funcs(template.FuncMap{
+	"quote":       systemdQuote,
+	"stopTimeout": stopTimeout,
+}).Parse(`# Generated by "devproxy service install". Re-run it to regenerate.
+[Unit]
+Description=DevProxy local admin API
+Documentation=https://github.com/mscrnt/DevProxy
+After=network.target
+{{- if .Socket}}
+Requires={{.Name}}.socket
+After={{.Name}}.socket
+{{- end}}
+
+[Service]
+Type=notify
+ExecStart={{quote .Exec}} -config {{quote .ConfigPath}}
+Restart=on-failure
+RestartSec=2
+TimeoutStopSec={{stopTimeout .Config.ShutdownGrace}}
+KillMode=mixed
+{{- if .User}}
+User={{.User}}
+{{- end}}
+{{- if .RuntimeDir}}
+RuntimeDirectory={{.RuntimeDir}}
+{{- end}}
+
+# Sandboxing: the filesystem is read-only except for the allowed paths and
+# the log directory.
+NoNewPrivileges=yes
+ProtectSystem=strict
+{{- range .Writable}}
+ReadWritePaths={{quote (printf "-%s" .)}}
+{{- end}}
+PrivateTmp=yes
+PrivateDevices=yes
+ProtectKernelTunables=yes
+ProtectKernelModules=yes
+ProtectKernelLogs=yes
+ProtectControlGroups=yes
+ProtectClock=yes
+ProtectHostname=yes
+RestrictSUIDSGID=yes
+RestrictRealtime=yes
+RestrictNamespaces=yes
+LockPersonality=yes
+RestrictAddressFamilies=AF_UNIX AF_INET AF_INET6
+UMask=0027
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+var systemdSocketTemplate = template.Must(template.New("socket").Parse(`# Generated by "devproxy service install -socket".
+[Unit]
+Description=DevProxy local admin API socket
+
+[Socket]
+ListenStream={{.Listen}}
+{{- if .Unix}}
+SocketMode={{.Mode}}
+{{- if .Config.Listen.Owner}}
+SocketUser={{.Config.Listen.Owner}}
+{{- end}}
+{{- if .Config.Listen.Group}}
+SocketGroup={{.Config.Listen.Group}}
+{{- end}}
+{{- else}}
+NoDelay=true
+{{- end}}
+
+[Install]
+WantedBy=sockets.target
+`))
+
+func installService(opts serviceOptions) error {
+	unit, sock, err := renderSystemdUnits(opts)
+	if err != nil {
+		return err
+	}
+	servicePath := filepath.Join(systemdUnitDir, serviceName+".service")
+	if err := os.WriteFile(servicePath, unit, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s\n", servicePath)
+
+	enable := serviceName + ".service"
+	socketPath := filepath.Join(systemdUnitDir, serviceName+".socket")
+	if opts.Socket {
+		if err := os.WriteFile(socketPath, sock, 0644); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s\n", socketPath)
+		enable = serviceName + ".socket"
+	} else if err := os.Remove(socketPath); err == nil {
+		fmt.Printf("Removed stale %s\n", socketPath)
+	}
+
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return systemctl("enable", "--now", enable)
+}
+
+// renderSystemdUnits returns the service unit and, with opts.Socket, the
+// socket unit for opts.
+func renderSystemdUnits(opts serviceOptions) (service, socket []byte, err error) {
+	data := struct {
+		serviceOptions
+		Name       string
+		Writable   []string
+		Listen     string
+		Unix       bool
+		Mode       string
+		RuntimeDir string
+	}{
+		serviceOptions: opts,
+		Name:           serviceName,
+		Writable:       writablePaths(opts),
+		Listen:         server.ListenAddr(opts.Config),
+		Mode:           fmt.Sprintf("%04o", api.DefaultSocketMode),
+	}
+	if lc := opts.Config.Listen; lc.Network == "unix" {
+		data.Unix = true
+		data.Listen = lc.Path
+		if lc.Mode != "" {
+			data.Mode = lc.Mode
+		}
+		// Sockets under /run/devproxy live in a directory systemd creates
+		// and removes with the service.
+		if filepath.Dir(lc.Path) == "/run/"+serviceName {
+			data.RuntimeDir = serviceName
+		}
+	}
+
+	var unit bytes.Buffer
+	if err := systemdServiceTemplate.Execute(&unit, data); err != nil {
+		return nil, nil, err
+	}
+	if !opts.Socket {
+		return unit.Bytes(), nil, nil
+	}
+	var sock bytes.Buffer
+	if err := systemdSocketTemplate.Execute(&sock, data); err != nil {
+		return nil, nil, err
+	}
+	return unit.Bytes(), sock.Bytes(), nil
+}
+
+func uninstallService() error {
+	systemctl("disable", "--now", serviceName+".socket")
+	systemctl("disable", "--now", serviceName+".service")
+
+	for _, ext := range []string{".service", ".socket"} {
+		path := filepath.Join(systemdUnitDir, serviceName+ext)
+		if err := os.Remove(path); err == nil {
+			fmt.Printf("Removed %s\n", path)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return systemctl("daemon-reload")
+}
+
+func serviceStatus() error {
+	for _, unit := range []string{serviceName + ".service", serviceName + ".socket"} {
+		enabled, _ := exec.Command("systemctl", "is-enabled", unit).Output()
+		active, _ := exec.Command("systemctl", "is-active", unit).Output()
+		fmt.Printf("%-20s enabled: %-10s active: %s\n", unit,
+			strings.TrimSpace(string(enabled)), strings.TrimSpace(string(active)))
+	}
+	return nil
+}
+
+func systemctl(args ...string) error {
+	cmd := exec.Command("systemctl", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %s: %v", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// systemdQuote quotes a value for a unit file if it contains whitespace or
+// quotes.
+func systemdQuote(s string) string {
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+func TestWritablePaths(t *testing.T) {
+	opts := serviceOptions{
+		Exec: "/opt/devproxy/devproxy",
+		Config: api.Config{
+			AllowedPaths: []string{"/home/*/Projects", "/srv/dev/", "/srv/dev", "/data/x*/y"},
+			LogFile:      "logs/audit.log",
+			Listen:       api.ListenConfig{Network: "unix", Path: "/run/devproxy/devproxy.sock"},
+		},
+	}
+	want := []string{"/home", "/srv/dev", "/data", "/opt/devproxy/logs", "/run/devproxy"}
+	if got := writablePaths(opts); !slices.Equal(got, want) {
+		t.Errorf("writablePaths = %v, want %v", got, want)
+	}
+}
+
+func TestSystemdUnits(t *testing.T) {
+	opts := serviceOptions{
+		Exec:       "/opt/dev proxy/devproxy",
+		ConfigPath: "/etc/devproxy/config.json",
+		User:       "devproxy",
+		Config: api.Config{
+			AllowedPaths:  []string{"/home/*/Projects", "/srv/dev"},
+			LogFile:       "/var/log/devproxy/audit.log",
+			ShutdownGrace: 20,
+		},
+	}
+	service, socket, err := renderSystemdUnits(opts)
+	if err != nil {
+		t.Fatalf("renderSystemdUnits: %v", err)
+	}
+	if socket != nil {
+		t.Errorf("socket unit rendered without -socket:\n%s", socket)
+	}
+	unit := string(service)
+	for _, line := range []string{
+		"Type=notify",
+		`ExecStart="/opt/dev proxy/devproxy" -config /etc/devproxy/config.json`,
+		"User=devproxy",
+		"TimeoutStopSec=30",
+		"ProtectSystem=strict",
+		"ReadWritePaths=-/home",
+		"ReadWritePaths=-/srv/dev",
+		"ReadWritePaths=-/var/log/devproxy",
+	} {
+		if !hasLine(unit, line) {
+			t.Errorf("service unit has no line %q:\n%s", line, unit)
+		}
+	}
+	if strings.Contains(unit, "Requires=devproxy.socket") || strings.Contains(unit, "RuntimeDirectory=") {
+		t.Errorf("service unit refers to a socket unit it does not need:\n%s", unit)
+	}
+
+	opts.Socket = true
+	opts.Config.Listen = api.ListenConfig{Network: "unix", Path: "/run/devproxy/devproxy.sock", Group: "dev"}
+	service, socket, err = renderSystemdUnits(opts)
+	if err != nil {
+		t.Fatalf("renderSystemdUnits: %v", err)
+	}
+	for _, line := range []string{"Requires=devproxy.socket", "RuntimeDirectory=devproxy", "ReadWritePaths=-/run/devproxy"} {
+		if !hasLine(string(service), line) {
+			t.Errorf("socket-activated service unit has no line %q:\n%s", line, service)
+		}
+	}
+	for _, line := range []string{"ListenStream=/run/devproxy/devproxy.sock", "SocketGroup=dev"} {
+		if !hasLine(string(socket), line) {
+			t.Errorf("socket unit has no line %q:\n%s", line, socket)
+		}
+	}
+}
+
+func hasLine(text, line string) bool {
+	return slices.Contains(strings.Split(text, "\n"), line)
+}
@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import "fmt"
+
+var errServiceUnsupported = fmt.Errorf("service management is not supported on this platform; run devproxy under your init system directly")
+
+func installService(opts serviceOptions) error {
+	return errServiceUnsupported
+}
+
+func uninstallService() error {
+	return errServiceUnsupported
+}
+
+func serviceStatus() error {
+	return errServiceUnsupported
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const windowsServiceName = "DevProxy"
+
+func installService(opts serviceOptions) error {
+	if opts.Socket {
+		return fmt.Errorf("socket activation is only supported with systemd")
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("cannot connect to the service manager (run as Administrator): %v", err)
+	}
+	defer m.Disconnect()
+
+	if s, err := m.OpenService(windowsServiceName); err == nil {
+		s.Close()
+		return fmt.Errorf("service %s already exists; run \"devproxy service uninstall\" first", windowsServiceName)
+	}
+
+	cfg := mgr.Config{
+		DisplayName: "DevProxy - Local Admin API",
+		Description: "Local-only admin API for development commands.",
+		StartType:   mgr.StartAutomatic,
+	}
+	if opts.User != "" {
+		cfg.ServiceStartName = opts.User
+	}
+
+	s, err := m.CreateService(windowsServiceName, opts.Exec, cfg, "-config", opts.ConfigPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	fmt.Printf("Installed service %s\n", windowsServiceName)
+
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("installed, but failed to start: %v", err)
+	}
+	fmt.Println("Service started")
+	return nil
+}
+
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("cannot connect to the service manager (run as Administrator): %v", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(windowsServiceName)
+	if err != nil {
+		return fmt.Errorf("service %s is not installed", windowsServiceName)
+	}
+	defer s.Close()
+
+	if status, err := s.Control(svc.Stop); err == nil {
+		deadline := time.Now().Add(30 * time.Second)
+		for status.State != svc.Stopped && time.Now().Before(deadline) {
+			time.Sleep(300 * time.Millisecond)
+			if status, err = s.Query(); err != nil {
+				break
+			}
+		}
+	}
+
+	if err := s.Delete(); err != nil {
+		return err
+	}
+	fmt.Printf("Uninstalled service %s\n", windowsServiceName)
+	return nil
+}
+
+func serviceStatus() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(windowsServiceName)
+	if err != nil {
+		fmt.Println("Not installed")
+		return nil
+	}
+	defer s.Close()
+
+	status, err := s.Query()
+	if err != nil {
+		return err
+	}
+	states := map[svc.State]string{
+		svc.Stopped:         "stopped",
+		svc.StartPending:    "start pending",
+		svc.StopPending:     "stop pending",
+		svc.Running:         "running",
+		svc.ContinuePending: "continue pending",
+		svc.PausePending:    "pause pending",
+		svc.Paused:          "paused",
+	}
+	fmt.Printf("%s: %s (pid %d)\n", windowsServiceName, states[status.State], status.ProcessId)
+	return nil
+}
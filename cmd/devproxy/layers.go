@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// Configuration is assembled in layers, each overriding the previous one:
+//
+//	default < config file < DEVPROXY_* environment < command-line flags
+//
+// Every Config field can be overridden from the environment; the variable
+// name is DEVPROXY_ followed by the field's JSON path in upper case with
+// dots replaced by underscores, e.g. DEVPROXY_TRACING_OTLP_ENDPOINT.
+const envPrefix = "DEVPROXY_"
+
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+// Fields whose values effective-config never prints.
+var sensitiveFields = map[string]bool{
+	"api_token":       true,
+	"tracing.headers": true,
+}
+
+// configLayers holds the command-line inputs to config loading. It is kept
+// for the life of the process so reloads re-apply the same overrides.
+type configLayers struct {
+	Path    string
+	Port    int
+	Bind    string
+	LogFile string
+	set     map[string]bool
+}
+
+var configOpts configLayers
+
+// registerConfigFlags defines the config-related flags on fs.
+func registerConfigFlags(fs *flag.FlagSet, opts *configLayers) {
+	fs.StringVar(&opts.Path, "config", "", "Path to config.json (default: $DEVPROXY_CONFIG or config/config.json next to the executable)")
+	fs.IntVar(&opts.Port, "port", 0, "Override the listen port")
+	fs.StringVar(&opts.Bind, "bind", "", "Override the listen address")
+	fs.StringVar(&opts.LogFile, "log", "", "Override the audit log file path")
+}
+
+// recordSetFlags notes which flags were given explicitly so that, for
+// example, -port 0 is distinguishable from no -port at all.
+func recordSetFlags(fs *flag.FlagSet, opts *configLayers) {
+	opts.set = map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { opts.set[f.Name] = true })
+}
+
+// resolveConfigPath picks the config file location: -config, then
+// $DEVPROXY_CONFIG, then config/config.json beside the executable.
+func resolveConfigPath(opts configLayers) (string, error) {
+	if opts.Path != "" {
+		return opts.Path, nil
+	}
+	if p := os.Getenv(envPrefix + "CONFIG"); p != "" {
+		return p, nil
+	}
+	return defaultConfigPath()
+}
+
+func defaultConfigPath() (string, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(exePath), "config", "config.json"), nil
+}
+
+// buildConfig reads the config file, overlays environment variables and
+// flags, applies defaults and validates the result. The returned map
+// records which layer supplied each field.
+func buildConfig(opts configLayers) (api.Config, map[string]string, error) {
+	path, err := resolveConfigPath(opts)
+	if err != nil {
+		return api.Config{}, nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return api.Config{}, nil, err
+	}
+
+	cfg, raw, problems := api.DecodeConfig(data)
+
+	sources := map[string]string{}
+	for _, f := range configFields() {
+		sources[f] = sourceDefault
+	}
+	markFileSources(raw, reflect.TypeOf(api.Config{}), "", sources)
+
+	applyEnvOverrides(reflect.ValueOf(&cfg).Elem(), "", sources, &problems)
+
+	if opts.set["port"] {
+		cfg.Port = opts.Port
+		sources["port"] = sourceFlag + " (-port)"
+	}
+	if opts.set["bind"] {
+		cfg.Bind = opts.Bind
+		sources["bind"] = sourceFlag + " (-bind)"
+	}
+	if opts.set["log"] {
+		cfg.LogFile = opts.LogFile
+		sources["log_file"] = sourceFlag + " (-log)"
+	}
+
+	api.ApplyDefaults(&cfg)
+	if err := api.ValidateConfig(cfg); err != nil {
+		problems = append(problems, err.(api.ConfigErrors)...)
+	}
+	if len(problems) > 0 {
+		return api.Config{}, sources, problems
+	}
+	return cfg, sources, nil
+}
+
+// configFields lists every leaf field of Config by JSON path.
+func configFields() []string {
+	var out []string
+	var walk func(t reflect.Type, prefix string)
+	walk = func(t reflect.Type, prefix string) {
+		for i := 0; i < t.NumField(); i++ {
+			name := prefix + jsonName(t.Field(i))
+			if t.Field(i).Type.Kind() == reflect.Struct {
+				walk(t.Field(i).Type, name+".")
+				continue
+			}
+			out = append(out, name)
+		}
+	}
+	walk(reflect.TypeOf(api.Config{}), "")
+	return out
+}
+
+func jsonName(f reflect.StructField) string {
+	return strings.Split(f.Tag.Get("json"), ",")[0]
+}
+
+func envName(path string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+func markFileSources(raw interface{}, t reflect.Type, prefix string, sources map[string]string) {
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		v, ok := obj[jsonName(f)]
+		if !ok {
+			continue
+		}
+		name := prefix + jsonName(f)
+		if f.Type.Kind() == reflect.Struct {
+			markFileSources(v, f.Type, name+".", sources)
+			continue
+		}
+		sources[name] = sourceFile
+	}
+}
+
+// applyEnvOverrides sets fields of v from DEVPROXY_* variables. Lists accept
+// a JSON array or a comma-separated string; maps accept a JSON object or
+// comma-separated key=value pairs.
+func applyEnvOverrides(v reflect.Value, prefix string, sources map[string]string, problems *api.ConfigErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := prefix + jsonName(t.Field(i))
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Struct {
+			applyEnvOverrides(fv, name+".", sources, problems)
+			continue
+		}
+
+		env := envName(name)
+		s, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		if err := setFromString(fv, s); err != nil {
+			problems.Add("$."+name, "invalid value in %s: %v", env, err)
+			continue
+		}
+		sources[name] = sourceEnv + " (" + env + ")"
+	}
+}
+
+func setFromString(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", s)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", s)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var list []string
+		if strings.HasPrefix(strings.TrimSpace(s), "[") {
+			if err := json.Unmarshal([]byte(s), &list); err != nil {
+				return fmt.Errorf("expected a JSON array of strings: %v", err)
+			}
+		} else {
+			for _, item := range strings.Split(s, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	case reflect.Map:
+		m := map[string]string{}
+		if strings.HasPrefix(strings.TrimSpace(s), "{") {
+			if err := json.Unmarshal([]byte(s), &m); err != nil {
+				return fmt.Errorf("expected a JSON object of strings: %v", err)
+			}
+		} else {
+			for _, pair := range strings.Split(s, ",") {
+				k, val, ok := strings.Cut(pair, "=")
+				if !ok {
+					return fmt.Errorf("expected key=value pairs, got %q", pair)
+				}
+				m[strings.TrimSpace(k)] = strings.TrimSpace(val)
+			}
+		}
+		v.Set(reflect.ValueOf(m))
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// runEffectiveConfig implements "devproxy effective-config": it prints each
+// field's final value and the layer it came from.
+func runEffectiveConfig(opts configLayers) int {
+	path, err := resolveConfigPath(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	cfg, sources, err := buildConfig(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("# config file: %s\n", path)
+	values := map[string]interface{}{}
+	collectValues(reflect.ValueOf(cfg), "", values)
+
+	names := configFields()
+	sort.Strings(names)
+	for _, name := range names {
+		val := "<redacted>"
+		if !sensitiveFields[name] {
+			b, _ := json.Marshal(values[name])
+			val = string(b)
+		}
+		fmt.Printf("%-24s %-40s %s\n", name, val, sources[name])
+	}
+	return 0
+}
+
+func collectValues(v reflect.Value, prefix string, out map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := prefix + jsonName(t.Field(i))
+		if v.Field(i).Kind() == reflect.Struct {
+			collectValues(v.Field(i), name+".", out)
+			continue
+		}
+		out[name] = v.Field(i).Interface()
+	}
+}
+
+// runValidateConfig implements "devproxy validate-config [path]". It
+// validates the effective config (file plus environment and flag overrides),
+// prints every problem with its JSON path and returns the process exit code.
+func runValidateConfig(opts configLayers, args []string) int {
+	if len(args) > 0 {
+		opts.Path = args[0]
+	}
+	path, err := resolveConfigPath(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	if _, err := os.Stat(path); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+
+	if _, _, err := buildConfig(opts); err != nil {
+		fmt.Printf("%s is invalid:\n", path)
+		if problems, ok := err.(api.ConfigErrors); ok {
+			for _, p := range problems {
+				fmt.Printf("  %s: %s\n", p.Path, p.Message)
+			}
+		} else {
+			fmt.Printf("  %v\n", err)
+		}
+		return 1
+	}
+
+	fmt.Printf("%s is valid\n", path)
+	return 0
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// clearConfigEnv unsets every DEVPROXY_* variable for the test.
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, envPrefix) {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+}
+
+// writeConfig writes a config file holding a token, a command, an allowed
+// path, a log file and the given extra fields, and returns its path.
+func writeConfig(t *testing.T, extra string) string {
+	t.Helper()
+	dir := t.TempDir()
+	data := `{"api_token":"0123456789abcdef0123456789abcdef","allowed_commands":["go"],"allowed_paths":[` +
+		jsonString(dir) + `],"log_file":` + jsonString(filepath.Join(dir, "audit.log")) + extra + `}`
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// parseFlags parses args as devproxy's config flags.
+func parseFlags(t *testing.T, path string, args ...string) configLayers {
+	t.Helper()
+	fs := flag.NewFlagSet("devproxy", flag.ContinueOnError)
+	var opts configLayers
+	registerConfigFlags(fs, &opts)
+	if err := fs.Parse(append([]string{"-config", path}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	recordSetFlags(fs, &opts)
+	return opts
+}
+
+func TestBuildConfigLayers(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		env    map[string]string
+		flags  []string
+		port   int
+		source string
+	}{
+		{"default", "", nil, nil, 2223, "default"},
+		{"file over default", `,"port":3000`, nil, nil, 3000, "file"},
+		{"env over file", `,"port":3000`, map[string]string{"DEVPROXY_PORT": "4000"}, nil, 4000, "env (DEVPROXY_PORT)"},
+		{"flag over env", `,"port":3000`, map[string]string{"DEVPROXY_PORT": "4000"}, []string{"-port", "5000"}, 5000, "flag (-port)"},
+		{"flag over default", "", nil, []string{"-port", "5000"}, 5000, "flag (-port)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearConfigEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, sources, err := buildConfig(parseFlags(t, writeConfig(t, tt.file), tt.flags...))
+			if err != nil {
+				t.Fatalf("buildConfig: %v", err)
+			}
+			if cfg.Port != tt.port {
+				t.Errorf("port = %d, want %d", cfg.Port, tt.port)
+			}
+			if sources["port"] != tt.source {
+				t.Errorf("port source = %q, want %q", sources["port"], tt.source)
+			}
+		})
+	}
+}
+
+func TestBuildConfigEnvTypes(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("DEVPROXY_ALLOWED_COMMANDS", "go, git")
+	t.Setenv("DEVPROXY_TRACING_ENABLED", "true")
+	t.Setenv("DEVPROXY_TRACING_SAMPLE_RATIO", "0.25")
+	t.Setenv("DEVPROXY_TRACING_HEADERS", "a=1, b=2")
+	t.Setenv("DEVPROXY_TLS_HOSTS", `["devbox","10.0.0.2"]`)
+	path := writeConfig(t, `,"tracing":{"service_name":"svc"}`)
+
+	cfg, sources, err := buildConfig(parseFlags(t, path, "-log", "from-flag.log"))
+	if err != nil {
+		t.Fatalf("buildConfig: %v", err)
+	}
+	if got := strings.Join(cfg.AllowedCmds, ","); got != "go,git" {
+		t.Errorf("allowed_commands = %q", got)
+	}
+	if !cfg.Tracing.Enabled || cfg.Tracing.SampleRatio != 0.25 || cfg.Tracing.ServiceName != "svc" {
+		t.Errorf("tracing = %+v", cfg.Tracing)
+	}
+	if cfg.Tracing.Headers["a"] != "1" || cfg.Tracing.Headers["b"] != "2" {
+		t.Errorf("tracing.headers = %v", cfg.Tracing.Headers)
+	}
+	if strings.Join(cfg.TLS.Hosts, ",") != "devbox,10.0.0.2" {
+		t.Errorf("tls.hosts = %v", cfg.TLS.Hosts)
+	}
+	if cfg.LogFile != "from-flag.log" {
+		t.Errorf("log_file = %q", cfg.LogFile)
+	}
+	want := map[string]string{
+		"api_token":            "file",
+		"allowed_commands":     "env (DEVPROXY_ALLOWED_COMMANDS)",
+		"tracing.sample_ratio": "env (DEVPROXY_TRACING_SAMPLE_RATIO)",
+		"tracing.service_name": "file",
+		"tracing.insecure":     "default",
+		"log_file":             "flag (-log)",
+		"bind":                 "default",
+	}
+	for field, source := range want {
+		if sources[field] != source {
+			t.Errorf("source of %s = %q, want %q", field, sources[field], source)
+		}
+	}
+}
+
+func TestBuildConfigBadEnv(t *testing.T) {
+	tests := []struct {
+		env, value, path string
+	}{
+		{"DEVPROXY_PORT", "abc", "$.port"},
+		{"DEVPROXY_TLS_SELF_SIGNED", "maybe", "$.tls.self_signed"},
+		{"DEVPROXY_TRACING_SAMPLE_RATIO", "half", "$.tracing.sample_ratio"},
+		{"DEVPROXY_TRACING_HEADERS", "novalue", "$.tracing.headers"},
+		{"DEVPROXY_ALLOWED_PATHS", "[1]", "$.allowed_paths"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.env, func(t *testing.T) {
+			clearConfigEnv(t)
+			t.Setenv(tt.env, tt.value)
+			_, _, err := buildConfig(parseFlags(t, writeConfig(t, "")))
+			var problems api.ConfigErrors
+			if !errors.As(err, &problems) {
+				t.Fatalf("err = %v, want ConfigErrors", err)
+			}
+			found := false
+			for _, p := range problems {
+				if p.Path == tt.path && strings.Contains(p.Message, tt.env) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("problems = %v, want one at %s naming %s", problems, tt.path, tt.env)
+			}
+		})
+	}
+}
+
+func TestRunEffectiveConfig(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("DEVPROXY_BIND", "127.0.0.2")
+	path := writeConfig(t, `,"port":3000,"tracing":{"headers":{"authorization":"secret"}}`)
+
+	out := captureStdout(t, func() {
+		if code := runEffectiveConfig(parseFlags(t, path)); code != 0 {
+			t.Errorf("exit code %d", code)
+		}
+	})
+	lines := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if f := strings.Fields(line); len(f) > 1 && f[0] != "#" {
+			lines[f[0]] = strings.Join(f[1:], " ")
+		}
+	}
+	for field, want := range map[string]string{
+		"port":            "3000 file",
+		"bind":            `"127.0.0.2" env (DEVPROXY_BIND)`,
+		"max_concurrent":  "4 default",
+		"api_token":       "<redacted> file",
+		"tracing.headers": "<redacted> file",
+	} {
+		if lines[field] != want {
+			t.Errorf("%s: %q, want %q", field, lines[field], want)
+		}
+	}
+	if strings.Contains(out, "secret") || strings.Contains(out, "0123456789abcdef") {
+		t.Errorf("effective-config printed a secret:\n%s", out)
+	}
+}
+
+// captureStdout returns what fn writes to os.Stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		done <- string(b)
+	}()
+	defer func() { os.Stdout = stdout }()
+	fn()
+	w.Close()
+	return <-done
+}
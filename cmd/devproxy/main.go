@@ -1,72 +1,57 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
-	"strings"
-	"time"
+	"syscall"
 
-	"golang.org/x/sys/windows/svc"
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+	"github.com/mscrnt/DevProxy/pkg/server"
 )
 
-type Config struct {
-	APIToken      string   `json:"api_token"`
-	AllowedCmds   []string `json:"allowed_commands"`
-	AllowedPaths  []string `json:"allowed_paths"`
-	LogFile       string   `json:"log_file"`
-	Port          int      `json:"port"`
-}
-
-type RunRequest struct {
-	Command string   `json:"command"`
-	Args    []string `json:"args"`
-	CWD     string   `json:"cwd"`
-}
-
-type RunResponse struct {
-	Stdout   string `json:"stdout"`
-	Stderr   string `json:"stderr"`
-	ExitCode int    `json:"exit_code"`
-}
-
-type LogEntry struct {
-	Timestamp string   `json:"timestamp"`
-	IP        string   `json:"ip"`
-	Command   string   `json:"command"`
-	Args      []string `json:"args"`
-	CWD       string   `json:"cwd"`
-	Stdout    string   `json:"stdout"`
-	Stderr    string   `json:"stderr"`
-	ExitCode  int      `json:"exit_code"`
-	Status    string   `json:"status"`
-	Reason    string   `json:"reason,omitempty"`
-}
-
-type devProxyService struct {
-	server *http.Server
-}
-
+// Set at build time with -ldflags "-X main.version=... -X main.commit=...".
 var (
-	config     Config
-	logFile    *os.File
-	bannedKeys = []string{"reg", "shutdown", "format", "schtasks", "sc", "net", "bcdedit", "diskpart"}
+	version = "dev"
+	commit  = "unknown"
 )
 
 func main() {
-	isIntSess, err := svc.IsAnInteractiveSession()
+	registerConfigFlags(flag.CommandLine, &configOpts)
+	flag.Usage = printUsage
+	flag.Parse()
+	recordSetFlags(flag.CommandLine, &configOpts)
+
+	switch flag.Arg(0) {
+	case "":
+	case "validate-config":
+		os.Exit(runValidateConfig(configOpts, flag.Args()[1:]))
+	case "effective-config":
+		os.Exit(runEffectiveConfig(configOpts))
+	case "config-schema":
+		os.Stdout.Write(api.ConfigSchema)
+		return
+	case "service":
+		os.Exit(runServiceCommand(flag.Args()[1:]))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", flag.Arg(0))
+		printUsage()
+		os.Exit(2)
+	}
+
+	isService, err := runningAsService()
 	if err != nil {
-		log.Fatalf("Failed to determine if we are running in an interactive session: %v", err)
+		log.Fatalf("Failed to determine if we are running as a service: %v", err)
 	}
 
-	if !isIntSess {
+	if isService {
 		runService()
 		return
 	}
@@ -75,156 +60,130 @@ func main() {
 }
 
 func runInteractive() {
-	if err := loadConfig(); err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+	srv, cleanup, err := newServer()
+	if err != nil {
+		log.Fatalf("%v", err)
 	}
+	defer cleanup(context.Background())
 
-	if err := initLogging(); err != nil {
-		log.Fatalf("Failed to initialize logging: %v", err)
+	log.Println("Running in interactive mode...")
+	if err := srv.Start(); err != nil {
+		log.Fatalf("Server failed: %v", err)
 	}
-	defer logFile.Close()
+	go handleStopSignals(srv)
+	sdNotify("READY=1")
 
-	log.Println("Running in interactive mode...")
-	startServer()
+	if err := srv.Wait(); err != nil {
+		log.Fatalf("Server failed: %v", err)
+	}
 }
 
-func runService() {
-	err := svc.Run("DevProxy", &devProxyService{})
+// newServer loads the config and builds the server with its audit log,
+// tracing and config file watching set up. The returned function closes the
+// log and flushes traces once the server has stopped. It is shared by
+// interactive mode and the Windows service.
+func newServer() (*server.Server, func(context.Context) error, error) {
+	cfg, err := loadConfig()
 	if err != nil {
-		log.Printf("Service failed: %v", err)
+		return nil, nil, fmt.Errorf("Failed to load config: %v", err)
 	}
-}
 
-func (m *devProxyService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (ssec bool, errno uint32) {
-	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown
-	changes <- svc.Status{State: svc.StartPending}
-
-	if err := loadConfig(); err != nil {
-		log.Printf("Failed to load config: %v", err)
-		return
+	shutdownTracing, err := initTracing(cfg.Tracing)
+	if err != nil {
+		log.Printf("Failed to initialize tracing: %v", err)
 	}
 
-	if err := initLogging(); err != nil {
-		log.Printf("Failed to initialize logging: %v", err)
-		return
+	fl, err := server.OpenFileLogger(cfg.LogFile)
+	if err != nil {
+		shutdownTracing(context.Background())
+		return nil, nil, fmt.Errorf("Failed to initialize server: cannot open log file: %v", err)
+	}
+	srv, err := server.New(cfg, server.Options{
+		Logger: consoleLogger{fl},
+		Load: func() (api.Config, error) {
+			cfg, _, err := buildConfig(configOpts)
+			return cfg, err
+		},
+		StateDir: filepath.Dir(configFilePath),
+		Version:  version,
+		Commit:   commit,
+	})
+	if err != nil {
+		fl.Close()
+		shutdownTracing(context.Background())
+		return nil, nil, fmt.Errorf("Failed to initialize server: %v", err)
 	}
-	defer logFile.Close()
 
-	port := config.Port
-	if port == 0 {
-		port = 2223
+	go watchConfig(srv)
+	cleanup := func(ctx context.Context) error {
+		fl.Close()
+		return shutdownTracing(ctx)
 	}
-	
-	m.server = &http.Server{
-		Addr: fmt.Sprintf("127.0.0.1:%d", port),
-	}
-
-	http.HandleFunc("/run", authMiddleware(handleRun))
-
-	go func() {
-		log.Printf("Starting HTTP server on %s", m.server.Addr)
-		logEntry(LogEntry{
-			Timestamp: time.Now().Format(time.RFC3339),
-			IP:        "system",
-			Status:    "service_start",
-			Reason:    fmt.Sprintf("DevProxy service started on %s", m.server.Addr),
-		})
+	return srv, cleanup, nil
+}
 
-		if err := m.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Printf("HTTP server error: %v", err)
-		}
-	}()
+// consoleLogger writes the audit log to a file and the server's diagnostic
+// messages to the console (or the service's log).
+type consoleLogger struct {
+	*server.FileLogger
+}
 
-	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
+func (consoleLogger) Printf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+}
 
-loop:
-	for {
-		select {
-		case c := <-r:
-			switch c.Cmd {
-			case svc.Interrogate:
-				changes <- c.CurrentStatus
-			case svc.Stop, svc.Shutdown:
-				log.Println("Received stop command")
-				logEntry(LogEntry{
-					Timestamp: time.Now().Format(time.RFC3339),
-					IP:        "system",
-					Status:    "service_stop",
-					Reason:    "DevProxy service stopping",
-				})
-				break loop
-			default:
-				log.Printf("Unexpected control request #%d", c)
-			}
-		}
-	}
+// handleStopSignals gracefully stops the server on SIGTERM (systemd,
+// launchd, docker) or Ctrl+C, mirroring the svc.Stop handling of the
+// Windows service.
+func handleStopSignals(srv *server.Server) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	sig := <-sigs
 
-	changes <- svc.Status{State: svc.StopPending}
-	m.server.Close()
-	return
+	log.Printf("Received %v, stopping", sig)
+	sdNotify("STOPPING=1")
+	srv.Shutdown(context.Background())
 }
 
-func startServer() {
-	http.HandleFunc("/run", authMiddleware(handleRun))
-	
-	port := config.Port
-	if port == 0 {
-		port = 2223
-	}
-	
-	addr := fmt.Sprintf("127.0.0.1:%d", port)
-	log.Printf("DevProxy starting on %s", addr)
-	logEntry(LogEntry{
-		Timestamp: time.Now().Format(time.RFC3339),
-		IP:        "system",
-		Status:    "server_start",
-		Reason:    fmt.Sprintf("DevProxy started on %s", addr),
-	})
-
-	if err := http.ListenAndServe(addr, nil); err != nil {
-		log.Fatalf("Server failed: %v", err)
-	}
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: devproxy [flags] [command]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  (none)            Run the server (as a service when started by the SCM)")
+	fmt.Fprintln(os.Stderr, "  validate-config   Check the config and print every problem")
+	fmt.Fprintln(os.Stderr, "  effective-config  Print the merged config and where each value came from")
+	fmt.Fprintln(os.Stderr, "  config-schema     Print the config JSON Schema")
+	fmt.Fprintln(os.Stderr, "  service install|uninstall|status")
+	fmt.Fprintln(os.Stderr, "                    Manage the system service (systemd, launchd or Windows SCM)")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Flags:")
+	flag.PrintDefaults()
 }
 
-func loadConfig() error {
-	exePath, err := os.Executable()
+func loadConfig() (api.Config, error) {
+	configPath, err := resolveConfigPath(configOpts)
 	if err != nil {
-		return err
+		return api.Config{}, err
 	}
-	baseDir := filepath.Dir(exePath)
-	configPath := filepath.Join(baseDir, "config", "config.json")
+	configFilePath = configPath
 
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return createDefaultConfig(configPath)
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		if err := createDefaultConfig(configPath); err != nil {
+			return api.Config{}, err
 		}
-		return err
 	}
 
-	return json.Unmarshal(data, &config)
+	cfg, _, err := buildConfig(configOpts)
+	return cfg, err
 }
 
 func createDefaultConfig(path string) error {
 	token := generateToken()
-	
-	config = Config{
-		APIToken: token,
-		AllowedCmds: []string{
-			"go", "msbuild", "signtool", "powershell",
-			"dotnet", "gcc", "g++", "make", "cmake",
-			"npm", "node", "python", "pip",
-		},
-		AllowedPaths: []string{
-			"C:\\Dev",
-			"C:\\Users\\*\\Projects",
-			"C:\\Users\\*\\source\\repos",
-		},
-		LogFile: "logs\\log.txt",
-		Port:    2223,
-	}
 
-	data, err := json.MarshalIndent(config, "", "  ")
+	cfg := api.DefaultConfig()
+	cfg.APIToken = token
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -251,225 +210,3 @@ func generateToken() string {
 	}
 	return hex.EncodeToString(bytes)
 }
-
-func initLogging() error {
-	exePath, err := os.Executable()
-	if err != nil {
-		return err
-	}
-	baseDir := filepath.Dir(exePath)
-	
-	logPath := config.LogFile
-	if !filepath.IsAbs(logPath) {
-		logPath = filepath.Join(baseDir, logPath)
-	}
-	
-	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
-		return err
-	}
-
-	logFile, err = os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	return err
-}
-
-func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("X-Admin-Token")
-		if token != config.APIToken {
-			logEntry(LogEntry{
-				Timestamp: time.Now().Format(time.RFC3339),
-				IP:        r.RemoteAddr,
-				Status:    "auth_failed",
-				Reason:    "Invalid or missing token",
-			})
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-		next(w, r)
-	}
-}
-
-func handleRun(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	var req RunRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	entry := LogEntry{
-		Timestamp: time.Now().Format(time.RFC3339),
-		IP:        r.RemoteAddr,
-		Command:   req.Command,
-		Args:      req.Args,
-		CWD:       req.CWD,
-	}
-
-	if err := validateRequest(&req); err != nil {
-		entry.Status = "rejected"
-		entry.Reason = err.Error()
-		logEntry(entry)
-		http.Error(w, err.Error(), http.StatusForbidden)
-		return
-	}
-
-	stdout, stderr, exitCode := executeCommand(req)
-
-	entry.Stdout = stdout
-	entry.Stderr = stderr
-	entry.ExitCode = exitCode
-	entry.Status = "completed"
-	logEntry(entry)
-
-	resp := RunResponse{
-		Stdout:   stdout,
-		Stderr:   stderr,
-		ExitCode: exitCode,
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(resp)
-}
-
-func validateRequest(req *RunRequest) error {
-	if !isCommandAllowed(req.Command) {
-		return fmt.Errorf("command '%s' is not allowed", req.Command)
-	}
-
-	if !isPathAllowed(req.CWD) {
-		return fmt.Errorf("working directory '%s' is not in allowed paths", req.CWD)
-	}
-
-	fullCmd := req.Command + " " + strings.Join(req.Args, " ")
-	fullCmdLower := strings.ToLower(fullCmd)
-	for _, banned := range bannedKeys {
-		// Check for banned keyword with word boundaries
-		// This prevents false positives like "Scripts" matching "sc"
-		if banned == "sc" {
-			// Special case for "sc" - must be whole word
-			if strings.Contains(fullCmdLower, " "+banned+" ") || 
-			   strings.HasPrefix(fullCmdLower, banned+" ") ||
-			   strings.HasSuffix(fullCmdLower, " "+banned) ||
-			   fullCmdLower == banned {
-				return fmt.Errorf("command contains banned keyword: %s", banned)
-			}
-		} else if strings.Contains(fullCmdLower, banned) {
-			return fmt.Errorf("command contains banned keyword: %s", banned)
-		}
-	}
-
-	for _, arg := range req.Args {
-		if strings.Contains(arg, "..") {
-			return fmt.Errorf("path traversal detected in arguments")
-		}
-		
-		if isRestrictedPath(arg) {
-			return fmt.Errorf("argument contains restricted path: %s", arg)
-		}
-	}
-
-	return nil
-}
-
-func isCommandAllowed(cmd string) bool {
-	cmd = strings.ToLower(filepath.Base(cmd))
-	cmd = strings.TrimSuffix(cmd, ".exe")
-	
-	for _, allowed := range config.AllowedCmds {
-		if strings.ToLower(allowed) == cmd {
-			return true
-		}
-	}
-	return false
-}
-
-func isPathAllowed(path string) bool {
-	if path == "" {
-		return false
-	}
-
-	absPath, err := filepath.Abs(path)
-	if err != nil {
-		return false
-	}
-
-	for _, allowed := range config.AllowedPaths {
-		if strings.Contains(allowed, "*") {
-			pattern := strings.ReplaceAll(allowed, "\\", "/")
-			pattern = strings.ReplaceAll(pattern, "*", ".*")
-			testPath := strings.ReplaceAll(absPath, "\\", "/")
-			
-			if matched, _ := filepath.Match(pattern, testPath); matched {
-				return true
-			}
-		} else {
-			if strings.HasPrefix(strings.ToLower(absPath), strings.ToLower(allowed)) {
-				return true
-			}
-		}
-	}
-	
-	return false
-}
-
-func isRestrictedPath(path string) bool {
-	restricted := []string{
-		"C:\\Windows",
-		"C:\\Program Files",
-		"C:\\Program Files (x86)",
-		"C:\\ProgramData",
-		"C:\\System",
-	}
-
-	absPath, _ := filepath.Abs(path)
-	lowerPath := strings.ToLower(absPath)
-
-	for _, r := range restricted {
-		if strings.HasPrefix(lowerPath, strings.ToLower(r)) {
-			return true
-		}
-	}
-	
-	return false
-}
-
-func executeCommand(req RunRequest) (string, string, int) {
-	cmd := exec.Command(req.Command, req.Args...)
-	cmd.Dir = req.CWD
-
-	stdout, _ := cmd.StdoutPipe()
-	stderr, _ := cmd.StderrPipe()
-
-	if err := cmd.Start(); err != nil {
-		return "", err.Error(), 1
-	}
-
-	stdoutBytes, _ := io.ReadAll(stdout)
-	stderrBytes, _ := io.ReadAll(stderr)
-
-	err := cmd.Wait()
-	exitCode := 0
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			exitCode = exitErr.ExitCode()
-		} else {
-			exitCode = 1
-		}
-	}
-
-	return string(stdoutBytes), string(stderrBytes), exitCode
-}
-
-func logEntry(entry LogEntry) {
-	if logFile == nil {
-		return
-	}
-	data, _ := json.Marshal(entry)
-	logFile.Write(data)
-	logFile.Write([]byte("\n"))
-	logFile.Sync()
-}
\ No newline at end of file
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"github.com/mscrnt/DevProxy/pkg/server"
+)
+
+const configWatchInterval = 2 * time.Second
+
+var configFilePath string
+
+// watchConfig polls the config file and reloads it whenever its size or
+// modification time changes. Polling keeps this dependency-free and works
+// the same on every filesystem, including network shares.
+func watchConfig(srv *server.Server) {
+	var lastMod time.Time
+	var lastSize int64
+	if fi, err := os.Stat(configFilePath); err == nil {
+		lastMod, lastSize = fi.ModTime(), fi.Size()
+	}
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		fi, err := os.Stat(configFilePath)
+		if err != nil {
+			continue
+		}
+		if fi.ModTime().Equal(lastMod) && fi.Size() == lastSize {
+			continue
+		}
+		lastMod, lastSize = fi.ModTime(), fi.Size()
+		srv.Reload("file watcher")
+	}
+}
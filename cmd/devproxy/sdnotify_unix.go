@@ -0,0 +1,31 @@
+//go:build !windows
+
+package main
+
+import (
+	"net"
+	"os"
+)
+
+// sdNotify sends a state string such as "READY=1" or "STOPPING=1" to the
+// service manager over $NOTIFY_SOCKET. It is a no-op when not started by
+// systemd with Type=notify.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// A leading '@' denotes a socket in the abstract namespace.
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	return err
+}
@@ -0,0 +1,7 @@
+package main
+
+// sdNotify is a no-op on Windows; the service control manager is informed
+// through svc.Status instead.
+func sdNotify(state string) error {
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+// runningAsService is always false outside Windows; service managers such
+// as systemd and launchd run the server in the foreground.
+func runningAsService() (bool, error) {
+	return false, nil
+}
+
+func runService() {
+	runInteractive()
+}
@@ -0,0 +1,81 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// stopHeadroom is added to the shutdown grace period in the StopPending
+// wait hint to cover killing what is left and flushing the audit log.
+const stopHeadroom = 10 * time.Second
+
+type devProxyService struct{}
+
+// runningAsService reports whether the process was started by the Windows
+// service control manager rather than from a console.
+func runningAsService() (bool, error) {
+	isIntSess, err := svc.IsAnInteractiveSession()
+	if err != nil {
+		return false, err
+	}
+	return !isIntSess, nil
+}
+
+func runService() {
+	err := svc.Run("DevProxy", &devProxyService{})
+	if err != nil {
+		log.Printf("Service failed: %v", err)
+	}
+}
+
+func (m *devProxyService) Execute(args []string, r <-chan svc.ChangeRequest, changes chan<- svc.Status) (ssec bool, errno uint32) {
+	const cmdsAccepted = svc.AcceptStop | svc.AcceptShutdown
+	changes <- svc.Status{State: svc.StartPending}
+
+	srv, cleanup, err := newServer()
+	if err != nil {
+		log.Printf("%v", err)
+		return
+	}
+	defer cleanup(context.Background())
+
+	if err := srv.Start(); err != nil {
+		log.Printf("Failed to start: %v", err)
+		return
+	}
+	go func() {
+		if err := srv.Wait(); err != nil {
+			log.Printf("HTTP server error: %v", err)
+		}
+	}()
+
+	changes <- svc.Status{State: svc.Running, Accepts: cmdsAccepted}
+
+loop:
+	for {
+		select {
+		case c := <-r:
+			switch c.Cmd {
+			case svc.Interrogate:
+				changes <- c.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				log.Println("Received stop command")
+				break loop
+			default:
+				log.Printf("Unexpected control request #%d", c)
+			}
+		}
+	}
+
+	// Tell the SCM how long draining may take so it does not give up on
+	// the service while in-flight commands finish.
+	grace := time.Duration(srv.Config().ShutdownGrace)*time.Second + stopHeadroom
+	changes <- svc.Status{State: svc.StopPending, WaitHint: uint32(grace / time.Millisecond)}
+	srv.Shutdown(context.Background())
+	return
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+const serviceName = "devproxy"
+
+// serviceOptions describes the service to install. ConfigPath is always
+// absolute so the installed unit does not depend on the working directory.
+type serviceOptions struct {
+	Exec       string
+	ConfigPath string
+	User       string
+	Socket     bool
+	Config     api.Config
+}
+
+// runServiceCommand implements "devproxy service install|uninstall|status"
+// on top of the platform's service manager.
+func runServiceCommand(args []string) int {
+	if len(args) < 1 {
+		printServiceUsage()
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "install":
+		var opts serviceOptions
+		opts, err = serviceInstallOptions(args[1:])
+		if err == nil {
+			err = installService(opts)
+		}
+	case "uninstall":
+		err = uninstallService()
+	case "status":
+		err = serviceStatus()
+	default:
+		printServiceUsage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func printServiceUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: devproxy [-config path] service <install|uninstall|status>")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "install flags:")
+	fmt.Fprintln(os.Stderr, "  -user string   Run the service as this account (default: the service manager's default)")
+	fmt.Fprintln(os.Stderr, "  -socket        Use systemd socket activation (Linux only)")
+}
+
+// serviceInstallOptions parses install flags and loads the config that the
+// service will use, creating the default config if needed, so that
+// installation fails early on an invalid config.
+func serviceInstallOptions(args []string) (serviceOptions, error) {
+	var opts serviceOptions
+
+	fs := flag.NewFlagSet("service install", flag.ContinueOnError)
+	fs.StringVar(&opts.User, "user", "", "Run the service as this account")
+	fs.BoolVar(&opts.Socket, "socket", false, "Use systemd socket activation")
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return opts, err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return opts, err
+	}
+	opts.Exec = exe
+
+	if opts.Config, err = loadConfig(); err != nil {
+		return opts, fmt.Errorf("config is not valid: %v", err)
+	}
+	if opts.ConfigPath, err = filepath.Abs(configFilePath); err != nil {
+		return opts, err
+	}
+
+	return opts, nil
+}
+
+// stopTimeout is how long the service manager should wait for a stop
+// before killing the service: the drain grace period plus headroom for
+// aborting what is left.
+func stopTimeout(grace int) int {
+	return grace + 10
+}
+
+// writablePaths lists the directories the service must be able to write:
+// the allowed paths (cut at the first wildcard segment), the log directory
+// and the Unix socket directory. Used to open holes in read-only sandboxes.
+func writablePaths(opts serviceOptions) []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(p string) {
+		p = filepath.Clean(p)
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+
+	for _, p := range opts.Config.AllowedPaths {
+		if i := strings.Index(p, "*"); i >= 0 {
+			p = filepath.Dir(p[:i+1])
+		}
+		add(p)
+	}
+
+	logPath := opts.Config.LogFile
+	if !filepath.IsAbs(logPath) {
+		logPath = filepath.Join(filepath.Dir(opts.Exec), logPath)
+	}
+	add(filepath.Dir(logPath))
+
+	if opts.Config.Listen.Network == "unix" {
+		add(filepath.Dir(opts.Config.Listen.Path))
+	}
+
+	return out
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// initTracing installs the W3C trace context propagator and, if enabled in
+// tc, an OTLP/HTTP exporter. The returned function flushes and stops
+// the exporter and is always safe to call.
+func initTracing(tc api.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	noop := func(context.Context) error { return nil }
+	if !tc.Enabled {
+		return noop, nil
+	}
+
+	opts := []otlptracehttp.Option{}
+	if tc.OTLPEndpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(tc.OTLPEndpoint))
+	}
+	if tc.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(tc.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(tc.Headers))
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return noop, fmt.Errorf("failed to create OTLP exporter: %v", err)
+	}
+
+	serviceName := tc.ServiceName
+	if serviceName == "" {
+		serviceName = "devproxy"
+	}
+
+	ratio := tc.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		ratio = 1
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithBatchTimeout(5*time.Second)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+	"github.com/mscrnt/DevProxy/pkg/server"
+)
+
+// otlpReceiver stands in for an OTLP/HTTP collector, keeping the trace ID
+// and service name of each span it is sent.
+type otlpReceiver struct {
+	mu      sync.Mutex
+	headers []http.Header
+	spans   map[string]string // trace ID -> service.name
+}
+
+func (rc *otlpReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/v1/traces" {
+		http.NotFound(w, r)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	var req coltracepb.ExportTraceServiceRequest
+	if err := proto.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.headers = append(rc.headers, r.Header.Clone())
+	for _, rs := range req.ResourceSpans {
+		service := ""
+		for _, kv := range rs.GetResource().GetAttributes() {
+			if kv.Key == "service.name" {
+				service = kv.GetValue().GetStringValue()
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			for _, span := range ss.Spans {
+				rc.spans[hex.EncodeToString(span.TraceId)] = service
+			}
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	out, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Write(out)
+}
+
+// TestInitTracingExports sends requests with an incoming traceparent to a
+// server traced by initTracing and checks what reaches the collector.
+func TestInitTracingExports(t *testing.T) {
+	rc := &otlpReceiver{spans: map[string]string{}}
+	collector := httptest.NewServer(rc)
+	defer collector.Close()
+
+	shutdown, err := initTracing(api.TracingConfig{
+		Enabled:      true,
+		OTLPEndpoint: collector.URL + "/v1/traces",
+		Insecure:     true,
+		Headers:      map[string]string{"X-Collector-Key": "k1"},
+		ServiceName:  "devproxy-test",
+	})
+	if err != nil {
+		t.Fatalf("initTracing: %v", err)
+	}
+
+	dir := t.TempDir()
+	cfg := api.DefaultConfig()
+	cfg.APIToken = "test-token-0123456789"
+	cfg.AllowedPaths = []string{dir}
+	srv, err := server.New(cfg, server.Options{Logger: discardLogger{}, StateDir: dir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	const sampled, unsampled = "0af7651916cd43dd8448eb211c80319c", "4bf92f3577b34da6a3ce929d0e0e4736"
+	for _, tp := range []string{
+		"00-" + sampled + "-b7ad6b7169203331-01",
+		"00-" + unsampled + "-00f067aa0ba902b7-00",
+	} {
+		req, _ := http.NewRequest("GET", ts.URL+"/v1/version", nil)
+		req.Header.Set("X-Admin-Token", cfg.APIToken)
+		req.Header.Set("traceparent", tp)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	// Shutdown flushes the batch to the collector.
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if service, ok := rc.spans[sampled]; !ok {
+		t.Errorf("no span with trace ID %s reached the collector (got %v)", sampled, rc.spans)
+	} else if service != "devproxy-test" {
+		t.Errorf("service.name = %q, want devproxy-test", service)
+	}
+	if _, ok := rc.spans[unsampled]; ok {
+		t.Error("a span under an unsampled parent was exported")
+	}
+	for _, h := range rc.headers {
+		if h.Get("X-Collector-Key") != "k1" {
+			t.Errorf("export request without the configured header: %v", h)
+		}
+	}
+}
+
+func TestInitTracingDisabled(t *testing.T) {
+	shutdown, err := initTracing(api.TracingConfig{})
+	if err != nil {
+		t.Fatalf("initTracing: %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Log(api.LogEntry) {}
@@ -0,0 +1,396 @@
+package api
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConfigSchema is the JSON Schema for the config file.
+//
+//go:embed config.schema.json
+var ConfigSchema []byte
+
+const minTokenLength = 16
+
+const (
+	defaultPort          = 2223
+	defaultBind          = "127.0.0.1"
+	defaultMaxConcurrent = 4
+	defaultMaxQueued     = 32
+	defaultShutdownGrace = 20
+)
+
+// BannedKeywords may not appear anywhere in a command line, and may not be
+// listed in allowed_commands.
+var BannedKeywords = []string{"reg", "shutdown", "format", "schtasks", "sc", "net", "bcdedit", "diskpart"}
+
+// RestartOnlyFields names, by JSON field, the settings a server reads once
+// at startup. A reload reports changes to them but keeps the running
+// values until the server is restarted.
+var RestartOnlyFields = []string{"port", "bind", "listen", "tls", "max_concurrent", "tracing"}
+
+// Config is the server configuration, normally read from config.json.
+type Config struct {
+	APIToken       string        `json:"api_token"`
+	AllowedCmds    []string      `json:"allowed_commands"`
+	AllowedPaths   []string      `json:"allowed_paths"`
+	LogFile        string        `json:"log_file"`
+	Port           int           `json:"port"`
+	Bind           string        `json:"bind,omitempty"`
+	AllowedClients []string      `json:"allowed_clients,omitempty"`
+	MaxConcurrent  int           `json:"max_concurrent,omitempty"`
+	MaxQueued      int           `json:"max_queued,omitempty"`
+	ShutdownGrace  int           `json:"shutdown_grace_seconds,omitempty"`
+	Listen         ListenConfig  `json:"listen"`
+	TLS            TLSConfig     `json:"tls"`
+	Tracing        TracingConfig `json:"tracing"`
+	Files          FilesConfig   `json:"files"`
+}
+
+// DefaultConfig returns the platform defaults. It has no API token; callers
+// creating a config file must generate one.
+func DefaultConfig() Config {
+	return Config{
+		AllowedCmds:   append([]string(nil), defaultAllowedCmds...),
+		AllowedPaths:  append([]string(nil), defaultAllowedPaths...),
+		LogFile:       defaultLogFile,
+		Port:          defaultPort,
+		Bind:          defaultBind,
+		MaxConcurrent: defaultMaxConcurrent,
+		MaxQueued:     defaultMaxQueued,
+	}
+}
+
+// RestartChanges returns the RestartOnlyFields that differ between the
+// running config and next, the changes a reload leaves unapplied.
+func RestartChanges(running, next Config) []string {
+	rv, nv := reflect.ValueOf(running), reflect.ValueOf(next)
+	t := rv.Type()
+	var changed []string
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if isRestartOnly(name) && !reflect.DeepEqual(rv.Field(i).Interface(), nv.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+func isRestartOnly(name string) bool {
+	for _, f := range RestartOnlyFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigProblem is a single validation failure located by its JSON path,
+// e.g. "$.allowed_paths[1]".
+type ConfigProblem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ConfigErrors collects every problem found in a config so users can fix
+// them in one pass rather than one restart at a time.
+type ConfigErrors []ConfigProblem
+
+func (e ConfigErrors) Error() string {
+	parts := make([]string, len(e))
+	for i, p := range e {
+		parts[i] = p.Path + ": " + p.Message
+	}
+	return "invalid config: " + strings.Join(parts, "; ")
+}
+
+// Add records a problem at path.
+func (e *ConfigErrors) Add(path, format string, args ...interface{}) {
+	*e = append(*e, ConfigProblem{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// DecodeConfig strictly decodes a config document, reporting unknown keys
+// and wrong types together as ConfigErrors. It also returns the generic
+// decoded document so callers can see which keys the file set. Semantic
+// validation happens later in ValidateConfig, once every layer is applied.
+func DecodeConfig(data []byte) (Config, interface{}, ConfigErrors) {
+	var raw interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		if se, ok := err.(*json.SyntaxError); ok {
+			line, col := offsetToLineCol(data, se.Offset)
+			return Config{}, nil, ConfigErrors{{Path: "$", Message: fmt.Sprintf("syntax error at line %d, column %d: %v", line, col, se)}}
+		}
+		return Config{}, nil, ConfigErrors{{Path: "$", Message: err.Error()}}
+	}
+
+	var problems ConfigErrors
+	checkShape(raw, reflect.TypeOf(Config{}), "$", &problems)
+
+	// Type mismatches were already reported by checkShape with better
+	// paths; json.Unmarshal still fills in every other field so the
+	// semantic checks can run on them.
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); !ok || len(problems) == 0 {
+			problems.Add("$", "%v", err)
+		}
+	}
+	return cfg, raw, problems
+}
+
+// ApplyDefaults fills in zero-valued settings that have defaults.
+func ApplyDefaults(cfg *Config) {
+	if cfg.Port == 0 {
+		cfg.Port = defaultPort
+	}
+	if cfg.Bind == "" {
+		cfg.Bind = defaultBind
+	}
+	if cfg.MaxConcurrent <= 0 {
+		cfg.MaxConcurrent = defaultMaxConcurrent
+	}
+	if cfg.MaxQueued <= 0 {
+		cfg.MaxQueued = defaultMaxQueued
+	}
+	if cfg.ShutdownGrace <= 0 {
+		cfg.ShutdownGrace = defaultShutdownGrace
+	}
+	applyFilesDefaults(&cfg.Files)
+	if cfg.Listen.Path == "" {
+		switch cfg.Listen.Network {
+		case "unix":
+			cfg.Listen.Path = defaultSocketPath
+		case "pipe":
+			cfg.Listen.Path = defaultPipePath
+		}
+	}
+}
+
+// ValidateConfig applies the semantic checks that the JSON Schema expresses
+// as minLength, minimum/maximum, uniqueItems and so on.
+func ValidateConfig(cfg Config) error {
+	var problems ConfigErrors
+
+	switch {
+	case cfg.APIToken == "":
+		problems.Add("$.api_token", "must not be empty; an empty token disables authentication")
+	case len(cfg.APIToken) < minTokenLength:
+		problems.Add("$.api_token", "must be at least %d characters (got %d)", minTokenLength, len(cfg.APIToken))
+	}
+
+	if len(cfg.AllowedCmds) == 0 {
+		problems.Add("$.allowed_commands", "must list at least one command")
+	}
+	seen := map[string]bool{}
+	for i, c := range cfg.AllowedCmds {
+		path := fmt.Sprintf("$.allowed_commands[%d]", i)
+		lower := strings.ToLower(c)
+		switch {
+		case strings.TrimSpace(c) == "":
+			problems.Add(path, "must not be empty")
+		case strings.ContainsAny(c, `/\ `):
+			problems.Add(path, "must be a bare executable name without path or spaces (got %q)", c)
+		case seen[lower]:
+			problems.Add(path, "duplicate command %q", c)
+		}
+		for _, banned := range BannedKeywords {
+			if lower == banned {
+				problems.Add(path, "%q is a banned command and would always be rejected", c)
+			}
+		}
+		seen[lower] = true
+	}
+
+	if len(cfg.AllowedPaths) == 0 {
+		problems.Add("$.allowed_paths", "must list at least one directory")
+	}
+	seen = map[string]bool{}
+	for i, p := range cfg.AllowedPaths {
+		path := fmt.Sprintf("$.allowed_paths[%d]", i)
+		lower := strings.ToLower(p)
+		switch {
+		case strings.TrimSpace(p) == "":
+			problems.Add(path, "must not be empty")
+		case !filepath.IsAbs(p):
+			problems.Add(path, "must be an absolute path (got %q)", p)
+		case strings.Contains(p, ".."):
+			problems.Add(path, "must not contain '..' (got %q)", p)
+		case seen[lower]:
+			problems.Add(path, "duplicate path %q", p)
+		}
+		seen[lower] = true
+	}
+
+	if strings.TrimSpace(cfg.LogFile) == "" {
+		problems.Add("$.log_file", "must not be empty")
+	}
+
+	if cfg.Port < 0 || cfg.Port > 65535 {
+		problems.Add("$.port", "must be between 1 and 65535, or 0 for the default (got %d)", cfg.Port)
+	}
+	validateBind(cfg, &problems)
+	if cfg.MaxConcurrent < 0 || cfg.MaxConcurrent > 256 {
+		problems.Add("$.max_concurrent", "must be between 1 and 256, or 0 for the default (got %d)", cfg.MaxConcurrent)
+	}
+	if cfg.MaxQueued < 0 || cfg.MaxQueued > 10000 {
+		problems.Add("$.max_queued", "must be between 1 and 10000, or 0 for the default (got %d)", cfg.MaxQueued)
+	}
+	if cfg.ShutdownGrace < 0 || cfg.ShutdownGrace > 3600 {
+		problems.Add("$.shutdown_grace_seconds", "must be between 1 and 3600, or 0 for the default (got %d)", cfg.ShutdownGrace)
+	}
+
+	validateListenConfig(cfg.Listen, &problems)
+	validateTLS(cfg.TLS, &problems)
+	validateFilesConfig(cfg.Files, &problems)
+
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		problems.Add("$.tracing.sample_ratio", "must be between 0 and 1 (got %v)", cfg.Tracing.SampleRatio)
+	}
+	if ep := cfg.Tracing.OTLPEndpoint; ep != "" {
+		u, err := url.Parse(ep)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems.Add("$.tracing.otlp_endpoint", "must be an http:// or https:// URL (got %q)", ep)
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// checkShape walks a generically decoded JSON value alongside the Go type
+// it will be decoded into, reporting unknown keys and type mismatches with
+// their JSON paths. encoding/json stops at the first such error and
+// silently ignores unknown keys, which hides typos like "token".
+func checkShape(v interface{}, t reflect.Type, path string, problems *ConfigErrors) {
+	if v == nil {
+		return
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			problems.Add(path, "must be an object, not %s", jsonKind(v))
+			return
+		}
+		fields := map[string]reflect.StructField{}
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if name != "" && name != "-" {
+				fields[name] = t.Field(i)
+			}
+		}
+		for _, k := range sortedKeys(obj) {
+			f, ok := fields[k]
+			if !ok {
+				problems.Add(path+"."+k, "unknown field%s", suggestField(k, fields))
+				continue
+			}
+			checkShape(obj[k], f.Type, path+"."+k, problems)
+		}
+	case reflect.Slice:
+		arr, ok := v.([]interface{})
+		if !ok {
+			problems.Add(path, "must be an array, not %s", jsonKind(v))
+			return
+		}
+		for i, e := range arr {
+			checkShape(e, t.Elem(), fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			problems.Add(path, "must be an object, not %s", jsonKind(v))
+			return
+		}
+		for _, k := range sortedKeys(obj) {
+			checkShape(obj[k], t.Elem(), path+"."+k, problems)
+		}
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			problems.Add(path, "must be a string, not %s", jsonKind(v))
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			problems.Add(path, "must be a boolean, not %s", jsonKind(v))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := v.(json.Number)
+		if !ok {
+			problems.Add(path, "must be an integer, not %s", jsonKind(v))
+			return
+		}
+		if _, err := n.Int64(); err != nil {
+			problems.Add(path, "must be an integer (got %s)", n)
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := v.(json.Number); !ok {
+			problems.Add(path, "must be a number, not %s", jsonKind(v))
+		}
+	}
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "an object"
+	case []interface{}:
+		return "an array"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	default:
+		return "null"
+	}
+}
+
+// suggestField offers a known key for common mistakes, such as "token" for
+// "api_token".
+func suggestField(key string, fields map[string]reflect.StructField) string {
+	lower := strings.ToLower(key)
+	for name := range fields {
+		if strings.Contains(name, lower) || strings.Contains(lower, name) {
+			return fmt.Sprintf(" (did you mean %q?)", name)
+		}
+	}
+	return ""
+}
+
+func offsetToLineCol(data []byte, offset int64) (int, int) {
+	line, col := 1, 1
+	for i := int64(0); i < offset && i < int64(len(data)); i++ {
+		if data[i] == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const testToken = "0123456789abcdef0123456789abcdef"
+
+func testPath() string {
+	if runtime.GOOS == "windows" {
+		return `C:\Dev`
+	}
+	return "/srv/dev"
+}
+
+func fullConfig() *Config {
+	return &Config{
+		APIToken:       testToken,
+		AllowedCmds:    []string{"go", "npm"},
+		AllowedPaths:   []string{testPath()},
+		LogFile:        "logs/log.txt",
+		Port:           2300,
+		Bind:           "127.0.0.1",
+		AllowedClients: []string{"10.0.0.0/8", "192.168.1.5"},
+		MaxConcurrent:  2,
+		MaxQueued:      8,
+		ShutdownGrace:  30,
+		Listen:         ListenConfig{Network: "tcp"},
+		TLS: TLSConfig{
+			SelfSigned:       true,
+			Hosts:            []string{"devbox.local"},
+			ClientCAFile:     "ca.pem",
+			ClientIdentities: []string{"alice"},
+		},
+		Tracing: TracingConfig{
+			Enabled:      true,
+			OTLPEndpoint: "http://localhost:4318",
+			Headers:      map[string]string{"x-tenant": "dev"},
+			ServiceName:  "devproxy",
+			SampleRatio:  0.5,
+		},
+		Files: FilesConfig{MaxFileMB: 64, UploadQuotaMB: 256, UploadTTLMinutes: 15, ArchiveMaxMB: 512, ArchiveMaxEntries: 1000, WatchIntervalMS: 250, MaxWatches: 4},
+	}
+}
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	cfg := DefaultConfig()
+	if cfg.APIToken != "" {
+		t.Fatal("DefaultConfig must not contain a token")
+	}
+	if err := ValidateConfig(cfg); err == nil {
+		t.Fatal("a config without a token must not validate")
+	}
+
+	cfg.APIToken = testToken
+	ApplyDefaults(&cfg)
+	if err := ValidateConfig(cfg); err != nil {
+		t.Fatalf("default config does not validate: %v", err)
+	}
+
+	again := cfg
+	ApplyDefaults(&again)
+	if !reflect.DeepEqual(again, cfg) {
+		t.Error("ApplyDefaults is not idempotent")
+	}
+
+	// Callers may edit the returned slices without changing the defaults.
+	cfg.AllowedCmds[0] = "changed"
+	if DefaultConfig().AllowedCmds[0] == "changed" {
+		t.Error("DefaultConfig shares its slices")
+	}
+}
+
+func TestFullConfigRoundTripsThroughDecodeConfig(t *testing.T) {
+	want := fullConfig()
+	data, err := json.MarshalIndent(want, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, problems := DecodeConfig(data)
+	if len(problems) > 0 {
+		t.Fatalf("DecodeConfig reported problems for its own output: %v", problems)
+	}
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("config changed in a round trip:\n got %+v\nwant %+v", got, *want)
+	}
+	if err := ValidateConfig(got); err != nil {
+		t.Errorf("round-tripped config does not validate: %v", err)
+	}
+}
+
+// Config files written by earlier releases, by hand from the README and by
+// the tray before it shared these types, must keep loading.
+func TestLegacyConfigsStillLoad(t *testing.T) {
+	path, _ := json.Marshal(testPath())
+	docs := map[string]string{
+		"original": `{
+			"api_token": "` + testToken + `",
+			"allowed_commands": ["go", "msbuild", "dotnet"],
+			"allowed_paths": [` + string(path) + `],
+			"log_file": "logs/log.txt",
+			"port": 2223
+		}`,
+		"without port": `{
+			"api_token": "` + testToken + `",
+			"allowed_commands": ["go"],
+			"allowed_paths": [` + string(path) + `],
+			"log_file": "logs/log.txt"
+		}`,
+		"with empty sections": `{
+			"api_token": "` + testToken + `",
+			"allowed_commands": ["go"],
+			"allowed_paths": [` + string(path) + `],
+			"log_file": "logs/log.txt",
+			"port": 0,
+			"listen": {},
+			"tls": {},
+			"tracing": {"enabled": false}
+		}`,
+	}
+
+	for name, doc := range docs {
+		cfg, _, problems := DecodeConfig([]byte(doc))
+		if len(problems) > 0 {
+			t.Errorf("%s: %v", name, problems)
+			continue
+		}
+		ApplyDefaults(&cfg)
+		if err := ValidateConfig(cfg); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if cfg.Port != defaultPort || cfg.Bind != defaultBind {
+			t.Errorf("%s: defaults not applied: port %d, bind %q", name, cfg.Port, cfg.Bind)
+		}
+	}
+}
+
+func TestDecodeConfigReportsEveryProblem(t *testing.T) {
+	doc := `{"token": "x", "api_token": 5, "allowed_commands": "go", "allowed_paths": [], "log_file": "l", "tls": {"self_signed": "yes"}}`
+	_, _, problems := DecodeConfig([]byte(doc))
+
+	var paths []string
+	for _, p := range problems {
+		paths = append(paths, p.Path)
+	}
+	sort.Strings(paths)
+	want := []string{"$.allowed_commands", "$.api_token", "$.tls.self_signed", "$.token"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("got problems at %v, want %v", paths, want)
+	}
+	for _, p := range problems {
+		if p.Path == "$.token" && !strings.Contains(p.Message, `"api_token"`) {
+			t.Errorf("unknown key %q should suggest api_token, got %q", p.Path, p.Message)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*Config)
+		path string
+	}{
+		{"short token", func(c *Config) { c.APIToken = "short" }, "$.api_token"},
+		{"banned command", func(c *Config) { c.AllowedCmds = []string{"go", "reg"} }, "$.allowed_commands[1]"},
+		{"command with path", func(c *Config) { c.AllowedCmds = []string{"/usr/bin/go"} }, "$.allowed_commands[0]"},
+		{"relative path", func(c *Config) { c.AllowedPaths = []string{"dev"} }, "$.allowed_paths[0]"},
+		{"port range", func(c *Config) { c.Port = 70000 }, "$.port"},
+		{"open bind", func(c *Config) { c.Bind = "0.0.0.0"; c.TLS = TLSConfig{} }, "$.bind"},
+		{"bad client", func(c *Config) { c.AllowedClients = []string{"nope"} }, "$.allowed_clients"},
+		{"grace range", func(c *Config) { c.ShutdownGrace = 4000 }, "$.shutdown_grace_seconds"},
+		{"listen network", func(c *Config) { c.Listen.Network = "udp" }, "$.listen.network"},
+		{"half key pair", func(c *Config) { c.TLS = TLSConfig{CertFile: "cert.pem"} }, "$.tls.key_file"},
+		{"sample ratio", func(c *Config) { c.Tracing.SampleRatio = 2 }, "$.tracing.sample_ratio"},
+	}
+
+	for _, tt := range tests {
+		cfg := fullConfig()
+		tt.edit(cfg)
+		err := ValidateConfig(*cfg)
+		var problems ConfigErrors
+		if !errors.As(err, &problems) {
+			t.Errorf("%s: expected ConfigErrors, got %v", tt.name, err)
+			continue
+		}
+		found := false
+		for _, p := range problems {
+			found = found || p.Path == tt.path
+		}
+		if !found {
+			t.Errorf("%s: no problem reported at %s: %v", tt.name, tt.path, problems)
+		}
+	}
+}
+
+// The embedded JSON Schema must describe exactly the fields of Config, so
+// editors and the strict decoder agree.
+func TestSchemaMatchesConfig(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(ConfigSchema, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	compareSchema(t, "$", schema, reflect.TypeOf(Config{}))
+}
+
+func compareSchema(t *testing.T, path string, schema map[string]interface{}, typ reflect.Type) {
+	props, _ := schema["properties"].(map[string]interface{})
+	if schema["additionalProperties"] != false {
+		t.Errorf("%s: schema must set additionalProperties to false", path)
+	}
+
+	fields := map[string]reflect.Type{}
+	for i := 0; i < typ.NumField(); i++ {
+		name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		fields[name] = typ.Field(i).Type
+	}
+
+	for name, ft := range fields {
+		p, ok := props[name].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s.%s: field missing from the schema", path, name)
+			continue
+		}
+		if ft.Kind() == reflect.Struct {
+			compareSchema(t, path+"."+name, p, ft)
+		}
+	}
+	for name := range props {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("%s.%s: schema property has no Config field", path, name)
+		}
+	}
+}
+
+func TestRestartChanges(t *testing.T) {
+	fields := map[string]bool{}
+	typ := reflect.TypeOf(Config{})
+	for i := 0; i < typ.NumField(); i++ {
+		fields[strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]] = true
+	}
+	for _, name := range RestartOnlyFields {
+		if !fields[name] {
+			t.Errorf("RestartOnlyFields names %q, which is not a config field", name)
+		}
+	}
+
+	running := DefaultConfig()
+	next := running
+	next.AllowedPaths = []string{"/elsewhere"}
+	next.Files.MaxFileMB = 7
+	if got := RestartChanges(running, next); len(got) != 0 {
+		t.Errorf("reloadable changes: RestartChanges = %v, want none", got)
+	}
+	next.Port = 9000
+	next.TLS.SelfSigned = true
+	next.Tracing.Headers = map[string]string{"k": "v"}
+	if got, want := strings.Join(RestartChanges(running, next), ","), "port,tls,tracing"; got != want {
+		t.Errorf("RestartChanges = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,22 @@
+package api
+
+var defaultAllowedCmds = []string{
+	"go", "clang", "clang++", "gcc", "g++", "make", "cmake",
+	"xcodebuild", "swift", "npm", "node", "python3", "pip3",
+}
+
+var defaultAllowedPaths = []string{
+	"/Users/*/Projects",
+	"/Users/*/Developer",
+	"/Users/*/src",
+}
+
+const (
+	defaultLogFile    = "logs/log.txt"
+	defaultSocketPath = "/var/run/devproxy.sock"
+	defaultPipePath   = ""
+)
+
+func listenNetworkSupported(network string) bool {
+	return network == "unix"
+}
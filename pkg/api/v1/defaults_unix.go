@@ -0,0 +1,24 @@
+//go:build !windows && !darwin
+
+package api
+
+var defaultAllowedCmds = []string{
+	"go", "gcc", "g++", "make", "cmake",
+	"npm", "node", "python3", "pip3", "dotnet",
+}
+
+var defaultAllowedPaths = []string{
+	"/home/*/Projects",
+	"/home/*/src",
+	"/srv/dev",
+}
+
+const (
+	defaultLogFile    = "logs/log.txt"
+	defaultSocketPath = "/run/devproxy/devproxy.sock"
+	defaultPipePath   = ""
+)
+
+func listenNetworkSupported(network string) bool {
+	return network == "unix"
+}
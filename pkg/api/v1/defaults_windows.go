@@ -0,0 +1,23 @@
+package api
+
+var defaultAllowedCmds = []string{
+	"go", "msbuild", "signtool", "powershell",
+	"dotnet", "gcc", "g++", "make", "cmake",
+	"npm", "node", "python", "pip",
+}
+
+var defaultAllowedPaths = []string{
+	"C:\\Dev",
+	"C:\\Users\\*\\Projects",
+	"C:\\Users\\*\\source\\repos",
+}
+
+const (
+	defaultLogFile    = "logs\\log.txt"
+	defaultSocketPath = ""
+	defaultPipePath   = `\\.\pipe\devproxy`
+)
+
+func listenNetworkSupported(network string) bool {
+	return network == "pipe"
+}
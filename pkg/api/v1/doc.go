@@ -0,0 +1,11 @@
+// Package api defines version 1 of the DevProxy API: the request and
+// response types exchanged over HTTP, the audit log format, and the server
+// config with its defaults, JSON Schema and validation. The server, the
+// client library, devctl and the tray all use these definitions.
+//
+// Fields may be added to these types in a compatible way; renaming or
+// removing one, or changing its meaning, requires a new API version.
+package api
+
+// Version is the API version implemented by this package.
+const Version = "v1"
@@ -0,0 +1,38 @@
+package api
+
+// ErrorResponse is the body of every error response. Code is stable and
+// meant for programs; Message is for people and may change. Details, when
+// present, depends on the code: for invalid_config it is the list of
+// ConfigProblems.
+type ErrorResponse struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// Error codes returned in ErrorResponse.Code.
+const (
+	CodeInvalidRequest    = "invalid_request"    // 400: the body could not be decoded, or a file was given for a directory or the reverse
+	CodeUnauthorized      = "unauthorized"       // 401: missing or wrong token and no client certificate
+	CodeClientNotAllowed  = "client_not_allowed" // 403: the client address is not in allowed_clients
+	CodePolicyViolation   = "policy_violation"   // 403: the command, directory or arguments are not allowed
+	CodeNotFound          = "not_found"          // 404: no such endpoint
+	CodeFileNotFound      = "file_not_found"     // 404: the file or directory does not exist
+	CodeUploadNotFound    = "upload_not_found"   // 404: no such upload, or it expired
+	CodeMethodNotAllowed  = "method_not_allowed" // 405
+	CodeFileExists        = "file_exists"        // 409: the destination already exists
+	CodeOffsetMismatch    = "offset_mismatch"    // 409: a chunk does not start where the upload left off; details is the Upload
+	CodeUploadIncomplete  = "upload_incomplete"  // 409: an upload was committed before all of it arrived
+	CodePatchFailed       = "patch_failed"       // 409: a patch did not apply; details is the PatchResponse
+	CodeHashMismatch      = "hash_mismatch"      // 412: the file changed since expected_sha256 was taken
+	CodeTooLarge          = "too_large"          // 413: the file is over files.max_file_mb
+	CodeQuotaExceeded     = "quota_exceeded"     // 413: the client's unfinished uploads would exceed files.upload_quota_mb
+	CodeInvalidRange      = "invalid_range"      // 416: the Range header does not fit the file
+	CodeInvalidConfig     = "invalid_config"     // 422: a reload found problems in the config
+	CodeChecksumMismatch  = "checksum_mismatch"  // 422: the uploaded data does not have the announced SHA-256
+	CodeTooManyWatches    = "too_many_watches"   // 429: files.max_watches watches are already running
+	CodeIOError           = "io_error"           // 500: the file operation failed on the server
+	CodeReloadUnavailable = "reload_unavailable" // 501: the server has no config source
+	CodeQueueFull         = "queue_full"         // 503: too many runs waiting; retry later
+	CodeShuttingDown      = "shutting_down"      // 503: the server is stopping
+)
@@ -0,0 +1,193 @@
+package api
+
+// FileInfo describes a file or directory. Path is absolute and in the
+// server's form (e.g. C:\Dev\app\main.go on Windows). SHA256 is only set
+// where an endpoint says so.
+type FileInfo struct {
+	Path      string `json:"path"`
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	Mode      string `json:"mode"`
+	ModTime   string `json:"mod_time"`
+	IsDir     bool   `json:"is_dir"`
+	IsSymlink bool   `json:"is_symlink,omitempty"`
+	SHA256    string `json:"sha256,omitempty"`
+}
+
+// ListResponse is returned by GET /files/list, entries sorted by name.
+type ListResponse struct {
+	Path    string     `json:"path"`
+	Entries []FileInfo `json:"entries"`
+}
+
+// MkdirRequest is the body of POST /files/mkdir. With Parents, missing
+// parent directories are created and an existing directory is not an
+// error, like mkdir -p.
+type MkdirRequest struct {
+	Path    string `json:"path"`
+	Parents bool   `json:"parents,omitempty"`
+}
+
+// MoveRequest is the body of POST /files/move. Both paths must be allowed.
+// An existing destination is only replaced with Overwrite, and never when
+// it is a directory.
+type MoveRequest struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+// DeleteRequest is the body of POST /files/delete. A non-empty directory
+// is only removed with Recursive.
+type DeleteRequest struct {
+	Path      string `json:"path"`
+	Recursive bool   `json:"recursive,omitempty"`
+}
+
+// UploadRequest is the body of POST /files/uploads, which starts a
+// resumable upload of Size bytes to Path. SHA256, if set, is verified when
+// the upload is committed; starting an upload with the same Path, Size and
+// SHA256 as an unfinished one resumes it instead. ExpectedSHA256, Parents
+// and ModTime mean the same as for /files/write.
+type UploadRequest struct {
+	Path           string `json:"path"`
+	Size           int64  `json:"size"`
+	SHA256         string `json:"sha256,omitempty"`
+	ExpectedSHA256 string `json:"expected_sha256,omitempty"`
+	Parents        bool   `json:"parents,omitempty"`
+	ModTime        string `json:"mod_time,omitempty"`
+}
+
+// Upload is the state of an upload session. The next chunk must start at
+// offset Received.
+type Upload struct {
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	Received  int64  `json:"received"`
+	SHA256    string `json:"sha256,omitempty"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+const (
+	defaultMaxFileMB         = 1024
+	defaultUploadQuotaMB     = 4096
+	defaultUploadTTLMinutes  = 60
+	defaultArchiveMaxMB      = 4096
+	defaultArchiveMaxEntries = 100000
+	defaultWatchIntervalMS   = 500
+	defaultMaxWatches        = 16
+)
+
+// FilesConfig limits what the /files endpoints accept.
+type FilesConfig struct {
+	// MaxFileMB is the largest file a write or upload may create.
+	MaxFileMB int `json:"max_file_mb,omitempty"`
+	// UploadQuotaMB bounds the total size of the unfinished uploads of
+	// each client, identified by its certificate or else its token.
+	UploadQuotaMB int `json:"upload_quota_mb,omitempty"`
+	// UploadTTLMinutes is how long an upload may sit idle before it is
+	// discarded.
+	UploadTTLMinutes int `json:"upload_ttl_minutes,omitempty"`
+	// ArchiveMaxMB bounds the total unpacked size of an extracted
+	// archive.
+	ArchiveMaxMB int `json:"archive_max_mb,omitempty"`
+	// ArchiveMaxEntries bounds the number of entries an archive that is
+	// created or extracted may have.
+	ArchiveMaxEntries int `json:"archive_max_entries,omitempty"`
+	// WatchIntervalMS is how often a watch scans its tree for changes.
+	WatchIntervalMS int `json:"watch_interval_ms,omitempty"`
+	// MaxWatches bounds the watches running at once, and the watch
+	// cursors kept for clients that poll.
+	MaxWatches int `json:"max_watches,omitempty"`
+}
+
+func applyFilesDefaults(fc *FilesConfig) {
+	if fc.MaxFileMB <= 0 {
+		fc.MaxFileMB = defaultMaxFileMB
+	}
+	if fc.UploadQuotaMB <= 0 {
+		fc.UploadQuotaMB = defaultUploadQuotaMB
+	}
+	if fc.UploadTTLMinutes <= 0 {
+		fc.UploadTTLMinutes = defaultUploadTTLMinutes
+	}
+	if fc.ArchiveMaxMB <= 0 {
+		fc.ArchiveMaxMB = defaultArchiveMaxMB
+	}
+	if fc.ArchiveMaxEntries <= 0 {
+		fc.ArchiveMaxEntries = defaultArchiveMaxEntries
+	}
+	if fc.WatchIntervalMS <= 0 {
+		fc.WatchIntervalMS = defaultWatchIntervalMS
+	}
+	if fc.MaxWatches <= 0 {
+		fc.MaxWatches = defaultMaxWatches
+	}
+}
+
+func validateFilesConfig(fc FilesConfig, problems *ConfigErrors) {
+	if fc.MaxFileMB < 0 || fc.MaxFileMB > 1<<20 {
+		problems.Add("$.files.max_file_mb", "must be between 1 and 1048576, or 0 for the default (got %d)", fc.MaxFileMB)
+	}
+	if fc.UploadQuotaMB < 0 || fc.UploadQuotaMB > 1<<24 {
+		problems.Add("$.files.upload_quota_mb", "must be between 1 and 16777216, or 0 for the default (got %d)", fc.UploadQuotaMB)
+	}
+	if fc.UploadTTLMinutes < 0 || fc.UploadTTLMinutes > 7*24*60 {
+		problems.Add("$.files.upload_ttl_minutes", "must be between 1 and 10080, or 0 for the default (got %d)", fc.UploadTTLMinutes)
+	}
+	if fc.ArchiveMaxMB < 0 || fc.ArchiveMaxMB > 1<<24 {
+		problems.Add("$.files.archive_max_mb", "must be between 1 and 16777216, or 0 for the default (got %d)", fc.ArchiveMaxMB)
+	}
+	if fc.ArchiveMaxEntries < 0 || fc.ArchiveMaxEntries > 10000000 {
+		problems.Add("$.files.archive_max_entries", "must be between 1 and 10000000, or 0 for the default (got %d)", fc.ArchiveMaxEntries)
+	}
+	if fc.WatchIntervalMS < 0 || (fc.WatchIntervalMS > 0 && fc.WatchIntervalMS < 100) || fc.WatchIntervalMS > 60000 {
+		problems.Add("$.files.watch_interval_ms", "must be between 100 and 60000, or 0 for the default (got %d)", fc.WatchIntervalMS)
+	}
+	if fc.MaxWatches < 0 || fc.MaxWatches > 1024 {
+		problems.Add("$.files.max_watches", "must be between 1 and 1024, or 0 for the default (got %d)", fc.MaxWatches)
+	}
+}
+
+// Archive formats for ArchiveRequest and ExtractRequest.
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// ArchiveRequest is the body of POST /files/archive, which packs Path, a
+// directory or a file, into a new archive file Dest. Format is ArchiveZip
+// or ArchiveTarGz; if empty, it follows Dest's extension (.zip, .tar.gz or
+// .tgz). Entries are named relative to Path, and a single file under its
+// base name. Exclude works as for manifests, and symlinks are left out. An
+// existing Dest is only replaced with Overwrite.
+type ArchiveRequest struct {
+	Path      string   `json:"path"`
+	Dest      string   `json:"dest"`
+	Format    string   `json:"format,omitempty"`
+	Exclude   []string `json:"exclude,omitempty"`
+	Overwrite bool     `json:"overwrite,omitempty"`
+}
+
+// ExtractRequest is the body of POST /files/extract, which unpacks the
+// archive Path into the directory Dest, creating it if needed. Format is
+// as for ArchiveRequest, following Path's extension if empty. Existing
+// files are only replaced with Overwrite.
+type ExtractRequest struct {
+	Path      string `json:"path"`
+	Dest      string `json:"dest"`
+	Format    string `json:"format,omitempty"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+// ExtractResponse is returned by POST /files/extract. Skipped lists the
+// entries that were not unpacked because they are not regular files or
+// directories, such as symlinks.
+type ExtractResponse struct {
+	Path    string   `json:"path"`
+	Files   int      `json:"files"`
+	Dirs    int      `json:"dirs"`
+	Bytes   int64    `json:"bytes"`
+	Skipped []string `json:"skipped,omitempty"`
+}
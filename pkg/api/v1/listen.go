@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ListenConfig selects the transport the API is served on. TCP is reachable
+// by every local user; a Unix domain socket or Windows named pipe lets the
+// operating system restrict who may connect.
+type ListenConfig struct {
+	// Network is "tcp" (default), "unix" or "pipe" (Windows only).
+	Network string `json:"network,omitempty"`
+	// Path is the socket file or pipe name, e.g. /run/devproxy/devproxy.sock
+	// or \\.\pipe\devproxy. Defaults per platform.
+	Path string `json:"path,omitempty"`
+	// Mode is the octal file mode of a Unix socket. Defaults to 0660.
+	Mode string `json:"mode,omitempty"`
+	// Owner and Group set the Unix socket's ownership (name or numeric ID).
+	Owner string `json:"owner,omitempty"`
+	Group string `json:"group,omitempty"`
+	// AllowedUsers may connect, by name or numeric ID (Unix) or account
+	// name (Windows). On Unix this is enforced with peer credentials; on
+	// Windows it becomes the pipe's ACL. When empty, only the server's own
+	// account and root/Administrators are allowed.
+	AllowedUsers []string `json:"allowed_users,omitempty"`
+}
+
+// DefaultSocketMode is the file mode of a Unix socket without listen.mode.
+const DefaultSocketMode = 0660
+
+// validateListenConfig checks the listen section of a config.
+func validateListenConfig(lc ListenConfig, problems *ConfigErrors) {
+	switch lc.Network {
+	case "", "tcp":
+		return
+	case "unix", "pipe":
+		if !listenNetworkSupported(lc.Network) {
+			problems.Add("$.listen.network", "%q is not supported on this platform", lc.Network)
+			return
+		}
+	default:
+		problems.Add("$.listen.network", "must be \"tcp\", \"unix\" or \"pipe\" (got %q)", lc.Network)
+		return
+	}
+
+	if lc.Network == "pipe" && !strings.HasPrefix(strings.ToLower(lc.Path), `\\.\pipe\`) {
+		problems.Add("$.listen.path", `must start with \\.\pipe\ (got %q)`, lc.Path)
+	}
+	if lc.Network == "unix" && !filepath.IsAbs(lc.Path) {
+		problems.Add("$.listen.path", "must be an absolute path (got %q)", lc.Path)
+	}
+	if lc.Mode != "" {
+		if m, err := strconv.ParseUint(lc.Mode, 8, 32); err != nil || m > 0777 {
+			problems.Add("$.listen.mode", "must be an octal file mode such as 0660 (got %q)", lc.Mode)
+		} else if m&0007 != 0 {
+			problems.Add("$.listen.mode", "must not grant access to other users (got %s)", lc.Mode)
+		}
+	}
+	for i, u := range lc.AllowedUsers {
+		if u == "" {
+			problems.Add(fmt.Sprintf("$.listen.allowed_users[%d]", i), "must not be empty")
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ResolveBindHost turns the bind setting into a host to listen on. bind may
+// be an IP address, "localhost", or a network interface name such as eth0
+// or "vEthernet (WSL)", in which case the interface's first address is used
+// (IPv4 preferred).
+func ResolveBindHost(bind string) (string, error) {
+	if bind == "" || strings.EqualFold(bind, "localhost") || net.ParseIP(bind) != nil {
+		return bind, nil
+	}
+
+	iface, err := net.InterfaceByName(bind)
+	if err != nil {
+		return "", fmt.Errorf("%q is neither an IP address nor a network interface", bind)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	var fallback string
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			return ipnet.IP.String(), nil
+		}
+		if fallback == "" && !ipnet.IP.IsLinkLocalUnicast() {
+			fallback = ipnet.IP.String()
+		}
+	}
+	if fallback == "" {
+		return "", fmt.Errorf("interface %q has no usable address", bind)
+	}
+	return fallback, nil
+}
+
+// ParseClientNets parses allowed_clients entries, each a CIDR such as
+// 172.16.0.0/12 or a single IP address.
+func ParseClientNets(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, e := range entries {
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address or CIDR", e)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR", e)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// validateBind checks that a non-loopback bind is an explicit, protected
+// choice: it needs TLS, a token (always required) and a client allowlist.
+func validateBind(cfg Config, problems *ConfigErrors) {
+	if _, err := ParseClientNets(cfg.AllowedClients); err != nil {
+		problems.Add("$.allowed_clients", "%v", err)
+	}
+
+	if cfg.Listen.Network != "" && cfg.Listen.Network != "tcp" {
+		return
+	}
+	host, err := ResolveBindHost(cfg.Bind)
+	if err != nil {
+		problems.Add("$.bind", "%v", err)
+		return
+	}
+	if IsLoopbackHost(host) {
+		return
+	}
+
+	if !cfg.TLS.Enabled() {
+		problems.Add("$.bind", "non-loopback address %q requires TLS; set tls.cert_file and tls.key_file, or tls.self_signed", cfg.Bind)
+	}
+	if len(cfg.AllowedClients) == 0 {
+		problems.Add("$.allowed_clients", "must list the client networks allowed to connect when bind is %q", cfg.Bind)
+	}
+}
+
+// IsLoopbackHost reports whether host is "localhost" or a loopback IP.
+func IsLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParseClientNets(t *testing.T) {
+	nets, err := ParseClientNets([]string{"10.0.0.0/8", "192.168.1.7", "fd00::/8", "2001:db8::1", "::ffff:172.16.0.0/108"})
+	if err != nil {
+		t.Fatalf("ParseClientNets: %v", err)
+	}
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"::ffff:10.1.2.3", true},
+		{"11.0.0.1", false},
+		{"192.168.1.7", true},
+		{"::ffff:192.168.1.7", true},
+		{"192.168.1.8", false},
+		{"fd12::1", true},
+		{"fe80::1", false},
+		{"2001:db8::1", true},
+		{"2001:db8::2", false},
+		{"172.16.5.5", true},
+		{"172.31.0.1", true},
+		{"172.32.0.1", false},
+	}
+	for _, tt := range tests {
+		ip := net.ParseIP(tt.ip)
+		got := false
+		for _, n := range nets {
+			got = got || n.Contains(ip)
+		}
+		if got != tt.want {
+			t.Errorf("%s allowed = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"nope", "10.0.0.0/33", "10.0.0", "10.0.0.0/", "", "host.example.com", "::1/129"} {
+		if _, err := ParseClientNets([]string{"10.0.0.0/8", bad}); err == nil {
+			t.Errorf("ParseClientNets accepted %q", bad)
+		}
+	}
+	if nets, err := ParseClientNets(nil); err != nil || len(nets) != 0 {
+		t.Errorf("ParseClientNets(nil) = %v, %v", nets, err)
+	}
+}
+
+func TestValidateBind(t *testing.T) {
+	tls := TLSConfig{SelfSigned: true}
+	clients := []string{"10.0.0.0/8"}
+	tests := []struct {
+		name     string
+		bind     string
+		tls      TLSConfig
+		clients  []string
+		network  string
+		problems []string
+	}{
+		{"loopback v4", "127.0.0.1", TLSConfig{}, nil, "", nil},
+		{"loopback v6", "::1", TLSConfig{}, nil, "", nil},
+		{"localhost", "localhost", TLSConfig{}, nil, "", nil},
+		{"open without tls or clients", "0.0.0.0", TLSConfig{}, nil, "", []string{"$.bind", "$.allowed_clients"}},
+		{"open without clients", "0.0.0.0", tls, nil, "", []string{"$.allowed_clients"}},
+		{"open without tls", "0.0.0.0", TLSConfig{}, clients, "", []string{"$.bind"}},
+		{"open with tls and clients", "0.0.0.0", tls, clients, "", nil},
+		{"lan address opted in", "192.168.1.10", tls, clients, "", nil},
+		{"all v6", "::", TLSConfig{}, clients, "", []string{"$.bind"}},
+		{"unknown interface", "no-such-iface0", tls, clients, "", []string{"$.bind"}},
+		{"bad client entry", "127.0.0.1", TLSConfig{}, []string{"10.0.0.0/40"}, "", []string{"$.allowed_clients"}},
+		{"unix socket ignores bind", "0.0.0.0", TLSConfig{}, nil, "unix", nil},
+	}
+	for _, tt := range tests {
+		cfg := Config{Bind: tt.bind, TLS: tt.tls, AllowedClients: tt.clients, Listen: ListenConfig{Network: tt.network}}
+		var problems ConfigErrors
+		validateBind(cfg, &problems)
+		var got []string
+		for _, p := range problems {
+			got = append(got, p.Path)
+		}
+		if strings.Join(got, " ") != strings.Join(tt.problems, " ") {
+			t.Errorf("%s: problems at %v, want %v (%v)", tt.name, got, tt.problems, problems)
+		}
+	}
+}
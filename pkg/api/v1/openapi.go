@@ -0,0 +1,482 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Prefix is the path prefix of every version 1 endpoint, e.g. /v1/run.
+// Servers also answer on the unprefixed paths for clients that predate it.
+const Prefix = "/" + Version
+
+// Endpoint describes one API operation. The server registers its routes
+// from Endpoints and the OpenAPI document is generated from the same list,
+// so the two cannot drift apart.
+type Endpoint struct {
+	Method  string
+	Path    string // relative to Prefix
+	Summary string
+	// Auth requires X-Admin-Token or an accepted client certificate.
+	Auth bool
+	// Params are the path and query parameters.
+	Params []Param
+	// Request is a zero value of the JSON request body type, Binary, or
+	// nil.
+	Request interface{}
+	// Responses maps status codes to a zero value of the body type.
+	Responses map[int]interface{}
+	// Stream is the type of each line of an application/x-ndjson
+	// response for the 200 status, or nil.
+	Stream interface{}
+}
+
+// Param is a query parameter, or a path parameter when In is "path" and
+// the endpoint's Path contains {Name}. Type is a JSON Schema type: string,
+// integer or boolean.
+type Param struct {
+	Name        string
+	In          string
+	Type        string
+	Required    bool
+	Description string
+}
+
+// Binary, used as a request or response type in Endpoints, stands for a raw
+// application/octet-stream body.
+type Binary struct{}
+
+// pathParam is the query parameter every /files endpoint that acts on a
+// single file takes.
+var pathParam = Param{Name: "path", Type: "string", Required: true, Description: "Absolute path under one of the allowed paths."}
+
+// uploadParam identifies an upload session in /files/uploads/{id}.
+var uploadParam = Param{Name: "id", In: "path", Type: "string", Required: true, Description: "Upload ID returned when the upload was started."}
+
+// Endpoints lists every operation of API version 1.
+var Endpoints = []Endpoint{
+	{
+		Method:  http.MethodPost,
+		Path:    "/run",
+		Summary: "Run an allowed command in an allowed directory. Send Accept: application/x-ndjson to stream output as it is produced.",
+		Auth:    true,
+		Request: RunRequest{},
+		Responses: map[int]interface{}{
+			200: RunResponse{},
+			400: ErrorResponse{},
+			401: ErrorResponse{},
+			403: ErrorResponse{},
+			405: ErrorResponse{},
+			503: ErrorResponse{},
+		},
+		Stream: RunEvent{},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/healthz",
+		Summary:   "Liveness: succeeds whenever the server is up.",
+		Responses: map[int]interface{}{200: HealthResponse{}},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/readyz",
+		Summary:   "Readiness: config loaded, audit log writable and run queue not saturated.",
+		Responses: map[int]interface{}{200: HealthResponse{}, 503: HealthResponse{}},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/version",
+		Summary:   "Build version, uptime and a summary of the effective configuration.",
+		Auth:      true,
+		Responses: map[int]interface{}{200: VersionResponse{}, 401: ErrorResponse{}},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/admin/reload",
+		Summary: "Re-read the config and apply it if valid.",
+		Auth:    true,
+		Responses: map[int]interface{}{
+			200: ReloadResponse{},
+			401: ErrorResponse{},
+			405: ErrorResponse{},
+			422: ErrorResponse{},
+			501: ErrorResponse{},
+		},
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/files/stat",
+		Summary:   "Describe a file or directory.",
+		Auth:      true,
+		Params:    []Param{pathParam, {Name: "hash", Type: "boolean", Description: "Also compute the SHA-256 of a file."}},
+		Responses: fileResponses(200, FileInfo{}),
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/files/list",
+		Summary:   "List a directory.",
+		Auth:      true,
+		Params:    []Param{pathParam},
+		Responses: fileResponses(200, ListResponse{}),
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/files/read",
+		Summary:   "Read a file. A Range header (bytes=start-end, bytes=start- or bytes=-suffix) reads part of it with status 206.",
+		Auth:      true,
+		Params:    []Param{pathParam},
+		Responses: fileResponses(200, Binary{}, 206, 416),
+	},
+	{
+		Method:  http.MethodPut,
+		Path:    "/files/write",
+		Summary: "Replace a file atomically with the request body. Returns the new file's info including its SHA-256.",
+		Auth:    true,
+		Params: []Param{
+			pathParam,
+			{Name: "expected_sha256", Type: "string", Description: "Only write if the file's current SHA-256 is this; \"absent\" requires that it does not exist yet."},
+			{Name: "parents", Type: "boolean", Description: "Create missing parent directories."},
+			{Name: "mod_time", Type: "string", Description: "Set the file's modification time (RFC 3339) instead of the time of the write."},
+		},
+		Request:   Binary{},
+		Responses: fileResponses(200, FileInfo{}, 412, 413),
+	},
+	{
+		Method:    http.MethodPost,
+		Path:      "/files/uploads",
+		Summary:   "Start, or resume, a resumable upload. Send the data with PUT /files/uploads/{id} and finish with POST /files/uploads/{id}/commit.",
+		Auth:      true,
+		Request:   UploadRequest{},
+		Responses: fileResponses(200, Upload{}, 412, 413),
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/files/uploads/{id}",
+		Summary:   "Report how much of an upload has arrived, to resume it after an interruption.",
+		Auth:      true,
+		Params:    []Param{uploadParam},
+		Responses: fileResponses(200, Upload{}),
+	},
+	{
+		Method:  http.MethodPut,
+		Path:    "/files/uploads/{id}",
+		Summary: "Append the request body to an upload. offset must equal the upload's received count.",
+		Auth:    true,
+		Params: []Param{
+			uploadParam,
+			{Name: "offset", Type: "integer", Required: true, Description: "Offset of the first byte of the body within the file."},
+		},
+		Request:   Binary{},
+		Responses: fileResponses(200, Upload{}, 409, 413),
+	},
+	{
+		Method:    http.MethodDelete,
+		Path:      "/files/uploads/{id}",
+		Summary:   "Abandon an upload and discard what arrived.",
+		Auth:      true,
+		Params:    []Param{uploadParam},
+		Responses: fileResponses(200, Upload{}),
+	},
+	{
+		Method:    http.MethodPost,
+		Path:      "/files/uploads/{id}/commit",
+		Summary:   "Verify a complete upload's size and SHA-256 and atomically move it into place.",
+		Auth:      true,
+		Params:    []Param{uploadParam},
+		Responses: fileResponses(200, FileInfo{}, 409, 412, 422),
+	},
+	{
+		Method:    http.MethodPost,
+		Path:      "/files/manifest",
+		Summary:   "Describe the files and directories under a directory, for comparing trees in a sync.",
+		Auth:      true,
+		Request:   ManifestRequest{},
+		Responses: fileResponses(200, ManifestResponse{}, 413),
+	},
+	{
+		Method:    http.MethodPost,
+		Path:      "/files/archive",
+		Summary:   "Pack a directory or file into a new zip or tar.gz archive. Returns the archive's info including its SHA-256.",
+		Auth:      true,
+		Request:   ArchiveRequest{},
+		Responses: fileResponses(200, FileInfo{}, 409, 413),
+	},
+	{
+		Method:    http.MethodPost,
+		Path:      "/files/extract",
+		Summary:   "Unpack a zip or tar.gz archive into a directory. Every entry must stay inside it and pass the path policy.",
+		Auth:      true,
+		Request:   ExtractRequest{},
+		Responses: fileResponses(200, ExtractResponse{}, 409, 413),
+	},
+	{
+		Method:    http.MethodPost,
+		Path:      "/files/patch",
+		Summary:   "Apply a unified diff to files under a directory, all or nothing. A patch that does not apply is a patch_failed error whose details say which hunks failed.",
+		Auth:      true,
+		Request:   PatchRequest{},
+		Responses: fileResponses(200, PatchResponse{}, 409, 412, 413),
+	},
+	{
+		Method:    http.MethodPost,
+		Path:      "/files/watch",
+		Summary:   "Report files and directories created, modified or deleted under a directory. Waits for a debounced batch of changes and returns it with a cursor for the next poll, or with Accept: application/x-ndjson streams one WatchEvent per line.",
+		Auth:      true,
+		Request:   WatchRequest{},
+		Responses: fileResponses(200, WatchResponse{}, 413, 429),
+		Stream:    WatchEvent{},
+	},
+	{
+		Method:    http.MethodPost,
+		Path:      "/files/search",
+		Summary:   "Find files under a directory by glob, or search their contents with a regular expression, skipping binary and .gitignore'd files.",
+		Auth:      true,
+		Request:   SearchRequest{},
+		Responses: fileResponses(200, SearchResponse{}),
+	},
+	{
+		Method:    http.MethodPost,
+		Path:      "/files/mkdir",
+		Summary:   "Create a directory.",
+		Auth:      true,
+		Request:   MkdirRequest{},
+		Responses: fileResponses(200, FileInfo{}, 409),
+	},
+	{
+		Method:    http.MethodPost,
+		Path:      "/files/move",
+		Summary:   "Move or rename a file or directory.",
+		Auth:      true,
+		Request:   MoveRequest{},
+		Responses: fileResponses(200, FileInfo{}, 409),
+	},
+	{
+		Method:    http.MethodPost,
+		Path:      "/files/delete",
+		Summary:   "Delete a file or directory. Returns what was deleted.",
+		Auth:      true,
+		Request:   DeleteRequest{},
+		Responses: fileResponses(200, FileInfo{}, 409),
+	},
+	{
+		Method:    http.MethodGet,
+		Path:      "/openapi.json",
+		Summary:   "This OpenAPI document.",
+		Responses: map[int]interface{}{200: map[string]interface{}{}},
+	},
+}
+
+// fileResponses returns the responses of a /files endpoint: ok with body,
+// the errors every one of them can return, and extra statuses (206 with
+// body, anything else with an ErrorResponse).
+func fileResponses(ok int, body interface{}, extra ...int) map[int]interface{} {
+	r := map[int]interface{}{
+		ok:  body,
+		400: ErrorResponse{},
+		401: ErrorResponse{},
+		403: ErrorResponse{},
+		404: ErrorResponse{},
+		405: ErrorResponse{},
+		500: ErrorResponse{},
+	}
+	for _, code := range extra {
+		if code == http.StatusPartialContent {
+			r[code] = body
+		} else {
+			r[code] = ErrorResponse{}
+		}
+	}
+	return r
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  []byte
+)
+
+// OpenAPI returns the OpenAPI 3.1 document for Endpoints. Schemas are
+// generated from the Go types by their JSON tags: fields without omitempty
+// are required.
+func OpenAPI() []byte {
+	openAPIOnce.Do(func() {
+		openAPIDoc, _ = json.MarshalIndent(buildOpenAPI(), "", "  ")
+	})
+	return openAPIDoc
+}
+
+type obj = map[string]interface{}
+
+func buildOpenAPI() obj {
+	g := &schemaGen{schemas: obj{}}
+	paths := obj{}
+
+	for _, ep := range Endpoints {
+		op := obj{
+			"summary":     ep.Summary,
+			"operationId": operationID(ep),
+		}
+		if ep.Auth {
+			op["security"] = []obj{{"adminToken": []string{}}, {"clientCertificate": []string{}}}
+		} else {
+			op["security"] = []obj{}
+		}
+		if len(ep.Params) > 0 {
+			var params []obj
+			for _, p := range ep.Params {
+				in := p.In
+				if in == "" {
+					in = "query"
+				}
+				params = append(params, obj{
+					"name":        p.Name,
+					"in":          in,
+					"required":    p.Required,
+					"description": p.Description,
+					"schema":      obj{"type": p.Type},
+				})
+			}
+			op["parameters"] = params
+		}
+		if ep.Request != nil {
+			op["requestBody"] = obj{
+				"required": true,
+				"content":  g.content(ep.Request),
+			}
+		}
+
+		responses := obj{}
+		for _, code := range sortedCodes(ep.Responses) {
+			content := g.content(ep.Responses[code])
+			if code == http.StatusOK && ep.Stream != nil {
+				content[StreamContentType] = obj{"schema": g.schema(reflect.TypeOf(ep.Stream))}
+			}
+			responses[strconv.Itoa(code)] = obj{
+				"description": http.StatusText(code),
+				"content":     content,
+			}
+		}
+		op["responses"] = responses
+
+		item, _ := paths[ep.Path].(obj)
+		if item == nil {
+			item = obj{}
+			paths[ep.Path] = item
+		}
+		item[strings.ToLower(ep.Method)] = op
+	}
+
+	return obj{
+		"openapi": "3.1.0",
+		"info": obj{
+			"title":   "DevProxy API",
+			"version": Version,
+		},
+		"servers": []obj{{"url": Prefix}},
+		"paths":   paths,
+		"components": obj{
+			"schemas": g.schemas,
+			"securitySchemes": obj{
+				"adminToken":        obj{"type": "apiKey", "in": "header", "name": "X-Admin-Token"},
+				"clientCertificate": obj{"type": "mutualTLS", "description": "A certificate whose common name is listed in tls.client_identities."},
+			},
+		},
+	}
+}
+
+// content returns the media types of a body of v's type.
+func (g *schemaGen) content(v interface{}) obj {
+	if _, ok := v.(Binary); ok {
+		return obj{"application/octet-stream": obj{"schema": obj{"type": "string", "format": "binary"}}}
+	}
+	return obj{"application/json": obj{"schema": g.schema(reflect.TypeOf(v))}}
+}
+
+func operationID(ep Endpoint) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(ep.Method))
+	for _, part := range strings.FieldsFunc(ep.Path, func(r rune) bool { return strings.ContainsRune("/._{}", r) }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func sortedCodes(m map[int]interface{}) []int {
+	codes := make([]int, 0, len(m))
+	for c := range m {
+		codes = append(codes, c)
+	}
+	sort.Ints(codes)
+	return codes
+}
+
+// schemaGen converts Go types to JSON Schema, collecting named structs
+// under components/schemas.
+type schemaGen struct {
+	schemas obj
+}
+
+func (g *schemaGen) schema(t reflect.Type) obj {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return obj{"type": "string"}
+	case reflect.Bool:
+		return obj{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return obj{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return obj{"type": "number"}
+	case reflect.Array:
+		return obj{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Slice:
+		// A nil slice encodes as null.
+		return obj{"type": []string{"array", "null"}, "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return obj{"type": []string{"object", "null"}, "additionalProperties": g.schema(t.Elem())}
+	case reflect.Interface:
+		return obj{}
+	case reflect.Struct:
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = obj{} // placeholder for recursive types
+			g.schemas[t.Name()] = g.structSchema(t)
+		}
+		return obj{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return obj{}
+}
+
+func (g *schemaGen) structSchema(t reflect.Type) obj {
+	props := obj{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		if tag[0] == "-" || !f.IsExported() {
+			continue
+		}
+		name := tag[0]
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schema(f.Type)
+		omitempty := false
+		for _, opt := range tag[1:] {
+			omitempty = omitempty || opt == "omitempty"
+		}
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+
+	s := obj{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func loadOpenAPI(t *testing.T) map[string]interface{} {
+	t.Helper()
+	var doc map[string]interface{}
+	if err := json.Unmarshal(OpenAPI(), &doc); err != nil {
+		t.Fatalf("OpenAPI() is not valid JSON: %v", err)
+	}
+	return doc
+}
+
+func TestOpenAPIDescribesEveryEndpoint(t *testing.T) {
+	doc := loadOpenAPI(t)
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("openapi = %v", doc["openapi"])
+	}
+	paths := doc["paths"].(map[string]interface{})
+
+	for _, ep := range Endpoints {
+		item, ok := paths[ep.Path].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s missing from paths", ep.Path)
+			continue
+		}
+		op, ok := item[strings.ToLower(ep.Method)].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s %s missing", ep.Method, ep.Path)
+			continue
+		}
+		responses := op["responses"].(map[string]interface{})
+		for code := range ep.Responses {
+			if _, ok := responses[strconv.Itoa(code)]; !ok {
+				t.Errorf("%s %s: response %d missing", ep.Method, ep.Path, code)
+			}
+		}
+		if _, ok := op["requestBody"]; ok != (ep.Request != nil) {
+			t.Errorf("%s %s: requestBody present = %v", ep.Method, ep.Path, ok)
+		}
+	}
+}
+
+func TestOpenAPIRefsResolve(t *testing.T) {
+	doc := loadOpenAPI(t)
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	var walk func(path string, v interface{})
+	walk = func(path string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				name := strings.TrimPrefix(ref, "#/components/schemas/")
+				if _, ok := schemas[name]; !ok {
+					t.Errorf("%s: unresolved $ref %q", path, ref)
+				}
+			}
+			for k, e := range v {
+				walk(path+"/"+k, e)
+			}
+		case []interface{}:
+			for i, e := range v {
+				walk(fmt.Sprintf("%s/%d", path, i), e)
+			}
+		}
+	}
+	walk("#", doc)
+}
+
+// TestOpenAPISchemasMatchWireTypes validates real values against the
+// generated schemas, so a field renamed or added to a wire type without the
+// document following would fail here.
+func TestOpenAPISchemasMatchWireTypes(t *testing.T) {
+	doc := loadOpenAPI(t)
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	values := map[string]interface{}{
+		"RunRequest":      RunRequest{Command: "go", Args: []string{"test"}, CWD: "/srv/dev"},
+		"RunResponse":     RunResponse{Stdout: "ok\n", ExitCode: 1},
+		"RunEvent":        RunEvent{Stream: "stdout", Data: "ok\n"},
+		"HealthResponse":  HealthResponse{Status: "ok", Checks: map[string]string{"config": "ok"}},
+		"VersionResponse": VersionResponse{Version: "v1", Config: ConfigSummary{Port: 2223, AllowedCmds: []string{"go"}}},
+		"ReloadResponse":  ReloadResponse{Status: "reloaded", Changes: []string{"allowed_cmds: +npm"}},
+		"FileInfo":        FileInfo{Path: "/srv/dev/a", Name: "a", Size: 1, Mode: "-rw-r--r--", ModTime: "2026-01-02T03:04:05Z"},
+		"ListResponse":    ListResponse{Path: "/srv/dev"},
+		"DeleteRequest":   DeleteRequest{Path: "/srv/dev/a", Recursive: true},
+		"ManifestResponse": ManifestResponse{Path: "/srv/dev", Entries: []ManifestEntry{
+			{Path: "src", ModTime: "2026-01-02T03:04:05Z", IsDir: true},
+			{Path: "src/main.go", Size: 12, ModTime: "2026-01-02T03:04:05.5Z", SHA256: "9f86d0"},
+		}},
+		"PatchResponse": PatchResponse{Root: "/srv/dev", Applied: true, Files: []PatchFile{
+			{Path: "/srv/dev/a.go", Op: PatchModify, SHA256: "9f86d0", Hunks: []PatchHunk{{Hunk: 1, Applied: true, Line: 12, Offset: 2, Fuzz: 1}}},
+			{Path: "/srv/dev/b.go", OldPath: "/srv/dev/c.go", Op: PatchRename, Error: "1 of 1 hunks do not apply", Hunks: []PatchHunk{{Hunk: 1, Error: "no match"}}},
+		}},
+		"WatchResponse": WatchResponse{Path: "/srv/dev", Cursor: "c0ffee", Reset: true, Events: []WatchEvent{
+			{Type: WatchCreate, Path: "bin", IsDir: true, ModTime: "2026-01-02T03:04:05Z"},
+			{Type: WatchModify, Path: "bin/app", Size: 1024, ModTime: "2026-01-02T03:04:05.5Z"},
+			{Type: WatchDelete, Path: "obj/app.o"},
+		}},
+		"SearchResponse": SearchResponse{Path: "/srv/dev", Files: []string{"main.go"}, Searched: 2, Skipped: 1, Truncated: true, Matches: []SearchMatch{
+			{Path: "main.go", Line: 3, Column: 6, Text: "func main() {", Before: []string{""}, After: []string{"}"}},
+		}},
+		"ErrorResponse": ErrorResponse{Code: CodeInvalidConfig, Message: "bad", Details: ConfigErrors{{Path: "port", Message: "out of range"}}},
+	}
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, _ := json.Marshal(values[name])
+		var v interface{}
+		json.Unmarshal(data, &v)
+		for _, err := range validate(schemas, map[string]interface{}{"$ref": "#/components/schemas/" + name}, v, name) {
+			t.Error(err)
+		}
+	}
+}
+
+// validate checks the subset of JSON Schema the generator emits: $ref, type
+// (possibly nullable), properties, required, items and additionalProperties.
+// Undeclared properties are reported too.
+func validate(schemas, schema map[string]interface{}, v interface{}, path string) []error {
+	if ref, ok := schema["$ref"].(string); ok {
+		target, _ := schemas[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{})
+		if target == nil {
+			return []error{fmt.Errorf("%s: unresolved $ref %q", path, ref)}
+		}
+		return validate(schemas, target, v, path)
+	}
+
+	typ := schema["type"]
+	if types, ok := typ.([]interface{}); ok {
+		// Only ["<type>", "null"] is generated.
+		if v == nil {
+			return nil
+		}
+		typ = types[0]
+	}
+
+	var errs []error
+	switch typ {
+	case nil:
+		return nil
+	case "string":
+		if _, ok := v.(string); !ok {
+			errs = append(errs, fmt.Errorf("%s: want string, got %T", path, v))
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			errs = append(errs, fmt.Errorf("%s: want boolean, got %T", path, v))
+		}
+	case "integer", "number":
+		if _, ok := v.(float64); !ok {
+			errs = append(errs, fmt.Errorf("%s: want number, got %T", path, v))
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			return append(errs, fmt.Errorf("%s: want array, got %T", path, v))
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		for i, e := range arr {
+			errs = append(errs, validate(schemas, items, e, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case "object":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return append(errs, fmt.Errorf("%s: want object, got %T", path, v))
+		}
+		if req, ok := schema["required"].([]interface{}); ok {
+			for _, name := range req {
+				if _, ok := m[name.(string)]; !ok {
+					errs = append(errs, fmt.Errorf("%s: missing required %q", path, name))
+				}
+			}
+		}
+		props, hasProps := schema["properties"].(map[string]interface{})
+		extra, _ := schema["additionalProperties"].(map[string]interface{})
+		for k, e := range m {
+			if p, ok := props[k].(map[string]interface{}); ok {
+				errs = append(errs, validate(schemas, p, e, path+"."+k)...)
+			} else if extra != nil {
+				errs = append(errs, validate(schemas, extra, e, path+"."+k)...)
+			} else if hasProps {
+				errs = append(errs, fmt.Errorf("%s: undeclared property %q", path, k))
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,68 @@
+package api
+
+// PatchRequest is the body of POST /files/patch, which applies Diff, a
+// unified diff of one or more files as written by diff -u or git diff, to
+// the files under the directory Root.
+//
+// File names in the diff are relative to Root. Strip removes that many
+// leading path components, like patch -p; when it is 0 and the names carry
+// git's a/ and b/ prefixes, those are removed. Hunks may apply at an
+// offset from the line numbers in their headers; Fuzz is how many context
+// lines at the start and end of a hunk may be ignored to make it apply (0,
+// the default, requires all of them to match). Context lines match
+// regardless of CRLF or LF line endings, and changed files keep theirs.
+//
+// Nothing is changed unless every hunk of every file applies. With DryRun
+// nothing is changed either way, and the response tells how the patch
+// would apply.
+type PatchRequest struct {
+	Root   string `json:"root"`
+	Diff   string `json:"diff"`
+	Strip  int    `json:"strip,omitempty"`
+	Fuzz   int    `json:"fuzz,omitempty"`
+	DryRun bool   `json:"dry_run,omitempty"`
+}
+
+// PatchResponse describes how a patch applied, or, as the details of a
+// patch_failed error, why it did not.
+type PatchResponse struct {
+	Root    string      `json:"root"`
+	DryRun  bool        `json:"dry_run,omitempty"`
+	Applied bool        `json:"applied"`
+	Files   []PatchFile `json:"files"`
+}
+
+// Patch operations on a file.
+const (
+	PatchModify = "modify"
+	PatchCreate = "create"
+	PatchDelete = "delete"
+	PatchRename = "rename"
+)
+
+// PatchFile is the outcome for one file of a patch. Path is the absolute
+// path on the server; OldPath is only set for a rename. SHA256 is the new
+// contents' hash, unless the file is deleted. Error is set when the file as
+// a whole failed, e.g. because it does not exist.
+type PatchFile struct {
+	Path    string      `json:"path"`
+	OldPath string      `json:"old_path,omitempty"`
+	Op      string      `json:"op"`
+	Hunks   []PatchHunk `json:"hunks"`
+	SHA256  string      `json:"sha256,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// PatchHunk is the outcome of one hunk, numbered from 1 within its file.
+// Line is the line of the original file where the hunk applied, Offset how
+// far that is from where its header said, and Fuzz how many context lines
+// were ignored at each end. A hunk that did not apply has Applied false and
+// an Error saying why.
+type PatchHunk struct {
+	Hunk    int    `json:"hunk"`
+	Applied bool   `json:"applied"`
+	Line    int    `json:"line,omitempty"`
+	Offset  int    `json:"offset,omitempty"`
+	Fuzz    int    `json:"fuzz,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
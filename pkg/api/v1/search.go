@@ -0,0 +1,54 @@
+package api
+
+// SearchRequest is the body of POST /files/search, which finds files under
+// Path, a directory or a single file, and searches their contents.
+//
+// Include, if set, limits the search to files matching one of its
+// patterns, and Exclude leaves paths out; both match as described for
+// Excluded. Unless NoIgnore is set, paths ignored by .gitignore files, in
+// Path and in its parents up to the repository's root, are skipped too, as
+// is the .git directory.
+//
+// Without Pattern, the response lists the matching files. With it, each
+// file is searched line by line for the regular expression (RE2 syntax; a
+// plain string with Literal), and every matching line is returned with up
+// to Context lines around it. Binary files, detected by a NUL byte near the
+// start, are skipped. MaxResults (default 1000, at most 100000) bounds the
+// files or matches returned.
+type SearchRequest struct {
+	Path       string   `json:"path"`
+	Pattern    string   `json:"pattern,omitempty"`
+	Literal    bool     `json:"literal,omitempty"`
+	IgnoreCase bool     `json:"ignore_case,omitempty"`
+	Include    []string `json:"include,omitempty"`
+	Exclude    []string `json:"exclude,omitempty"`
+	NoIgnore   bool     `json:"no_ignore,omitempty"`
+	Context    int      `json:"context,omitempty"`
+	MaxResults int      `json:"max_results,omitempty"`
+}
+
+// SearchMatch is a line matching a search. Path is relative to the
+// searched directory and uses forward slashes. Line and Column count from
+// 1, Column in bytes. Text and the context lines are without their line
+// endings, and cut short if very long.
+type SearchMatch struct {
+	Path   string   `json:"path"`
+	Line   int      `json:"line"`
+	Column int      `json:"column"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// SearchResponse is returned by POST /files/search. Files lists the files
+// matching Include or, for a content search, those with a match. Searched
+// counts the files read and Skipped the binary or oversized ones.
+// Truncated is set when MaxResults was reached.
+type SearchResponse struct {
+	Path      string        `json:"path"`
+	Files     []string      `json:"files"`
+	Matches   []SearchMatch `json:"matches"`
+	Searched  int           `json:"searched"`
+	Skipped   int           `json:"skipped"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ManifestRequest is the body of POST /files/manifest, which describes the
+// tree under Path for a sync. Entries matching an Exclude pattern (see
+// Excluded) are left out, and excluded directories are not descended into.
+// Paths, if set, limits the manifest to these entries, given relative to
+// Path with forward slashes; those that do not exist are left out. With
+// Hash, files include their SHA-256.
+type ManifestRequest struct {
+	Path    string   `json:"path"`
+	Exclude []string `json:"exclude,omitempty"`
+	Paths   []string `json:"paths,omitempty"`
+	Hash    bool     `json:"hash,omitempty"`
+}
+
+// ManifestEntry is a file or directory in a manifest. Path is relative to
+// the manifest's root and uses forward slashes on every platform.
+type ManifestEntry struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	ModTime string `json:"mod_time"`
+	IsDir   bool   `json:"is_dir,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+}
+
+// ManifestResponse is returned by POST /files/manifest, entries sorted by
+// path. Symlinks are not followed and not listed.
+type ManifestResponse struct {
+	Path    string          `json:"path"`
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// Excluded reports whether the relative, slash-separated path rel matches
+// one of patterns. A pattern without a slash, such as ".git" or "*.log",
+// matches any element of rel, so it excludes a directory with everything in
+// it. A pattern with a slash, such as "build/out" or "/vendor", matches
+// from the root. Patterns use path.Match syntax; a trailing slash is
+// ignored.
+func Excluded(rel string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	elems := strings.Split(rel, "/")
+	for _, p := range patterns {
+		p = strings.TrimSuffix(p, "/")
+		anchored := strings.Contains(p, "/")
+		p = strings.TrimPrefix(p, "/")
+		for i, elem := range elems {
+			name := elem
+			if anchored {
+				name = strings.Join(elems[:i+1], "/")
+			}
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ValidateExcludes returns an error for the first malformed pattern.
+func ValidateExcludes(patterns []string) error {
+	for _, p := range patterns {
+		if strings.Trim(p, "/") == "" {
+			return fmt.Errorf("empty exclude pattern %q", p)
+		}
+		if _, err := path.Match(strings.Trim(p, "/"), ""); err != nil {
+			return fmt.Errorf("bad exclude pattern %q: %v", p, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package api
+
+import "testing"
+
+func TestExcluded(t *testing.T) {
+	patterns := []string{".git", "node_modules/", "*.log", "build/out", "/vendor"}
+	tests := []struct {
+		rel  string
+		want bool
+	}{
+		{".git", true},
+		{".git/HEAD", true},
+		{"sub/.git/config", true},
+		{"node_modules", true},
+		{"web/node_modules/x/index.js", true},
+		{"debug.log", true},
+		{"logs/debug.log", true},
+		{"build/out", true},
+		{"build/out/app.exe", true},
+		{"src/build/out", false},
+		{"vendor/a.go", true},
+		{"src/vendor/a.go", false},
+		{"main.go", false},
+		{".gitignore", false},
+		{"build/output", false},
+	}
+	for _, tt := range tests {
+		if got := Excluded(tt.rel, patterns); got != tt.want {
+			t.Errorf("Excluded(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestValidateExcludes(t *testing.T) {
+	if err := ValidateExcludes([]string{".git", "*.log", "a/b/"}); err != nil {
+		t.Errorf("valid patterns: %v", err)
+	}
+	for _, bad := range []string{"[", "", "/"} {
+		if err := ValidateExcludes([]string{bad}); err == nil {
+			t.Errorf("%q was accepted", bad)
+		}
+	}
+}
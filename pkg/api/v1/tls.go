@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TLSConfig enables HTTPS. It is required when binding to a non-loopback
+// address.
+type TLSConfig struct {
+	// CertFile and KeyFile are PEM paths. With SelfSigned they are where
+	// the generated pair is stored, defaulting to the config directory.
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// SelfSigned generates a certificate on first start if none exists.
+	SelfSigned bool `json:"self_signed,omitempty"`
+	// Hosts are extra DNS names or IPs for a generated certificate.
+	Hosts []string `json:"hosts,omitempty"`
+	// ClientCAFile enables client certificate authentication against
+	// this CA bundle.
+	ClientCAFile string `json:"client_ca_file,omitempty"`
+	// RequireClientCert rejects TLS handshakes without a valid client
+	// certificate instead of falling back to token auth.
+	RequireClientCert bool `json:"require_client_cert,omitempty"`
+	// ClientIdentities are the client certificate common names that are
+	// accepted in place of the API token.
+	ClientIdentities []string `json:"client_identities,omitempty"`
+}
+
+// Enabled reports whether the server serves HTTPS.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || t.SelfSigned
+}
+
+// validateTLS checks the tls section of a config.
+func validateTLS(t TLSConfig, problems *ConfigErrors) {
+	if !t.SelfSigned {
+		if t.CertFile != "" && t.KeyFile == "" {
+			problems.Add("$.tls.key_file", "must be set together with tls.cert_file")
+		}
+		if t.KeyFile != "" && t.CertFile == "" {
+			problems.Add("$.tls.cert_file", "must be set together with tls.key_file")
+		}
+	}
+	if t.ClientCAFile != "" && !t.Enabled() {
+		problems.Add("$.tls.client_ca_file", "requires a server certificate (cert_file/key_file or self_signed)")
+	}
+	if t.RequireClientCert && t.ClientCAFile == "" {
+		problems.Add("$.tls.require_client_cert", "requires tls.client_ca_file")
+	}
+	if len(t.ClientIdentities) > 0 && t.ClientCAFile == "" {
+		problems.Add("$.tls.client_identities", "requires tls.client_ca_file")
+	}
+	for i, id := range t.ClientIdentities {
+		if strings.TrimSpace(id) == "" {
+			problems.Add(fmt.Sprintf("$.tls.client_identities[%d]", i), "must not be empty")
+		}
+	}
+}
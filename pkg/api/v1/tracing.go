@@ -0,0 +1,13 @@
+package api
+
+// TracingConfig controls OpenTelemetry span export. Incoming W3C
+// traceparent headers are honored even when export is disabled so that
+// log entries still carry the caller's trace ID.
+type TracingConfig struct {
+	Enabled      bool              `json:"enabled"`
+	OTLPEndpoint string            `json:"otlp_endpoint,omitempty"`
+	Insecure     bool              `json:"insecure,omitempty"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	ServiceName  string            `json:"service_name,omitempty"`
+	SampleRatio  float64           `json:"sample_ratio,omitempty"`
+}
@@ -0,0 +1,91 @@
+package api
+
+// RunRequest is the body of POST /run. CWD must be inside one of the
+// allowed paths.
+type RunRequest struct {
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	CWD     string   `json:"cwd"`
+}
+
+// RunResponse is the result of a run that was not streamed.
+type RunResponse struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exit_code"`
+}
+
+// StreamContentType is the media type of a streamed /run response: one
+// RunEvent per line. Clients ask for it with the Accept header.
+const StreamContentType = "application/x-ndjson"
+
+// RunEvent is one line of a streamed /run response. Output events carry
+// Stream ("stdout" or "stderr") and Data; the last event has Done set and
+// the exit code.
+type RunEvent struct {
+	Stream   string `json:"stream,omitempty"`
+	Data     string `json:"data,omitempty"`
+	Done     bool   `json:"done,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+}
+
+// HealthResponse is returned by /healthz and /readyz.
+type HealthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// VersionResponse is returned by /version.
+type VersionResponse struct {
+	Version   string        `json:"version"`
+	Commit    string        `json:"commit"`
+	GoVersion string        `json:"go_version"`
+	StartedAt string        `json:"started_at"`
+	Uptime    string        `json:"uptime"`
+	Config    ConfigSummary `json:"config"`
+}
+
+// ConfigSummary is the effective configuration reported by /version. It
+// deliberately omits the API token.
+type ConfigSummary struct {
+	Port           int      `json:"port"`
+	Bind           string   `json:"bind"`
+	AllowedClients []string `json:"allowed_clients,omitempty"`
+	TLSEnabled     bool     `json:"tls_enabled"`
+	AllowedCmds    []string `json:"allowed_commands"`
+	AllowedPaths   []string `json:"allowed_paths"`
+	LogFile        string   `json:"log_file"`
+	MaxConcurrent  int      `json:"max_concurrent"`
+	MaxQueued      int      `json:"max_queued"`
+	TracingEnabled bool     `json:"tracing_enabled"`
+}
+
+// ReloadResponse is returned by a successful POST /admin/reload.
+type ReloadResponse struct {
+	Status  string   `json:"status"`
+	Changes []string `json:"changes,omitempty"`
+	// Deprecated: failures are returned as an ErrorResponse with code
+	// invalid_config. Kept so older responses still decode.
+	Error string `json:"error,omitempty"`
+}
+
+// LogEntry is one line of the audit log.
+type LogEntry struct {
+	Timestamp string   `json:"timestamp"`
+	IP        string   `json:"ip"`
+	Command   string   `json:"command"`
+	Args      []string `json:"args"`
+	CWD       string   `json:"cwd"`
+	Stdout    string   `json:"stdout"`
+	Stderr    string   `json:"stderr"`
+	ExitCode  int      `json:"exit_code"`
+	Status    string   `json:"status"`
+	Reason    string   `json:"reason,omitempty"`
+	// Path, Target and Bytes describe file operations: the file, the
+	// destination of a move and how much was read or written.
+	Path     string `json:"path,omitempty"`
+	Target   string `json:"target,omitempty"`
+	Bytes    int64  `json:"bytes,omitempty"`
+	TraceID  string `json:"trace_id,omitempty"`
+	Identity string `json:"identity,omitempty"`
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestWireTypesRoundTrip(t *testing.T) {
+	values := []interface{}{
+		&RunRequest{Command: "go", Args: []string{"build", "-o", "out.exe"}, CWD: `C:\Dev\app`},
+		&RunResponse{Stdout: "ok\n", Stderr: "warn\n", ExitCode: 2},
+		&RunEvent{Stream: "stderr", Data: "línea\n"},
+		&RunEvent{Done: true, ExitCode: 1},
+		&HealthResponse{Status: "unavailable", Checks: map[string]string{"queue": "saturated: 4 running, 32 queued"}},
+		&VersionResponse{
+			Version: "v1.2.0", Commit: "abc123", GoVersion: "go1.23.0",
+			StartedAt: "2026-01-02T03:04:05Z", Uptime: "1h0m0s",
+			Config: ConfigSummary{
+				Port: 2223, Bind: "127.0.0.1", AllowedClients: []string{"10.0.0.0/8"}, TLSEnabled: true,
+				AllowedCmds: []string{"go"}, AllowedPaths: []string{"/srv/dev"}, LogFile: "logs/log.txt",
+				MaxConcurrent: 4, MaxQueued: 32, TracingEnabled: true,
+			},
+		},
+		&ReloadResponse{Status: "reloaded", Changes: []string{"port 2223 -> 2224 (restart required)"}},
+		&LogEntry{
+			Timestamp: "2026-01-02T03:04:05Z", IP: "127.0.0.1:5000", Command: "go", Args: []string{"test"},
+			CWD: "/srv/dev", Stdout: "ok", ExitCode: 0, Status: "completed", TraceID: "0af7651916cd43dd8448eb211c80319c", Identity: "alice",
+		},
+		&FileInfo{Path: `C:\Dev\app\main.go`, Name: "main.go", Size: 120, Mode: "-rw-rw-rw-", ModTime: "2026-01-02T03:04:05.5Z", SHA256: "ab12"},
+		&ListResponse{Path: "/srv/dev", Entries: []FileInfo{{Path: "/srv/dev/bin", Name: "bin", Mode: "drwxr-xr-x", IsDir: true, IsSymlink: true}}},
+		&MoveRequest{From: "/srv/dev/a", To: "/srv/dev/b", Overwrite: true},
+		&LogEntry{Timestamp: "2026-01-02T03:04:05Z", IP: "127.0.0.1:5000", Status: "file_move", Path: "/srv/dev/a", Target: "/srv/dev/b", Bytes: 12},
+		fullConfig(),
+	}
+
+	for _, v := range values {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("%T: marshal: %v", v, err)
+		}
+		got := reflect.New(reflect.TypeOf(v).Elem()).Interface()
+		if err := json.Unmarshal(data, got); err != nil {
+			t.Fatalf("%T: unmarshal: %v", v, err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("%T did not survive a round trip:\n got %+v\nwant %+v\njson %s", v, got, v, data)
+		}
+	}
+}
+
+// The JSON below is what v1 clients and servers already send. These tests
+// fail if a field is renamed or its encoding changes.
+func TestWireCompatibility(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		json string
+	}{
+		{"run request", RunRequest{Command: "go", Args: []string{"version"}, CWD: "/srv/dev"},
+			`{"command":"go","args":["version"],"cwd":"/srv/dev"}`},
+		{"run response", RunResponse{Stdout: "go1.23\n", ExitCode: 0},
+			`{"stdout":"go1.23\n","stderr":"","exit_code":0}`},
+		{"output event", RunEvent{Stream: "stdout", Data: "a\n"},
+			`{"stream":"stdout","data":"a\n"}`},
+		{"final event", RunEvent{Done: true, ExitCode: 3},
+			`{"done":true,"exit_code":3}`},
+		{"health", HealthResponse{Status: "ok"},
+			`{"status":"ok"}`},
+		{"reload failure", ReloadResponse{Status: "failed", Error: "invalid config"},
+			`{"status":"failed","error":"invalid config"}`},
+		{"system log entry", LogEntry{Timestamp: "2026-01-02T03:04:05Z", IP: "system", Status: "server_start", Reason: "started"},
+			`{"timestamp":"2026-01-02T03:04:05Z","ip":"system","command":"","args":null,"cwd":"","stdout":"","stderr":"","exit_code":0,"status":"server_start","reason":"started"}`},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.v)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if string(data) != tt.json {
+			t.Errorf("%s: encoding changed\n got %s\nwant %s", tt.name, data, tt.json)
+		}
+
+		got := reflect.New(reflect.TypeOf(tt.v)).Interface()
+		if err := json.Unmarshal([]byte(tt.json), got); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(reflect.ValueOf(got).Elem().Interface(), tt.v) {
+			t.Errorf("%s: decoding changed: got %+v, want %+v", tt.name, got, tt.v)
+		}
+	}
+}
+
+// Responses from older servers lack fields added since; they must still
+// decode, and unknown fields from newer servers must be ignored.
+func TestWireToleratesMissingAndExtraFields(t *testing.T) {
+	var ver VersionResponse
+	old := `{"version":"v1.0.0","commit":"abc","go_version":"go1.21","started_at":"x","uptime":"1s","config":{"port":2223,"allowed_commands":["go"],"allowed_paths":["C:\\Dev"],"max_concurrent":4,"max_queued":32}}`
+	if err := json.Unmarshal([]byte(old), &ver); err != nil {
+		t.Fatal(err)
+	}
+	if ver.Config.Port != 2223 || ver.Config.TLSEnabled || ver.Config.Bind != "" {
+		t.Errorf("unexpected decode of old /version: %+v", ver.Config)
+	}
+
+	var resp RunResponse
+	newer := `{"stdout":"x","stderr":"","exit_code":1,"duration_ms":12}`
+	if err := json.Unmarshal([]byte(newer), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp != (RunResponse{Stdout: "x", ExitCode: 1}) {
+		t.Errorf("unexpected decode: %+v", resp)
+	}
+}
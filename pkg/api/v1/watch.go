@@ -0,0 +1,56 @@
+package api
+
+// Watch event types.
+const (
+	WatchCreate = "create"
+	WatchModify = "modify"
+	WatchDelete = "delete"
+	// WatchError ends a streamed watch that cannot go on, for instance
+	// because the tree grew past the entry limit.
+	WatchError = "error"
+)
+
+// WatchRequest is the body of POST /files/watch, which reports changes to
+// the tree under Path, a directory. Include, if set, limits the events to
+// paths matching one of its patterns, and Exclude leaves paths out; both
+// match as described for Excluded, and excluded directories are not
+// scanned.
+//
+// Changes are reported once the tree has been quiet for DebounceMS
+// (default 200), so a build writing many files yields one batch of events.
+// Without streaming, the request waits up to TimeoutSeconds (default 30,
+// at most 300) for a batch and returns it with a Cursor; passing the
+// cursor to the next request reports whatever changed in between. A
+// streamed watch runs until TimeoutSeconds, if set, or until the client
+// goes away.
+type WatchRequest struct {
+	Path           string   `json:"path"`
+	Include        []string `json:"include,omitempty"`
+	Exclude        []string `json:"exclude,omitempty"`
+	DebounceMS     int      `json:"debounce_ms,omitempty"`
+	TimeoutSeconds int      `json:"timeout_seconds,omitempty"`
+	Cursor         string   `json:"cursor,omitempty"`
+}
+
+// WatchEvent is one change, or a streamed watch's final error. Path is
+// relative to the watched directory and uses forward slashes; Size and
+// ModTime describe the entry after the change.
+type WatchEvent struct {
+	Type    string `json:"type"`
+	Path    string `json:"path,omitempty"`
+	IsDir   bool   `json:"is_dir,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	ModTime string `json:"mod_time,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// WatchResponse is returned by a POST /files/watch that is not streamed.
+// Events is empty if nothing changed before the timeout. Reset is set when
+// the request's cursor had expired or did not match, so changes made
+// since it was issued may not have been reported.
+type WatchResponse struct {
+	Path   string       `json:"path"`
+	Cursor string       `json:"cursor"`
+	Reset  bool         `json:"reset,omitempty"`
+	Events []WatchEvent `json:"events"`
+}
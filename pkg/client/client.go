@@ -0,0 +1,315 @@
+// Package client is a Go client for the DevProxy API.
+//
+//	c, err := client.New("http://127.0.0.1:2223", client.Options{Token: token})
+//	if err != nil { ... }
+//	res, err := c.Run(ctx, api.RunRequest{Command: "go", Args: []string{"version"}, CWD: dir})
+//
+// Every method takes a context; cancelling it abandons the request (a
+// command that has already started keeps running on the server).
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// DefaultAddr is the address of a server running with the default config.
+const DefaultAddr = "http://127.0.0.1:2223"
+
+const defaultRetryWait = 500 * time.Millisecond
+
+// Options configure a Client. Every field is optional.
+type Options struct {
+	// Token is sent as X-Admin-Token on authenticated endpoints. It may be
+	// empty when a client certificate listed in the server's
+	// tls.client_identities is used instead.
+	Token string
+	// TLSConfig is used for https:// addresses. See TLSFiles.
+	TLSConfig *tls.Config
+	// Transport replaces the default transport. Unix socket and named
+	// pipe addresses and TLSConfig are then up to the caller.
+	Transport http.RoundTripper
+	// Retries is how many times a request is retried after a connection
+	// failure or a 503 (queue full, shutting down). The server answers 503
+	// only before a command starts, so retrying a run never runs it twice.
+	Retries int
+	// RetryWait is the delay before the first retry; it doubles on each
+	// following one. Defaults to 500ms.
+	RetryWait time.Duration
+}
+
+// Client talks to one DevProxy server. It is safe for concurrent use.
+type Client struct {
+	addr    string
+	baseURL string
+	token   string
+	http    *http.Client
+	opts    Options
+	// legacy is set once the server turns out to predate api.Prefix.
+	legacy atomic.Bool
+}
+
+// New returns a client for the server at addr, which is an http:// or
+// https:// URL, a Unix socket as unix:///path/to/devproxy.sock, or a
+// Windows named pipe as npipe:////./pipe/devproxy.
+func New(addr string, opts Options) (*Client, error) {
+	if opts.RetryWait <= 0 {
+		opts.RetryWait = defaultRetryWait
+	}
+
+	c := &Client{addr: addr, token: opts.Token, opts: opts}
+
+	var dial func(ctx context.Context) (net.Conn, error)
+	switch {
+	case strings.HasPrefix(addr, "http://"), strings.HasPrefix(addr, "https://"):
+		c.baseURL = strings.TrimSuffix(addr, "/")
+
+	case strings.HasPrefix(addr, "unix://"):
+		path := strings.TrimPrefix(addr, "unix://")
+		if path == "" {
+			return nil, fmt.Errorf("missing socket path in %q", addr)
+		}
+		dial = func(ctx context.Context) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+
+	case strings.HasPrefix(addr, "npipe://"):
+		path := strings.ReplaceAll(strings.TrimPrefix(addr, "npipe:"), "/", `\`)
+		if !strings.HasPrefix(strings.ToLower(path), `\\.\pipe\`) {
+			return nil, fmt.Errorf(`invalid pipe address %q (expected npipe:////./pipe/name)`, addr)
+		}
+		dial = func(ctx context.Context) (net.Conn, error) {
+			return dialPipe(ctx, path)
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported address %q (use http(s)://host:port, unix:///path or npipe:////./pipe/name)", addr)
+	}
+
+	rt := opts.Transport
+	if rt == nil {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = opts.TLSConfig
+		if dial != nil {
+			// The URL host is ignored by the dialer and only appears
+			// in the Host header.
+			c.baseURL = "http://devproxy"
+			t.Proxy = nil
+			t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return dial(ctx)
+			}
+		}
+		rt = t
+	} else if dial != nil {
+		c.baseURL = "http://devproxy"
+	}
+	c.http = &http.Client{Transport: rt}
+
+	return c, nil
+}
+
+// Addr returns the address the client was created with.
+func (c *Client) Addr() string {
+	return c.addr
+}
+
+// Error is returned for a response with a non-2xx status. Code and Details
+// come from the server's api.ErrorResponse; servers that predate it only
+// provide Message.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Details    interface{}
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("server returned %d", e.StatusCode)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Code != "" {
+		msg += " (" + e.Code + ")"
+	}
+	return msg
+}
+
+func newError(status int, body []byte) *Error {
+	var er api.ErrorResponse
+	if json.Unmarshal(body, &er) == nil && er.Code != "" {
+		return &Error{StatusCode: status, Code: er.Code, Message: er.Message, Details: er.Details}
+	}
+	return &Error{StatusCode: status, Message: strings.TrimSpace(string(body))}
+}
+
+// Health calls /healthz, which succeeds whenever the server is up.
+func (c *Client) Health(ctx context.Context) (*api.HealthResponse, error) {
+	var resp api.HealthResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/healthz", false, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Ready calls /readyz. When the server is up but not ready it returns the
+// response, whose Checks say why, together with an *Error.
+func (c *Client) Ready(ctx context.Context) (*api.HealthResponse, error) {
+	var resp api.HealthResponse
+	err := c.doJSON(ctx, http.MethodGet, "/readyz", false, nil, &resp)
+	var apiErr *Error
+	if err != nil && !(errors.As(err, &apiErr) && resp.Status != "") {
+		return nil, err
+	}
+	return &resp, err
+}
+
+// Version calls the authenticated /version endpoint.
+func (c *Client) Version(ctx context.Context) (*api.VersionResponse, error) {
+	var resp api.VersionResponse
+	if err := c.doJSON(ctx, http.MethodGet, "/version", true, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Reload asks the server to re-read its config and returns what changed.
+func (c *Client) Reload(ctx context.Context) (*api.ReloadResponse, error) {
+	var resp api.ReloadResponse
+	err := c.doJSON(ctx, http.MethodPost, "/admin/reload", true, nil, &resp)
+	if err != nil {
+		var apiErr *Error
+		if errors.As(err, &apiErr) && resp.Error != "" {
+			apiErr.Message = resp.Error
+		}
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// doJSON sends body (if non-nil) as JSON and decodes the response into v.
+// A non-2xx response with a JSON body is still decoded into v and returned
+// with an *Error.
+func (c *Client) doJSON(ctx context.Context, method, path string, auth bool, body, v interface{}) error {
+	resp, err := c.do(ctx, method, path, auth, body, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode/100 != 2 {
+		json.Unmarshal(data, v)
+		return newError(resp.StatusCode, data)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse response: %v", err)
+	}
+	return nil
+}
+
+// do sends body, JSON-encoded or as is if it is a []byte, and returns the
+// response. See send.
+func (c *Client) do(ctx context.Context, method, path string, auth bool, body interface{}, accept string) (*http.Response, error) {
+	header := http.Header{"Accept": {accept}}
+	var data []byte
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		data = b
+		header.Set("Content-Type", "application/octet-stream")
+	default:
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %v", err)
+		}
+		header.Set("Content-Type", "application/json")
+	}
+	return c.send(ctx, method, path, auth, data, header)
+}
+
+// send sends a request to path under api.Prefix, retrying connection
+// failures and 503 responses up to Options.Retries times. The caller closes
+// the response body.
+func (c *Client) send(ctx context.Context, method, path string, auth bool, data []byte, header http.Header) (*http.Response, error) {
+	wait := c.opts.RetryWait
+	for attempt := 0; ; attempt++ {
+		url := c.baseURL + api.Prefix + path
+		if c.legacy.Load() {
+			url = c.baseURL + path
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if auth && c.token != "" {
+			req.Header.Set("X-Admin-Token", c.token)
+		}
+
+		resp, err := c.http.Do(req)
+		retry := attempt < c.opts.Retries
+		switch {
+		case err != nil:
+			if !retry || !retryable(method, err) {
+				return nil, fmt.Errorf("failed to send request: %v", err)
+			}
+		case resp.StatusCode == http.StatusNotFound && !c.legacy.Load() && !isJSON(resp):
+			// A server without versioned routes answers with the
+			// plain-text 404 of a bare ServeMux; use the old paths.
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			c.legacy.Store(true)
+			attempt--
+			continue
+		case resp.StatusCode == http.StatusServiceUnavailable && retry:
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		default:
+			return resp, nil
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		wait *= 2
+	}
+}
+
+func isJSON(resp *http.Response) bool {
+	mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mt == "application/json"
+}
+
+// retryable reports whether a failed request may be sent again. GETs are
+// always safe; other requests only if the connection was never made.
+func retryable(method string, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if method == http.MethodGet {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
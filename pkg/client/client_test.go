@@ -0,0 +1,244 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// hits records when each request reached a test server.
+type hits struct {
+	mu    sync.Mutex
+	paths []string
+	times []time.Time
+}
+
+func (h *hits) add(r *http.Request) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.paths = append(h.paths, r.URL.Path)
+	h.times = append(h.times, time.Now())
+	return len(h.paths)
+}
+
+func (h *hits) get() ([]string, []time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.paths...), append([]time.Time(nil), h.times...)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func newTestClient(t *testing.T, addr string, opts Options) *Client {
+	t.Helper()
+	c, err := New(addr, opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return c
+}
+
+func TestRetryBacksOff(t *testing.T) {
+	var h hits
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.add(r) < 3 {
+			writeJSON(w, http.StatusServiceUnavailable, api.ErrorResponse{Code: api.CodeQueueFull, Message: "busy"})
+			return
+		}
+		writeJSON(w, http.StatusOK, api.HealthResponse{Status: "ok"})
+	}))
+	defer ts.Close()
+
+	wait := 20 * time.Millisecond
+	c := newTestClient(t, ts.URL, Options{Retries: 2, RetryWait: wait})
+	resp, err := c.Health(context.Background())
+	if err != nil {
+		t.Fatalf("Health: %v", err)
+	}
+	if resp.Status != "ok" {
+		t.Errorf("Status = %q, want ok", resp.Status)
+	}
+	_, times := h.get()
+	if len(times) != 3 {
+		t.Fatalf("server saw %d requests, want 3", len(times))
+	}
+	if d := times[1].Sub(times[0]); d < wait {
+		t.Errorf("first retry after %v, want at least %v", d, wait)
+	}
+	if d := times[2].Sub(times[1]); d < 2*wait {
+		t.Errorf("second retry after %v, want at least %v", d, 2*wait)
+	}
+}
+
+func TestRetriesRunOut(t *testing.T) {
+	var h hits
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.add(r)
+		writeJSON(w, http.StatusServiceUnavailable, api.ErrorResponse{Code: api.CodeQueueFull, Message: "busy"})
+	}))
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL, Options{Retries: 1, RetryWait: time.Millisecond})
+	_, err := c.Health(context.Background())
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("err = %v, want a 503 *Error", err)
+	}
+	if paths, _ := h.get(); len(paths) != 2 {
+		t.Errorf("server saw %d requests, want 2", len(paths))
+	}
+}
+
+func TestRetryConnectionFailure(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "http://" + ln.Addr().String()
+	ln.Close()
+
+	wait := 10 * time.Millisecond
+	c := newTestClient(t, addr, Options{Retries: 2, RetryWait: wait})
+	start := time.Now()
+	if _, err := c.Health(context.Background()); err == nil {
+		t.Fatal("Health succeeded with nothing listening")
+	}
+	if d := time.Since(start); d < 3*wait {
+		t.Errorf("gave up after %v, want at least %v of backoff", d, 3*wait)
+	}
+
+	// Cancelling the context stops the backoff.
+	c = newTestClient(t, addr, Options{Retries: 5, RetryWait: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Health(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestLegacyPathFallback(t *testing.T) {
+	var h hits
+	mux := http.NewServeMux()
+	mux.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
+		h.add(r)
+		writeJSON(w, http.StatusOK, api.VersionResponse{Version: "0.9"})
+	})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			h.add(r)
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL, Options{})
+	for i := 0; i < 2; i++ {
+		resp, err := c.Version(context.Background())
+		if err != nil {
+			t.Fatalf("Version: %v", err)
+		}
+		if resp.Version != "0.9" {
+			t.Errorf("Version = %q, want 0.9", resp.Version)
+		}
+	}
+	paths, _ := h.get()
+	want := []string{api.Prefix + "/version", "/version", "/version"}
+	if !slices.Equal(paths, want) {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+}
+
+func TestJSONNotFoundIsNotLegacy(t *testing.T) {
+	var h hits
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.add(r)
+		writeJSON(w, http.StatusNotFound, api.ErrorResponse{Code: api.CodeNotFound, Message: "no such file"})
+	}))
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL, Options{})
+	_, err := c.Version(context.Background())
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != api.CodeNotFound {
+		t.Fatalf("err = %v, want a not_found *Error", err)
+	}
+	if paths, _ := h.get(); len(paths) != 1 || paths[0] != api.Prefix+"/version" {
+		t.Errorf("paths = %v, want only %s/version", paths, api.Prefix)
+	}
+}
+
+func TestErrorDecoding(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        Error
+		wantString  string
+	}{
+		{
+			name:        "error response",
+			contentType: "application/json",
+			body:        `{"code":"forbidden","message":"path not allowed","details":{"path":"/etc"}}`,
+			want:        Error{StatusCode: 403, Code: "forbidden", Message: "path not allowed", Details: map[string]interface{}{"path": "/etc"}},
+			wantString:  "server returned 403: path not allowed (forbidden)",
+		},
+		{
+			name:        "plain text",
+			contentType: "text/plain",
+			body:        "Forbidden\n",
+			want:        Error{StatusCode: 403, Message: "Forbidden"},
+			wantString:  "server returned 403: Forbidden",
+		},
+		{
+			name:        "json without code",
+			contentType: "application/json",
+			body:        `{"error":"old style"}`,
+			want:        Error{StatusCode: 403, Message: `{"error":"old style"}`},
+			wantString:  `server returned 403: {"error":"old style"}`,
+		},
+		{
+			name:        "empty",
+			contentType: "text/plain",
+			want:        Error{StatusCode: 403},
+			wantString:  "server returned 403",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			c := newTestClient(t, ts.URL, Options{})
+			_, err := c.Version(context.Background())
+			var apiErr *Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("err = %v, want an *Error", err)
+			}
+			got, _ := json.Marshal(apiErr)
+			want, _ := json.Marshal(tt.want)
+			if string(got) != string(want) {
+				t.Errorf("error = %s, want %s", got, want)
+			}
+			if apiErr.Error() != tt.wantString {
+				t.Errorf("Error() = %q, want %q", apiErr.Error(), tt.wantString)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// WriteOptions are the optional parts of a WriteFile.
+type WriteOptions struct {
+	// ExpectedSHA256, if set, makes the write fail with a hash_mismatch
+	// Error unless the file's current SHA-256 matches. "absent" requires
+	// that the file does not exist yet.
+	ExpectedSHA256 string
+	// Parents creates missing parent directories.
+	Parents bool
+	// ModTime, if set, becomes the file's modification time.
+	ModTime time.Time
+}
+
+// formatModTime returns t as the mod_time of a write or upload; the zero
+// time is left out.
+func formatModTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// filesPath returns endpoint with path and the non-empty name/value pairs
+// in params as the query string.
+func filesPath(endpoint, path string, params ...string) string {
+	q := url.Values{"path": {path}}
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i+1] != "" {
+			q.Set(params[i], params[i+1])
+		}
+	}
+	return endpoint + "?" + q.Encode()
+}
+
+// flag returns a boolean query value; false is left out.
+func flag(b bool) string {
+	if b {
+		return "true"
+	}
+	return ""
+}
+
+// Stat describes a file or directory on the server. With hash, the
+// FileInfo of a file includes its SHA-256.
+func (c *Client) Stat(ctx context.Context, path string, hash bool) (*api.FileInfo, error) {
+	var info api.FileInfo
+	if err := c.doJSON(ctx, http.MethodGet, filesPath("/files/stat", path, "hash", flag(hash)), true, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// List lists a directory on the server.
+func (c *Client) List(ctx context.Context, path string) (*api.ListResponse, error) {
+	var resp api.ListResponse
+	if err := c.doJSON(ctx, http.MethodGet, filesPath("/files/list", path), true, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// OpenFile reads length bytes of a file starting at offset; a negative
+// length reads to the end. The caller closes the returned reader.
+func (c *Client) OpenFile(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{"Accept": {"application/octet-stream"}}
+	switch {
+	case length == 0:
+		return io.NopCloser(strings.NewReader("")), nil
+	case length > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, filesPath("/files/read", path), true, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newError(resp.StatusCode, body)
+	}
+	return resp.Body, nil
+}
+
+// ReadFile returns the contents of a file.
+func (c *Client) ReadFile(ctx context.Context, path string) ([]byte, error) {
+	r, err := c.OpenFile(ctx, path, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+	return data, nil
+}
+
+// WriteFile atomically replaces a file with data. The returned FileInfo
+// includes the SHA-256 of what was written.
+func (c *Client) WriteFile(ctx context.Context, path string, data []byte, opts WriteOptions) (*api.FileInfo, error) {
+	p := filesPath("/files/write", path, "expected_sha256", opts.ExpectedSHA256, "parents", flag(opts.Parents),
+		"mod_time", formatModTime(opts.ModTime))
+	if data == nil {
+		data = []byte{}
+	}
+	var info api.FileInfo
+	if err := c.doJSON(ctx, http.MethodPut, p, true, data, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Mkdir creates a directory; with parents, like mkdir -p.
+func (c *Client) Mkdir(ctx context.Context, path string, parents bool) (*api.FileInfo, error) {
+	var info api.FileInfo
+	if err := c.doJSON(ctx, http.MethodPost, "/files/mkdir", true, api.MkdirRequest{Path: path, Parents: parents}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Move moves or renames a file or directory.
+func (c *Client) Move(ctx context.Context, from, to string, overwrite bool) (*api.FileInfo, error) {
+	var info api.FileInfo
+	if err := c.doJSON(ctx, http.MethodPost, "/files/move", true, api.MoveRequest{From: from, To: to, Overwrite: overwrite}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Delete deletes a file, or a directory and, with recursive, everything in
+// it. It returns what was deleted.
+func (c *Client) Delete(ctx context.Context, path string, recursive bool) (*api.FileInfo, error) {
+	var info api.FileInfo
+	if err := c.doJSON(ctx, http.MethodPost, "/files/delete", true, api.DeleteRequest{Path: path, Recursive: recursive}, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Archive packs a directory or file on the server into a zip or tar.gz
+// archive there. The returned FileInfo describes the archive, including
+// its SHA-256.
+func (c *Client) Archive(ctx context.Context, req api.ArchiveRequest) (*api.FileInfo, error) {
+	var info api.FileInfo
+	if err := c.doJSON(ctx, http.MethodPost, "/files/archive", true, req, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Extract unpacks an archive on the server into a directory there.
+func (c *Client) Extract(ctx context.Context, req api.ExtractRequest) (*api.ExtractResponse, error) {
+	var resp api.ExtractResponse
+	if err := c.doJSON(ctx, http.MethodPost, "/files/extract", true, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Patch applies a unified diff to files on the server. If it does not
+// apply, the returned *Error has Code api.CodePatchFailed and the
+// PatchResponse saying which hunks failed is returned with it.
+func (c *Client) Patch(ctx context.Context, req api.PatchRequest) (*api.PatchResponse, error) {
+	var resp api.PatchResponse
+	err := c.doJSON(ctx, http.MethodPost, "/files/patch", true, req, &resp)
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.Code == api.CodePatchFailed {
+		if data, merr := json.Marshal(apiErr.Details); merr == nil && json.Unmarshal(data, &resp) == nil {
+			return &resp, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Search finds files under a directory on the server and, with
+// req.Pattern, the lines in them that match.
+func (c *Client) Search(ctx context.Context, req api.SearchRequest) (*api.SearchResponse, error) {
+	var resp api.SearchResponse
+	if err := c.doJSON(ctx, http.MethodPost, "/files/search", true, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
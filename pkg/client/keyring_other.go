@@ -0,0 +1,25 @@
+//go:build !windows
+
+package client
+
+import (
+	"context"
+	"runtime"
+)
+
+// keyringToken reads item with the platform's keychain tool: security on
+// macOS and secret-tool elsewhere.
+func keyringToken(ctx context.Context, item KeyringItem) (string, error) {
+	if runtime.GOOS == "darwin" {
+		args := []string{"find-generic-password", "-s", item.Service, "-w"}
+		if item.Account != "" {
+			args = append(args, "-a", item.Account)
+		}
+		return runTokenCommand(ctx, "security", args...)
+	}
+	args := []string{"lookup", "service", item.Service}
+	if item.Account != "" {
+		args = append(args, "account", item.Account)
+	}
+	return runTokenCommand(ctx, "secret-tool", args...)
+}
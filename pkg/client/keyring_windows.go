@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	advapi32      = windows.NewLazySystemDLL("advapi32.dll")
+	procCredReadW = advapi32.NewProc("CredReadW")
+	procCredFree  = advapi32.NewProc("CredFree")
+)
+
+const credTypeGeneric = 1
+
+// credential is the start of CREDENTIALW, up to the fields read here.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// keyringToken reads the generic credential named item.Service from the
+// Credential Manager, as stored by "cmdkey /generic:<service> /user:<account>
+// /pass".
+func keyringToken(ctx context.Context, item KeyringItem) (string, error) {
+	target, err := windows.UTF16PtrFromString(item.Service)
+	if err != nil {
+		return "", err
+	}
+	var cred *credential
+	r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		return "", err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	if item.Account != "" && !strings.EqualFold(windows.UTF16PtrToString(cred.UserName), item.Account) {
+		return "", fmt.Errorf("credential belongs to %q, not %q", windows.UTF16PtrToString(cred.UserName), item.Account)
+	}
+	blob := unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)
+	return decodeCredentialBlob(blob), nil
+}
+
+// decodeCredentialBlob returns a credential's secret, which cmdkey and the
+// Credential Manager store as UTF-16 but other tools as UTF-8.
+func decodeCredentialBlob(blob []byte) string {
+	if len(blob)%2 != 0 {
+		return string(blob)
+	}
+	u := make([]uint16, len(blob)/2)
+	for i := range u {
+		if blob[2*i+1] != 0 {
+			return string(blob)
+		}
+		u[i] = uint16(blob[2*i]) | uint16(blob[2*i+1])<<8
+	}
+	return string(utf16.Decode(u))
+}
@@ -0,0 +1,243 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProfileEnv names the environment variable selecting a profile when none
+// is given on the command line.
+const ProfileEnv = "DEVPROXY_PROFILE"
+
+// tokenCommandTimeout bounds a token source's command, which may be
+// waiting on a password manager that is never unlocked.
+const tokenCommandTimeout = 30 * time.Second
+
+// ConfigFile is the client configuration: named profiles, each describing
+// a server and how to reach it. See LoadConfigFile.
+type ConfigFile struct {
+	// DefaultProfile is used when no profile is selected.
+	DefaultProfile string             `json:"default_profile,omitempty"`
+	Profiles       map[string]Profile `json:"profiles"`
+}
+
+// Profile describes one server. Every field is optional; command-line
+// flags take precedence over it.
+type Profile struct {
+	// Addr is the server address, as for New.
+	Addr  string      `json:"addr,omitempty"`
+	Token TokenSource `json:"token,omitempty"`
+
+	// Transport.
+	CAFile   string `json:"ca,omitempty"`
+	Pin      string `json:"pin,omitempty"`
+	CertFile string `json:"cert,omitempty"`
+	KeyFile  string `json:"key,omitempty"`
+	Retries  int    `json:"retries,omitempty"`
+
+	// Defaults for devctl.
+	CWD   string `json:"cwd,omitempty"`
+	NoWSL bool   `json:"no_wsl,omitempty"`
+}
+
+// TLS returns the profile's certificate settings.
+func (p Profile) TLS() TLSFiles {
+	return TLSFiles{CAFile: p.CAFile, Pin: p.Pin, CertFile: p.CertFile, KeyFile: p.KeyFile}
+}
+
+// TokenSource says where a profile's token comes from. At most one field
+// may be set; with none, the profile has no token.
+type TokenSource struct {
+	// Env names an environment variable holding the token.
+	Env string `json:"env,omitempty"`
+	// File is a file holding the token, read with ReadTokenFile.
+	File string `json:"file,omitempty"`
+	// Keyring is an entry in the OS credential store.
+	Keyring *KeyringItem `json:"keyring,omitempty"`
+	// Command is run, without a shell, and prints the token.
+	Command []string `json:"command,omitempty"`
+	// Helper is a credential helper speaking git's protocol: "!cmd" is
+	// run by the shell, and a bare name such as "pass" runs
+	// devproxy-credential-pass.
+	Helper string `json:"helper,omitempty"`
+}
+
+// KeyringItem is an entry in the OS credential store: a generic credential
+// named Service in the Windows Credential Manager, a generic password in
+// the macOS keychain, or a Secret Service item with service and account
+// attributes, as stored by secret-tool, elsewhere.
+type KeyringItem struct {
+	Service string `json:"service"`
+	Account string `json:"account,omitempty"`
+}
+
+// DefaultConfigPath returns where the client configuration lives:
+// $XDG_CONFIG_HOME/devproxy/client.json when XDG_CONFIG_HOME is set and
+// that file exists, and ~/.devproxy/client.json otherwise.
+func DefaultConfigPath() string {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		p := filepath.Join(xdg, "devproxy", "client.json")
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".devproxy", "client.json")
+}
+
+// LoadConfigFile reads and checks the client configuration at path.
+// Relative file names in it are taken relative to its directory, and a
+// leading ~/ to the home directory. The error wraps os.ErrNotExist when
+// there is no such file.
+func LoadConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cf ConfigFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cf); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if cf.DefaultProfile != "" {
+		if _, ok := cf.Profiles[cf.DefaultProfile]; !ok {
+			return nil, fmt.Errorf("%s: default_profile %q is not defined", path, cf.DefaultProfile)
+		}
+	}
+	dir := filepath.Dir(path)
+	for name, p := range cf.Profiles {
+		if err := p.Token.check(); err != nil {
+			return nil, fmt.Errorf("%s: profile %q: %w", path, name, err)
+		}
+		for _, f := range []*string{&p.CAFile, &p.CertFile, &p.KeyFile, &p.Token.File} {
+			*f = resolvePath(dir, *f)
+		}
+		cf.Profiles[name] = p
+	}
+	return &cf, nil
+}
+
+// Profile returns the named profile or, for "", the default one; with no
+// default, the zero Profile.
+func (cf *ConfigFile) Profile(name string) (Profile, error) {
+	if name == "" {
+		name = cf.DefaultProfile
+		if name == "" {
+			return Profile{}, nil
+		}
+	}
+	p, ok := cf.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(cf.Profiles))
+		for n := range cf.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return Profile{}, fmt.Errorf("no profile %q (have: %s)", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+func resolvePath(dir, p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	if rest, ok := strings.CutPrefix(filepath.ToSlash(p), "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return filepath.Join(dir, p)
+}
+
+func (t TokenSource) check() error {
+	n := 0
+	for _, set := range []bool{t.Env != "", t.File != "", t.Keyring != nil, len(t.Command) > 0, t.Helper != ""} {
+		if set {
+			n++
+		}
+	}
+	switch {
+	case n > 1:
+		return fmt.Errorf("token: set only one of env, file, keyring, command and helper")
+	case t.Keyring != nil && t.Keyring.Service == "":
+		return fmt.Errorf("token: keyring needs a service")
+	}
+	return nil
+}
+
+// IsZero reports whether no source is set.
+func (t TokenSource) IsZero() bool {
+	return t.Env == "" && t.File == "" && t.Keyring == nil && len(t.Command) == 0 && t.Helper == ""
+}
+
+// Token fetches the token for the server at addr, which only a credential
+// helper is told. It returns an error if the source is set but yields
+// nothing.
+func (t TokenSource) Token(ctx context.Context, addr string) (string, error) {
+	var token string
+	switch {
+	case t.Env != "":
+		token = os.Getenv(t.Env)
+		if token == "" {
+			return "", fmt.Errorf("environment variable %s is not set", t.Env)
+		}
+	case t.File != "":
+		return ReadTokenFile(t.File)
+	case t.Keyring != nil:
+		var err error
+		if token, err = keyringToken(ctx, *t.Keyring); err != nil {
+			return "", fmt.Errorf("keyring %s: %w", t.Keyring.Service, err)
+		}
+	case len(t.Command) > 0:
+		ctx, cancel := context.WithTimeout(ctx, tokenCommandTimeout)
+		defer cancel()
+		out, err := runTokenCommand(ctx, t.Command[0], t.Command[1:]...)
+		if err != nil {
+			return "", fmt.Errorf("token command %s: %w", t.Command[0], err)
+		}
+		token = out
+	case t.Helper != "":
+		ctx, cancel := context.WithTimeout(ctx, tokenCommandTimeout)
+		defer cancel()
+		var err error
+		if token, err = helperToken(ctx, t.Helper, addr); err != nil {
+			return "", fmt.Errorf("credential helper %s: %w", t.Helper, err)
+		}
+	default:
+		return "", nil
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("token source yielded an empty token")
+	}
+	return token, nil
+}
+
+// runTokenCommand runs a command and returns what it prints, with its
+// error output in the error if it fails.
+func runTokenCommand(ctx context.Context, name string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// writeClientConfig writes data as client.json in a new directory and
+// returns its path.
+func writeClientConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "client.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	path := writeClientConfig(t, `{
+		"default_profile": "work",
+		"profiles": {
+			"work": {"addr": "devbox:2223", "ca": "certs/ca.pem", "cert": "~/certs/me.pem",
+				"key": "/etc/devproxy/me.key", "token": {"file": "token"}},
+			"home": {"addr": "unix:///run/devproxy.sock", "token": {"env": "HOME_TOKEN"}}
+		}
+	}`)
+	cf, err := LoadConfigFile(path)
+	if err != nil {
+		t.Fatalf("LoadConfigFile: %v", err)
+	}
+	dir := filepath.Dir(path)
+	p := cf.Profiles["work"]
+	want := map[string]string{
+		"ca":    filepath.Join(dir, "certs", "ca.pem"),
+		"cert":  filepath.Join(home, "certs", "me.pem"),
+		"key":   "/etc/devproxy/me.key",
+		"token": filepath.Join(dir, "token"),
+	}
+	if runtime.GOOS == "windows" {
+		// Not absolute without a drive, so taken relative to the file.
+		want["key"] = filepath.Join(dir, "/etc/devproxy/me.key")
+	}
+	for field, got := range map[string]string{"ca": p.CAFile, "cert": p.CertFile, "key": p.KeyFile, "token": p.Token.File} {
+		if got != want[field] {
+			t.Errorf("%s = %q, want %q", field, got, want[field])
+		}
+	}
+
+	if _, err := LoadConfigFile(filepath.Join(dir, "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: err = %v, want os.ErrNotExist", err)
+	}
+	tests := []struct {
+		name, data, wantErr string
+	}{
+		{"unknown field", `{"profiles":{"a":{"adr":"x"}}}`, `unknown field "adr"`},
+		{"bad JSON", `{"profiles":`, "client.json"},
+		{"undefined default", `{"default_profile":"b","profiles":{"a":{}}}`, `default_profile "b" is not defined`},
+		{"two token sources", `{"profiles":{"a":{"token":{"env":"T","file":"t"}}}}`, `profile "a": token: set only one`},
+		{"keyring without service", `{"profiles":{"a":{"token":{"keyring":{"account":"me"}}}}}`, "keyring needs a service"},
+	}
+	for _, tt := range tests {
+		if _, err := LoadConfigFile(writeClientConfig(t, tt.data)); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want one containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConfigFileProfile(t *testing.T) {
+	cf := &ConfigFile{Profiles: map[string]Profile{
+		"work": {Addr: "devbox:2223"},
+		"home": {Addr: "homebox:2223"},
+	}}
+	if p, err := cf.Profile(""); err != nil || p.Addr != "" {
+		t.Errorf("no default: %+v, %v; want the zero profile", p, err)
+	}
+	if p, err := cf.Profile("home"); err != nil || p.Addr != "homebox:2223" {
+		t.Errorf("Profile(home) = %+v, %v", p, err)
+	}
+	cf.DefaultProfile = "work"
+	if p, err := cf.Profile(""); err != nil || p.Addr != "devbox:2223" {
+		t.Errorf("default: %+v, %v; want work", p, err)
+	}
+	if _, err := cf.Profile("play"); err == nil || !strings.Contains(err.Error(), `no profile "play" (have: home, work)`) {
+		t.Errorf("unknown profile: err = %v", err)
+	}
+}
+
+func TestTokenSource(t *testing.T) {
+	ctx := context.Background()
+	if !(TokenSource{}).IsZero() || (TokenSource{Command: []string{"x"}}).IsZero() {
+		t.Error("IsZero is wrong")
+	}
+	if token, err := (TokenSource{}).Token(ctx, ""); token != "" || err != nil {
+		t.Errorf("no source: %q, %v; want no token", token, err)
+	}
+
+	t.Setenv("DEVPROXY_TEST_TOKEN", " s3cret\n")
+	if token, err := (TokenSource{Env: "DEVPROXY_TEST_TOKEN"}).Token(ctx, ""); token != "s3cret" || err != nil {
+		t.Errorf("env: %q, %v", token, err)
+	}
+	if _, err := (TokenSource{Env: "DEVPROXY_TEST_UNSET"}).Token(ctx, ""); err == nil || !strings.Contains(err.Error(), "DEVPROXY_TEST_UNSET is not set") {
+		t.Errorf("unset env: err = %v", err)
+	}
+	t.Setenv("DEVPROXY_TEST_BLANK", " ")
+	if _, err := (TokenSource{Env: "DEVPROXY_TEST_BLANK"}).Token(ctx, ""); err == nil || !strings.Contains(err.Error(), "empty token") {
+		t.Errorf("blank env: err = %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(file, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := (TokenSource{File: file}).Token(ctx, ""); token != "from-file" || err != nil {
+		t.Errorf("file: %q, %v", token, err)
+	}
+	if _, err := (TokenSource{File: file + ".missing"}).Token(ctx, ""); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: err = %v, want os.ErrNotExist", err)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	tests := []struct {
+		name    string
+		command []string
+		want    string
+		wantErr string
+	}{
+		{"prints token", []string{"sh", "-c", "echo ' from-command '"}, "from-command", ""},
+		{"prints nothing", []string{"true"}, "", "empty token"},
+		{"fails", []string{"sh", "-c", "echo locked >&2; exit 1"}, "", "token command sh: exit status 1: locked"},
+		{"not found", []string{"devproxy-no-such-command"}, "", "token command devproxy-no-such-command"},
+	}
+	for _, tt := range tests {
+		token, err := (TokenSource{Command: tt.command}).Token(ctx, "")
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("command %s: err = %v, want one containing %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if token != tt.want || err != nil {
+			t.Errorf("command %s: %q, %v; want %q", tt.name, token, err, tt.want)
+		}
+	}
+
+	// A keyring source runs secret-tool, found on PATH.
+	if runtime.GOOS == "darwin" {
+		return
+	}
+	bin := t.TempDir()
+	script := "#!/bin/sh\n[ \"$*\" = 'lookup service devproxy account me' ] && echo from-keyring || { echo 'no such item' >&2; exit 1; }\n"
+	if err := os.WriteFile(filepath.Join(bin, "secret-tool"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if token, err := (TokenSource{Keyring: &KeyringItem{Service: "devproxy", Account: "me"}}).Token(ctx, ""); token != "from-keyring" || err != nil {
+		t.Errorf("keyring: %q, %v", token, err)
+	}
+	if _, err := (TokenSource{Keyring: &KeyringItem{Service: "other"}}).Token(ctx, ""); err == nil || !strings.Contains(err.Error(), "keyring other: exit status 1: no such item") {
+		t.Errorf("missing keyring item: err = %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// Run executes a command and returns its complete output.
+func (c *Client) Run(ctx context.Context, req api.RunRequest) (*api.RunResponse, error) {
+	var resp api.RunResponse
+	if err := c.doJSON(ctx, http.MethodPost, "/run", true, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// OutputFunc receives command output as it is produced. stream is "stdout"
+// or "stderr". data is only valid until OutputFunc returns.
+type OutputFunc func(stream string, data []byte)
+
+// RunStream executes a command, calling out with its output as the server
+// produces it, and returns the exit code. Against a server that does not
+// stream, all output is delivered once the command finishes.
+func (c *Client) RunStream(ctx context.Context, req api.RunRequest, out OutputFunc) (int, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/run", true, req, api.StreamContentType+", application/json")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, newError(resp.StatusCode, body)
+	}
+
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != api.StreamContentType {
+		var rr api.RunResponse
+		if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil {
+			return 0, fmt.Errorf("failed to parse response: %v", err)
+		}
+		if rr.Stdout != "" {
+			out("stdout", []byte(rr.Stdout))
+		}
+		if rr.Stderr != "" {
+			out("stderr", []byte(rr.Stderr))
+		}
+		return rr.ExitCode, nil
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		var ev api.RunEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return 0, fmt.Errorf("failed to parse event: %v", err)
+		}
+		if ev.Done {
+			return ev.ExitCode, nil
+		}
+		if ev.Data != "" {
+			out(ev.Stream, []byte(ev.Data))
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read response: %v", err)
+	}
+	return 0, fmt.Errorf("stream ended before the command finished")
+}
@@ -0,0 +1,330 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// DefaultExcludes are the patterns devctl sync leaves out unless told
+// otherwise.
+var DefaultExcludes = []string{".git", "node_modules"}
+
+// modTimeWindow is how far apart two modification times may be and still
+// count as equal, since file systems store them with different precision.
+const modTimeWindow = time.Millisecond
+
+// SyncOptions configure Sync. Every field is optional.
+type SyncOptions struct {
+	// Exclude lists patterns of paths to leave alone on both sides, as
+	// described for api.Excluded.
+	Exclude []string
+	// Delete removes remote files and directories that do not exist
+	// locally. Excluded remote paths are never deleted.
+	Delete bool
+	// DryRun reports what would be done without changing anything.
+	DryRun bool
+	// ChunkSize is passed on to Push for files larger than one chunk.
+	ChunkSize int
+	// Report, if set, is called before each change with the operation
+	// ("mkdir", "copy" or "delete") and the relative path.
+	Report func(op, path string)
+}
+
+// SyncResult lists the relative paths a Sync changed, or would have.
+type SyncResult struct {
+	Created   []string
+	Copied    []string
+	Deleted   []string
+	Unchanged int
+	// Bytes is the total size of the copied files.
+	Bytes int64
+}
+
+// Manifest describes the tree under a directory on the server.
+func (c *Client) Manifest(ctx context.Context, req api.ManifestRequest) (*api.ManifestResponse, error) {
+	var resp api.ManifestResponse
+	if err := c.doJSON(ctx, http.MethodPost, "/files/manifest", true, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// localEntry is a file or directory found under the local directory.
+type localEntry struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// localManifest walks dir like the server builds a manifest: excluded
+// paths and symlinks are skipped.
+func localManifest(dir string, exclude []string) (map[string]localEntry, error) {
+	entries := map[string]localEntry{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if api.Excluded(rel, exclude) || d.Type()&fs.ModeSymlink != 0 {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e := localEntry{modTime: fi.ModTime(), isDir: fi.IsDir()}
+		if !e.isDir {
+			e.size = fi.Size()
+		}
+		entries[rel] = e
+		return nil
+	})
+	return entries, err
+}
+
+// remoteJoin appends the slash-separated rel to the remote directory dir,
+// using dir's separator.
+func remoteJoin(dir, rel string) string {
+	if strings.Contains(dir, `\`) {
+		return strings.TrimRight(dir, `\`) + `\` + strings.ReplaceAll(rel, "/", `\`)
+	}
+	return strings.TrimRight(dir, "/") + "/" + rel
+}
+
+func sameModTime(remote string, local time.Time) bool {
+	t, err := time.Parse(time.RFC3339Nano, remote)
+	if err != nil {
+		return false
+	}
+	d := t.Sub(local)
+	return d < modTimeWindow && d > -modTimeWindow
+}
+
+func hashLocal(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Sync makes remoteDir on the server mirror localDir. It compares the two
+// trees by manifest and copies only the files that are missing or differ:
+// a file with the same size and modification time on both sides is taken
+// as unchanged, and one with the same size but another time is compared by
+// SHA-256. Copied files keep their local modification time, so the next
+// Sync can skip them cheaply. A remote entry of the wrong kind (a file
+// where there is a local directory, or the reverse) is replaced.
+//
+// Sync stops at the first failure and returns what it did so far along
+// with the error.
+func (c *Client) Sync(ctx context.Context, localDir, remoteDir string, opts SyncOptions) (*SyncResult, error) {
+	if err := api.ValidateExcludes(opts.Exclude); err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(localDir); err != nil {
+		return nil, err
+	} else if !fi.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", localDir)
+	}
+	local, err := localManifest(localDir, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &SyncResult{}
+	remote := map[string]api.ManifestEntry{}
+	m, err := c.Manifest(ctx, api.ManifestRequest{Path: remoteDir, Exclude: opts.Exclude})
+	var apiErr *Error
+	switch {
+	case err == nil:
+		for _, e := range m.Entries {
+			remote[e.Path] = e
+		}
+	case errors.As(err, &apiErr) && apiErr.Code == api.CodeFileNotFound:
+		if !opts.DryRun {
+			if _, err := c.Mkdir(ctx, remoteDir, true); err != nil {
+				return res, err
+			}
+		}
+	default:
+		return res, err
+	}
+
+	paths := make([]string, 0, len(local))
+	for rel := range local {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+
+	var replace, dirs, copies, compare []string
+	for _, rel := range paths {
+		l := local[rel]
+		r, ok := remote[rel]
+		switch {
+		case ok && r.IsDir != l.isDir:
+			replace = append(replace, rel)
+			if l.isDir {
+				dirs = append(dirs, rel)
+			} else {
+				copies = append(copies, rel)
+			}
+		case !ok && l.isDir:
+			dirs = append(dirs, rel)
+		case !ok || r.Size != l.size:
+			copies = append(copies, rel)
+		case l.isDir:
+		case sameModTime(r.ModTime, l.modTime):
+			res.Unchanged++
+		default:
+			compare = append(compare, rel)
+		}
+	}
+
+	if len(compare) > 0 {
+		m, err := c.Manifest(ctx, api.ManifestRequest{Path: remoteDir, Paths: compare, Hash: true})
+		if err != nil {
+			return res, err
+		}
+		sums := map[string]string{}
+		for _, e := range m.Entries {
+			sums[e.Path] = e.SHA256
+		}
+		for _, rel := range compare {
+			sum, err := hashLocal(filepath.Join(localDir, filepath.FromSlash(rel)))
+			if err != nil {
+				return res, err
+			}
+			if sums[rel] == sum {
+				res.Unchanged++
+			} else {
+				copies = append(copies, rel)
+			}
+		}
+		sort.Strings(copies)
+	}
+
+	// Extraneous remote entries, leaving out those inside a directory
+	// that is deleted as a whole.
+	var extra []string
+	if opts.Delete {
+		gone := append([]string(nil), replace...)
+		remotePaths := make([]string, 0, len(remote))
+		for rel := range remote {
+			remotePaths = append(remotePaths, rel)
+		}
+		sort.Strings(remotePaths)
+		for _, rel := range remotePaths {
+			if _, ok := local[rel]; ok || insideAny(rel, gone) {
+				continue
+			}
+			extra = append(extra, rel)
+			gone = append(gone, rel)
+		}
+	}
+
+	report := func(op, rel string) {
+		if opts.Report != nil {
+			opts.Report(op, rel)
+		}
+	}
+	for _, rel := range replace {
+		report("delete", rel)
+		if !opts.DryRun {
+			if _, err := c.Delete(ctx, remoteJoin(remoteDir, rel), true); err != nil {
+				return res, fmt.Errorf("delete %s: %w", rel, err)
+			}
+		}
+		res.Deleted = append(res.Deleted, rel)
+	}
+	for _, rel := range dirs {
+		report("mkdir", rel)
+		if !opts.DryRun {
+			if _, err := c.Mkdir(ctx, remoteJoin(remoteDir, rel), true); err != nil {
+				return res, fmt.Errorf("mkdir %s: %w", rel, err)
+			}
+		}
+		res.Created = append(res.Created, rel)
+	}
+	for _, rel := range copies {
+		report("copy", rel)
+		if !opts.DryRun {
+			if err := c.syncFile(ctx, filepath.Join(localDir, filepath.FromSlash(rel)), remoteJoin(remoteDir, rel), opts); err != nil {
+				return res, fmt.Errorf("copy %s: %w", rel, err)
+			}
+		}
+		res.Copied = append(res.Copied, rel)
+		res.Bytes += local[rel].size
+	}
+	for _, rel := range extra {
+		report("delete", rel)
+		if !opts.DryRun {
+			if _, err := c.Delete(ctx, remoteJoin(remoteDir, rel), true); err != nil {
+				return res, fmt.Errorf("delete %s: %w", rel, err)
+			}
+		}
+		res.Deleted = append(res.Deleted, rel)
+	}
+	return res, nil
+}
+
+// insideAny reports whether rel is inside one of the directories dirs.
+func insideAny(rel string, dirs []string) bool {
+	for _, d := range dirs {
+		if strings.HasPrefix(rel, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// syncFile copies one file with its modification time: in a single write
+// if it fits in a chunk, or else with Push.
+func (c *Client) syncFile(ctx context.Context, local, remote string, opts SyncOptions) error {
+	fi, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	chunk := opts.ChunkSize
+	if chunk <= 0 {
+		chunk = DefaultChunkSize
+	}
+	if fi.Size() > int64(chunk) {
+		_, err := c.Push(ctx, local, remote, TransferOptions{ChunkSize: chunk, Parents: true, ModTime: fi.ModTime()})
+		return err
+	}
+	data, err := os.ReadFile(local)
+	if err != nil {
+		return err
+	}
+	_, err = c.WriteFile(ctx, remote, data, WriteOptions{Parents: true, ModTime: fi.ModTime()})
+	return err
+}
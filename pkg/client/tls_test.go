@@ -0,0 +1,86 @@
+package client
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseFingerprint(t *testing.T) {
+	sum := sha256.Sum256([]byte("cert"))
+	plain := fmt.Sprintf("%x", sum)
+	var pairs []string
+	for _, b := range sum {
+		pairs = append(pairs, fmt.Sprintf("%02X", b))
+	}
+	colons := strings.Join(pairs, ":")
+
+	for _, s := range []string{plain, colons, "sha256:" + plain, "SHA256:" + colons, "  " + colons + "\n"} {
+		got, err := ParseFingerprint(s)
+		if err != nil || string(got) != string(sum[:]) {
+			t.Errorf("ParseFingerprint(%q) = %x, %v; want %x", s, got, err, sum)
+		}
+	}
+	for _, s := range []string{"", plain[:62], plain + "00", "zz" + plain[2:], "sha1:" + plain} {
+		if _, err := ParseFingerprint(s); err == nil {
+			t.Errorf("ParseFingerprint(%q): no error", s)
+		}
+	}
+}
+
+func TestTLSFilesPin(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	sum := sha256.Sum256(ts.Certificate().Raw)
+
+	get := func(pin string) error {
+		tc, err := TLSFiles{Pin: pin}.Config()
+		if err != nil {
+			return err
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tc}}
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	if err := get(fmt.Sprintf("sha256:%X", sum)); err != nil {
+		t.Errorf("matching pin: %v", err)
+	}
+	sum[0] ^= 0xff
+	if err := get(fmt.Sprintf("%x", sum)); err == nil || !strings.Contains(err.Error(), "does not match the pin") {
+		t.Errorf("wrong pin: err = %v, want a mismatch", err)
+	}
+}
+
+func TestTLSFilesConfig(t *testing.T) {
+	if tc, err := (TLSFiles{}).Config(); tc != nil || err != nil {
+		t.Errorf("no files: %v, %v; want nil, nil", tc, err)
+	}
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		files   TLSFiles
+		wantErr string
+	}{
+		{"CA without PEM", TLSFiles{CAFile: notPEM}, "no PEM certificates"},
+		{"bad pin", TLSFiles{Pin: "abc"}, "invalid pin"},
+		{"certificate without key", TLSFiles{CertFile: notPEM}, "used together"},
+		{"key without certificate", TLSFiles{KeyFile: notPEM}, "used together"},
+	}
+	for _, tt := range tests {
+		if _, err := tt.files.Config(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want one containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// TokenEnv names the environment variable devctl reads the token from.
+const TokenEnv = "DEVPROXY_TOKEN"
+
+// ReadTokenFile reads a token from the file at path, ignoring surrounding
+// whitespace. Except on Windows, it refuses a file that other users may
+// read or write, as ssh does for private keys. On Windows the file's ACL is
+// not checked, so it is up to the caller to keep it private, for example
+// by storing it under the user's profile directory.
+func ReadTokenFile(path string) (string, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !fi.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", path)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0o077 != 0 {
+		return "", fmt.Errorf("%s is accessible by other users (mode %04o); run chmod 600 on it", path, fi.Mode().Perm())
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("%s is empty", path)
+	}
+	return token, nil
+}
+
+// helperToken asks a credential helper for the token of the server at
+// addr, using git's credential helper protocol. The helper is run with
+// "get" appended and is sent the server's protocol and host, or for a
+// socket or pipe its path, as key=value lines; it answers with
+// password=<token>. A helper starting with "!" is a shell command; a bare
+// name such as "pass" runs devproxy-credential-pass.
+func helperToken(ctx context.Context, helper, addr string) (string, error) {
+	var cmd *exec.Cmd
+	switch {
+	case strings.HasPrefix(helper, "!"):
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd", "/C", helper[1:]+" get")
+		} else {
+			cmd = exec.CommandContext(ctx, "sh", "-c", helper[1:]+" get")
+		}
+	default:
+		args := strings.Fields(helper)
+		if len(args) == 0 {
+			return "", fmt.Errorf("empty credential helper")
+		}
+		if !strings.ContainsAny(args[0], `/\`) {
+			args[0] = "devproxy-credential-" + args[0]
+		}
+		cmd = exec.CommandContext(ctx, args[0], append(args[1:], "get")...)
+	}
+
+	var input strings.Builder
+	if u, err := url.Parse(addr); err == nil && u.Scheme != "" {
+		fmt.Fprintf(&input, "protocol=%s\n", u.Scheme)
+		if u.Host != "" {
+			fmt.Fprintf(&input, "host=%s\n", u.Host)
+		}
+		if u.Host == "" && u.Path != "" {
+			fmt.Fprintf(&input, "path=%s\n", u.Path)
+		}
+	}
+	input.WriteString("\n")
+	cmd.Stdin = strings.NewReader(input.String())
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	sc := bufio.NewScanner(strings.NewReader(string(out)))
+	for sc.Scan() {
+		if token, ok := strings.CutPrefix(strings.TrimRight(sc.Text(), "\r"), "password="); ok {
+			return token, nil
+		}
+	}
+	return "", fmt.Errorf("helper gave no password")
+}
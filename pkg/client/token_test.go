@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestReadTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string, perm os.FileMode) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(data), perm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(p, perm); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	token, err := ReadTokenFile(write("good", "  s3cret\n", 0o600))
+	if err != nil || token != "s3cret" {
+		t.Errorf("ReadTokenFile = %q, %v; want s3cret", token, err)
+	}
+	if _, err := ReadTokenFile(write("empty", " \n", 0o600)); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("empty file: err = %v, want an error saying it is empty", err)
+	}
+	if _, err := ReadTokenFile(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("missing file: err = %v, want not exist", err)
+	}
+	if _, err := ReadTokenFile(dir); err == nil {
+		t.Error("directory: no error")
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	for _, perm := range []os.FileMode{0o644, 0o640, 0o602} {
+		p := write("open", "s3cret", perm)
+		if _, err := ReadTokenFile(p); err == nil || !strings.Contains(err.Error(), "chmod 600") {
+			t.Errorf("mode %04o: err = %v, want a refusal", perm, err)
+		}
+	}
+}
+
+func TestHelperToken(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell helpers")
+	}
+	tests := []struct {
+		name    string
+		helper  string
+		want    string
+		wantErr string
+	}{
+		{"password", "!f() { echo username=x; echo password=s3cret; }; f", "s3cret", ""},
+		{"crlf", `!f() { printf 'password=s3cret\r\n'; }; f`, "s3cret", ""},
+		{"get appended", `!f() { echo "password=$1"; }; f`, "get", ""},
+		{"request", `!f() { while read -r l && [ -n "$l" ]; do echo "password=$l"; done; }; f`, "protocol=https", ""},
+		{"no password", "!f() { echo username=x; }; f", "", "no password"},
+		{"fails", "!f() { echo locked >&2; exit 3; }; f", "", "locked"},
+		{"fails silently", "!false", "", "exit status 1"},
+		{"empty", " ", "", "empty credential helper"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := helperToken(context.Background(), tt.helper, "https://devbox:2223")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("helperToken = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	// A bare name runs devproxy-credential-<name> from PATH.
+	bin := t.TempDir()
+	script := "#!/bin/sh\ngrep '^host=' | sed 's/^host=/password=/'\n"
+	if err := os.WriteFile(filepath.Join(bin, "devproxy-credential-test"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if got, err := helperToken(context.Background(), "test", "https://devbox:2223"); err != nil || got != "devbox:2223" {
+		t.Errorf("named helper = %q, %v; want devbox:2223", got, err)
+	}
+}
@@ -0,0 +1,272 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// DefaultChunkSize is the size of the chunks Push sends.
+const DefaultChunkSize = 8 << 20
+
+// partSuffix is appended to the local path while Pull downloads into it.
+const partSuffix = ".devproxy-part"
+
+// TransferOptions configure Push and Pull. Every field is optional.
+type TransferOptions struct {
+	// ChunkSize is the size of the chunks Push sends. Defaults to
+	// DefaultChunkSize.
+	ChunkSize int
+	// ExpectedSHA256, Parents and ModTime apply to Push as in
+	// WriteOptions.
+	ExpectedSHA256 string
+	Parents        bool
+	ModTime        time.Time
+	// Progress, if set, is called as data is transferred with the bytes
+	// done so far and the total.
+	Progress func(done, total int64)
+}
+
+func uploadPath(id string, suffix string) string {
+	return "/files/uploads/" + url.PathEscape(id) + suffix
+}
+
+// StartUpload starts a resumable upload, or resumes the caller's
+// unfinished one for the same path, size and SHA-256.
+func (c *Client) StartUpload(ctx context.Context, req api.UploadRequest) (*api.Upload, error) {
+	var up api.Upload
+	if err := c.doJSON(ctx, http.MethodPost, "/files/uploads", true, req, &up); err != nil {
+		return nil, err
+	}
+	return &up, nil
+}
+
+// UploadStatus reports how much of an upload the server has received.
+func (c *Client) UploadStatus(ctx context.Context, id string) (*api.Upload, error) {
+	var up api.Upload
+	if err := c.doJSON(ctx, http.MethodGet, uploadPath(id, ""), true, nil, &up); err != nil {
+		return nil, err
+	}
+	return &up, nil
+}
+
+// UploadChunk sends data to be written at offset, which must equal the
+// upload's Received count.
+func (c *Client) UploadChunk(ctx context.Context, id string, offset int64, data []byte) (*api.Upload, error) {
+	var up api.Upload
+	p := uploadPath(id, "?offset="+strconv.FormatInt(offset, 10))
+	if err := c.doJSON(ctx, http.MethodPut, p, true, data, &up); err != nil {
+		return nil, err
+	}
+	return &up, nil
+}
+
+// CommitUpload verifies a complete upload and moves it into place.
+func (c *Client) CommitUpload(ctx context.Context, id string) (*api.FileInfo, error) {
+	var info api.FileInfo
+	if err := c.doJSON(ctx, http.MethodPost, uploadPath(id, "/commit"), true, nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// AbortUpload abandons an upload.
+func (c *Client) AbortUpload(ctx context.Context, id string) error {
+	var up api.Upload
+	return c.doJSON(ctx, http.MethodDelete, uploadPath(id, ""), true, nil, &up)
+}
+
+// Push uploads the local file to remote in chunks. A chunk that fails in
+// transit is resent from wherever the server says the upload stands, up to
+// Options.Retries times in a row. Running Push again for an unchanged file
+// after it gave up resumes the same upload, as long as the server has not
+// discarded it.
+func (c *Client) Push(ctx context.Context, local, remote string, opts TransferOptions) (*api.FileInfo, error) {
+	f, err := os.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", local)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	up, err := c.StartUpload(ctx, api.UploadRequest{
+		Path:           remote,
+		Size:           fi.Size(),
+		SHA256:         hex.EncodeToString(h.Sum(nil)),
+		ExpectedSHA256: opts.ExpectedSHA256,
+		Parents:        opts.Parents,
+		ModTime:        formatModTime(opts.ModTime),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	chunk := opts.ChunkSize
+	if chunk <= 0 {
+		chunk = DefaultChunkSize
+	}
+	buf := make([]byte, chunk)
+	failures := 0
+	for up.Received < up.Size {
+		if opts.Progress != nil {
+			opts.Progress(up.Received, up.Size)
+		}
+		n := int64(chunk)
+		if left := up.Size - up.Received; left < n {
+			n = left
+		}
+		if _, err := f.ReadAt(buf[:n], up.Received); err != nil && err != io.EOF {
+			return nil, err
+		}
+
+		next, err := c.UploadChunk(ctx, up.ID, up.Received, buf[:n])
+		if err == nil {
+			up = next
+			failures = 0
+			continue
+		}
+		// Other than an offset mismatch, a response from the server
+		// is final. Anything else may have delivered part of the chunk;
+		// ask how much.
+		var apiErr *Error
+		if (errors.As(err, &apiErr) && apiErr.Code != api.CodeOffsetMismatch) || ctx.Err() != nil {
+			return nil, err
+		}
+		if failures++; failures > c.opts.Retries {
+			return nil, err
+		}
+		if cur, serr := c.UploadStatus(ctx, up.ID); serr == nil {
+			up = cur
+		}
+	}
+	if opts.Progress != nil {
+		opts.Progress(up.Size, up.Size)
+	}
+
+	return c.CommitUpload(ctx, up.ID)
+}
+
+// Pull downloads remote to the local file. Data goes to local plus
+// ".devproxy-part" first and is renamed once its SHA-256 matches the remote
+// file's. A download cut short continues where it stopped, up to
+// Options.Retries times in a row; a later Pull picks up a part file left
+// behind. If the remote file changed in between, the hash check fails and
+// the part file is removed, so the next Pull starts over.
+func (c *Client) Pull(ctx context.Context, remote, local string, opts TransferOptions) (*api.FileInfo, error) {
+	info, err := c.Stat(ctx, remote, true)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir {
+		return nil, fmt.Errorf("%s is a directory", remote)
+	}
+
+	part := local + partSuffix
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	have, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if have > info.Size {
+		if err := f.Truncate(0); err != nil {
+			return nil, err
+		}
+		have = 0
+	}
+
+	failures := 0
+	for have < info.Size {
+		if opts.Progress != nil {
+			opts.Progress(have, info.Size)
+		}
+		r, err := c.OpenFile(ctx, remote, have, -1)
+		if err == nil {
+			var n int64
+			if _, err = f.Seek(have, io.SeekStart); err == nil {
+				n, err = io.Copy(&progressWriter{w: f, done: have, total: info.Size, fn: opts.Progress}, r)
+			}
+			r.Close()
+			if err == nil && n == 0 {
+				f.Close()
+				os.Remove(part)
+				return nil, fmt.Errorf("%s ends at %d bytes, short of the %d it had; it changed during the transfer", remote, have, info.Size)
+			}
+			have += n
+			if n > 0 {
+				failures = 0
+			}
+		}
+		if err != nil {
+			var apiErr *Error
+			if errors.As(err, &apiErr) || ctx.Err() != nil {
+				return nil, err
+			}
+			if failures++; failures > c.opts.Retries {
+				return nil, err
+			}
+		}
+	}
+	if opts.Progress != nil {
+		opts.Progress(info.Size, info.Size)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != info.SHA256 {
+		f.Close()
+		os.Remove(part)
+		return nil, fmt.Errorf("downloaded data has SHA-256 %s, not %s; %s changed during the transfer", sum, info.SHA256, remote)
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(part, local); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// progressWriter reports the running total of what is written through it.
+type progressWriter struct {
+	w           io.Writer
+	done, total int64
+	fn          func(done, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.done += int64(n)
+	if p.fn != nil {
+		p.fn(p.done, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+func TestPullRemoteShrank(t *testing.T) {
+	// The file is 10 bytes when stat'ed but has shrunk to 4 by the time
+	// it is read, so a read from offset 4 returns nothing.
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/files/stat"):
+			writeJSON(w, http.StatusOK, api.FileInfo{Path: "/r/f", Name: "f", Size: 10, SHA256: strings.Repeat("0", 64)})
+		case strings.HasSuffix(r.URL.Path, "/files/read"):
+			if r.Header.Get("Range") == "" {
+				w.Write([]byte("abcd"))
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	c := newTestClient(t, ts.URL, Options{Retries: 3, RetryWait: time.Millisecond})
+	local := filepath.Join(t.TempDir(), "f")
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Pull(context.Background(), "/r/f", local, TransferOptions{})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "changed during the transfer") {
+			t.Errorf("Pull: err = %v, want a changed-file error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Pull did not return")
+	}
+	if _, err := os.Stat(local + partSuffix); !os.IsNotExist(err) {
+		t.Errorf("part file left behind: %v", err)
+	}
+}
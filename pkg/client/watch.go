@@ -0,0 +1,63 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// Watch waits for the next batch of changes under req.Path, or for
+// req.TimeoutSeconds, and returns it. Pass the returned Cursor in the next
+// request to be told about changes made in between.
+func (c *Client) Watch(ctx context.Context, req api.WatchRequest) (*api.WatchResponse, error) {
+	var resp api.WatchResponse
+	if err := c.doJSON(ctx, http.MethodPost, "/files/watch", true, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// WatchStream calls fn with every change under req.Path as the server
+// reports it. It returns nil when req.TimeoutSeconds, if set, has passed,
+// and ctx.Err() once ctx is done.
+func (c *Client) WatchStream(ctx context.Context, req api.WatchRequest, fn func(api.WatchEvent)) error {
+	resp, err := c.do(ctx, http.MethodPost, "/files/watch", true, req, api.StreamContentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return newError(resp.StatusCode, body)
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != api.StreamContentType {
+		return fmt.Errorf("the server did not stream the watch (Content-Type %q)", mt)
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		var ev api.WatchEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return fmt.Errorf("failed to parse event: %v", err)
+		}
+		if ev.Type == api.WatchError {
+			return errors.New(ev.Error)
+		}
+		fn(ev)
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	return nil
+}
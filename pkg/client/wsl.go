@@ -0,0 +1,217 @@
+package client
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// WSL translates paths between a WSL distribution and the Windows host it
+// runs on, for a client in WSL talking to a server on Windows.
+type WSL struct {
+	// Distro is the distribution's name, used for \\wsl$\ paths. Without
+	// it only paths under Root are translated.
+	Distro string
+	// Root is where Windows drives are mounted, with a trailing slash:
+	// "/mnt/" unless /etc/wsl.conf says otherwise.
+	Root string
+
+	outputRE *regexp.Regexp
+}
+
+// DetectWSL returns a WSL for the distribution the program runs in, or nil
+// outside WSL. A Windows program started from WSL is detected only when
+// WSL_DISTRO_NAME is shared with it through WSLENV.
+func DetectWSL() *WSL {
+	distro := os.Getenv("WSL_DISTRO_NAME")
+	switch runtime.GOOS {
+	case "linux":
+		if distro == "" {
+			release, _ := os.ReadFile("/proc/sys/kernel/osrelease")
+			if !strings.Contains(strings.ToLower(string(release)), "microsoft") {
+				return nil
+			}
+		}
+		return NewWSL(distro, automountRoot("/etc/wsl.conf"))
+	case "windows":
+		if distro == "" {
+			return nil
+		}
+		return NewWSL(distro, "/mnt/")
+	}
+	return nil
+}
+
+// NewWSL returns a WSL for the named distribution with drives mounted
+// under root ("/mnt/" if empty).
+func NewWSL(distro, root string) *WSL {
+	if root == "" {
+		root = "/mnt/"
+	}
+	root = "/" + strings.Trim(root, "/") + "/"
+	if root == "//" {
+		root = "/"
+	}
+	// Windows paths end at whitespace, quotes, and the characters compilers
+	// put after them, such as "file.go:12:5" or "file.cs(12,5)".
+	tail := `[^\s"'<>|?*:;,()` + "`" + `]*`
+	expr := `\b([A-Za-z]):([\\/]` + tail + `)`
+	if distro != "" {
+		expr += `|\\\\wsl(?:\$|\.localhost)\\` + regexp.QuoteMeta(distro) + `(\\` + tail + `)?`
+	}
+	return &WSL{Distro: distro, Root: root, outputRE: regexp.MustCompile(`(?i)` + expr)}
+}
+
+// automountRoot reads the automount root from wsl.conf at path.
+func automountRoot(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	section := ""
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "[") {
+			section = strings.ToLower(strings.Trim(line, "[]"))
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if ok && section == "automount" && strings.TrimSpace(key) == "root" {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
+
+// drive returns the drive letter of an absolute WSL path under w.Root and
+// the rest of the path, starting with a slash unless empty.
+func (w *WSL) drive(p string) (letter, rest string, ok bool) {
+	if !strings.HasPrefix(p, w.Root) {
+		return "", "", false
+	}
+	p = p[len(w.Root):]
+	if len(p) == 0 || !isLetter(p[0]) || (len(p) > 1 && p[1] != '/') {
+		return "", "", false
+	}
+	return strings.ToUpper(p[:1]), p[1:], true
+}
+
+// ToWindows translates an absolute WSL path to Windows form: a drive path
+// for one under Root, and a \\wsl$\ path for any other. It reports false,
+// returning p unchanged, for a relative or already Windows path, or when
+// the distribution's name is unknown.
+func (w *WSL) ToWindows(p string) (string, bool) {
+	if !strings.HasPrefix(p, "/") {
+		return p, false
+	}
+	clean := "/" + strings.Trim(cleanSlashes(p), "/")
+	if letter, rest, ok := w.drive(clean + "/"); ok {
+		rest = strings.TrimSuffix(rest, "/")
+		if rest == "" {
+			rest = "/"
+		}
+		return letter + ":" + strings.ReplaceAll(rest, "/", `\`), true
+	}
+	if w.Distro == "" {
+		return p, false
+	}
+	if clean == "/" {
+		clean = ""
+	}
+	return `\\wsl$\` + w.Distro + strings.ReplaceAll(clean, "/", `\`), true
+}
+
+// ToWSL translates a Windows path to WSL form, the reverse of ToWindows.
+// It reports false, returning p unchanged, for any other path, including
+// the \\wsl$\ paths of other distributions.
+func (w *WSL) ToWSL(p string) (string, bool) {
+	if len(p) >= 3 && isLetter(p[0]) && p[1] == ':' && (p[2] == '\\' || p[2] == '/') {
+		rest := strings.TrimRight(strings.ReplaceAll(p[2:], `\`, "/"), "/")
+		return w.Root + strings.ToLower(p[:1]) + cleanSlashes(rest), true
+	}
+	if w.Distro == "" {
+		return p, false
+	}
+	for _, prefix := range []string{`\\wsl$\`, `\\wsl.localhost\`} {
+		if len(p) < len(prefix) || !strings.EqualFold(p[:len(prefix)], prefix) {
+			continue
+		}
+		distro, rest, _ := strings.Cut(p[len(prefix):], `\`)
+		if !strings.EqualFold(distro, w.Distro) {
+			return p, false
+		}
+		rest = strings.TrimRight(strings.ReplaceAll(rest, `\`, "/"), "/")
+		return "/" + cleanSlashes(rest), true
+	}
+	return p, false
+}
+
+// TranslateOutput rewrites the Windows paths in command output to WSL
+// form. Paths containing spaces are only translated up to the first one.
+func (w *WSL) TranslateOutput(s string) string {
+	return w.outputRE.ReplaceAllStringFunc(s, func(m string) string {
+		// A sentence ending in a path keeps its full stop.
+		trimmed := strings.TrimRight(m, ".")
+		if p, ok := w.ToWSL(trimmed); ok {
+			return p + m[len(trimmed):]
+		}
+		return m
+	})
+}
+
+// TranslateArg translates a command argument that looks like a WSL path:
+// an absolute path under Root, another absolute path that exists in the
+// distribution, or either as the value of a "-flag=path" argument. Other
+// arguments, such as the "/c" switch of cmd, are returned unchanged.
+func (w *WSL) TranslateArg(arg string) string {
+	if p, ok := w.translatePath(arg); ok {
+		return p
+	}
+	if strings.HasPrefix(arg, "-") {
+		if name, value, ok := strings.Cut(arg, "="); ok {
+			if p, ok := w.translatePath(value); ok {
+				return name + "=" + p
+			}
+		}
+	}
+	return arg
+}
+
+func (w *WSL) translatePath(p string) (string, bool) {
+	if !strings.HasPrefix(p, "/") {
+		return p, false
+	}
+	if _, _, ok := w.drive(cleanSlashes(p) + "/"); !ok {
+		// Outside the drives only a path that exists is taken for one,
+		// which a Windows program cannot check.
+		if runtime.GOOS == "windows" {
+			return p, false
+		}
+		if _, err := os.Lstat(p); err != nil {
+			return p, false
+		}
+	}
+	return w.ToWindows(p)
+}
+
+// cleanSlashes collapses repeated slashes and removes "." elements,
+// leaving ".." to the server's path checks.
+func cleanSlashes(p string) string {
+	parts := strings.Split(p, "/")
+	out := parts[:0]
+	for i, part := range parts {
+		if (part == "" && i > 0) || part == "." {
+			continue
+		}
+		out = append(out, part)
+	}
+	return strings.Join(out, "/")
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWSLToWindows(t *testing.T) {
+	w := NewWSL("Ubuntu", "")
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"/mnt/d/Projects/x", `D:\Projects\x`, true},
+		{"/mnt/c/Users/me/", `C:\Users\me`, true},
+		{"/mnt/d", `D:\`, true},
+		{"/mnt/d/", `D:\`, true},
+		{"/mnt/dd/x", `\\wsl$\Ubuntu\mnt\dd\x`, true},
+		{"/mnt", `\\wsl$\Ubuntu\mnt`, true},
+		{"/home/u//x/./y", `\\wsl$\Ubuntu\home\u\x\y`, true},
+		{"/", `\\wsl$\Ubuntu`, true},
+		{"rel/x", "rel/x", false},
+		{`C:\x`, `C:\x`, false},
+	}
+	for _, tt := range tests {
+		got, ok := w.ToWindows(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ToWindows(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// Without the distribution's name only drive paths translate.
+	nameless := NewWSL("", "/windir/")
+	if got, ok := nameless.ToWindows("/windir/c/x"); got != `C:\x` || !ok {
+		t.Errorf("ToWindows under a custom root = %q, %v", got, ok)
+	}
+	if got, ok := nameless.ToWindows("/home/u"); got != "/home/u" || ok {
+		t.Errorf("ToWindows without a distro = %q, %v", got, ok)
+	}
+}
+
+func TestWSLToWSL(t *testing.T) {
+	w := NewWSL("Ubuntu", "")
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{`D:\Projects\x`, "/mnt/d/Projects/x", true},
+		{`D:\`, "/mnt/d", true},
+		{`d:/a/b`, "/mnt/d/a/b", true},
+		{`C:\a\\b\.\c\`, "/mnt/c/a/b/c", true},
+		{`\\wsl$\Ubuntu\home\u`, "/home/u", true},
+		{`\\wsl.localhost\ubuntu`, "/", true},
+		{`\\WSL$\UBUNTU\etc\hosts`, "/etc/hosts", true},
+		{`\\wsl$\Debian\x`, `\\wsl$\Debian\x`, false},
+		{`\\server\share\x`, `\\server\share\x`, false},
+		{"C:", "C:", false},
+		{"relative\\x", "relative\\x", false},
+	}
+	for _, tt := range tests {
+		got, ok := w.ToWSL(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ToWSL(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWSLTranslateArg(t *testing.T) {
+	w := NewWSL("Ubuntu", "")
+	tests := []struct {
+		in, want string
+	}{
+		{"/mnt/c/src/main.go", `C:\src\main.go`},
+		{"-o=/mnt/c/out.exe", `-o=C:\out.exe`},
+		{"--flag=value", "--flag=value"},
+		{"/c", "/c"},
+		{"/nonexistent/devproxy/x", "/nonexistent/devproxy/x"},
+		{"-I=/nonexistent/devproxy", "-I=/nonexistent/devproxy"},
+		{"build", "build"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := w.TranslateArg(tt.in); got != tt.want {
+			t.Errorf("TranslateArg(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	// An existing path outside the drives is taken for one.
+	dir := t.TempDir()
+	want := `\\wsl$\Ubuntu` + strings.ReplaceAll(filepath.Clean(dir), "/", `\`)
+	if got := w.TranslateArg(dir); got != want {
+		t.Errorf("TranslateArg(%q) = %q, want %q", dir, got, want)
+	}
+	if got := w.TranslateArg("-C=" + dir); got != "-C="+want {
+		t.Errorf("TranslateArg(-C=%q) = %q, want -C=%q", dir, got, want)
+	}
+}
+
+func TestWSLTranslateOutput(t *testing.T) {
+	w := NewWSL("Ubuntu", "")
+	tests := []struct {
+		in, want string
+	}{
+		{
+			`D:\Projects\x\main.go:12:5: error in C:\Windows.`,
+			"/mnt/d/Projects/x/main.go:12:5: error in /mnt/c/Windows.",
+		},
+		{`E:/a/b(1,2): warning`, "/mnt/e/a/b(1,2): warning"},
+		{`"C:\src\a.cs", line 3`, `"/mnt/c/src/a.cs", line 3`},
+		{`see 'C:\x\y';`, `see '/mnt/c/x/y';`},
+		{`C:\My Documents\f`, `/mnt/c/My Documents\f`},
+		{`\\wsl$\Ubuntu\home\u\f.go:1: x`, "/home/u/f.go:1: x"},
+		{`\\wsl.localhost\Ubuntu`, "/"},
+		{`\\wsl$\Debian\home\f.go`, `\\wsl$\Debian\home\f.go`},
+		{"https://example.com/a:b", "https://example.com/a:b"},
+		{"no paths here", "no paths here"},
+		{"line 1\nC:\\a\nline 3\n", "line 1\n/mnt/c/a\nline 3\n"},
+	}
+	for _, tt := range tests {
+		if got := w.TranslateOutput(tt.in); got != tt.want {
+			t.Errorf("TranslateOutput(%q) =\n\t%q\nwant\n\t%q", tt.in, got, tt.want)
+		}
+	}
+}
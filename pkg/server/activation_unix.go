@@ -0,0 +1,36 @@
+//go:build !windows
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// activationListener returns the first socket passed by systemd socket
+// activation (LISTEN_FDS), or nil if the process was not socket-activated.
+func activationListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	// Passed descriptors start at 3 (SD_LISTEN_FDS_START).
+	f := os.NewFile(3, "systemd-socket")
+	ln, err := net.FileListener(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("socket activation: %v", err)
+	}
+	return ln, nil
+}
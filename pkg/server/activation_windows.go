@@ -0,0 +1,9 @@
+package server
+
+import "net"
+
+// activationListener always returns nil on Windows, which has no socket
+// activation.
+func activationListener() (net.Listener, error) {
+	return nil, nil
+}
@@ -0,0 +1,456 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// archiveFormat returns the format of an archive request, following the
+// archive's file name when none is given.
+func archiveFormat(format, name string) (string, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case format == api.ArchiveZip || format == api.ArchiveTarGz:
+		return format, nil
+	case format == "tgz":
+		return api.ArchiveTarGz, nil
+	case format != "":
+		return "", fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "unknown archive format '%s'; use zip or tar.gz", format)
+	case strings.HasSuffix(lower, ".zip"):
+		return api.ArchiveZip, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return api.ArchiveTarGz, nil
+	}
+	return "", fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "cannot tell the archive format of '%s'; set format to zip or tar.gz", name)
+}
+
+// limitWriter fails once more than n bytes are written through it.
+type limitWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > l.n {
+		return 0, fileErrorf(http.StatusRequestEntityTooLarge, api.CodeTooLarge, "archive would be larger than files.max_file_mb")
+	}
+	l.n -= int64(len(p))
+	return l.w.Write(p)
+}
+
+func (s *Server) handleFileArchive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req api.ArchiveRequest
+	err := decodeFileRequest(r, &req)
+	entry := fileEntry(r, req.Path)
+	entry.Target = req.Dest
+	cfg := s.Config()
+	var format string
+	if err == nil {
+		err = checkArchivePaths(cfg, req.Path, req.Dest)
+	}
+	if err == nil {
+		format, err = archiveFormat(req.Format, req.Dest)
+	}
+	if err == nil {
+		if err = api.ValidateExcludes(req.Exclude); err != nil {
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "%v", err)
+		}
+	}
+	var info api.FileInfo
+	if err == nil {
+		info, err = s.createArchive(cfg, req, format)
+	}
+	entry.Bytes = info.Size
+	if err != nil {
+		s.fileFail(w, r, entry, "archive", err)
+		return
+	}
+	s.fileDone(w, r, entry, "file_archive", info)
+}
+
+// checkArchivePaths applies the path policy to an archive's source and
+// destination.
+func checkArchivePaths(cfg api.Config, paths ...string) error {
+	for _, p := range paths {
+		if err := checkFilePath(cfg, p); err != nil {
+			return policyError(err)
+		}
+	}
+	return nil
+}
+
+// createArchive writes the archive to a temporary file next to req.Dest
+// and renames it into place once complete, like writeFile.
+func (s *Server) createArchive(cfg api.Config, req api.ArchiveRequest, format string) (api.FileInfo, error) {
+	src, dest := filepath.Clean(req.Path), filepath.Clean(req.Dest)
+	fi, err := os.Stat(src)
+	if err != nil {
+		return api.FileInfo{}, err
+	}
+	if err := replaceCheck(dest, req.Overwrite); err != nil {
+		return api.FileInfo{}, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".devproxy-*")
+	if err != nil {
+		return api.FileInfo{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	out := &limitWriter{w: io.MultiWriter(tmp, h), n: maxFileSize(cfg)}
+	// The archive may be inside the tree it packs; it must not pack
+	// itself.
+	skip := map[string]bool{tmp.Name(): true, dest: true}
+	if format == api.ArchiveZip {
+		err = writeZip(out, src, fi, req.Exclude, skip, cfg.Files.ArchiveMaxEntries)
+	} else {
+		err = writeTarGz(out, src, fi, req.Exclude, skip, cfg.Files.ArchiveMaxEntries)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = replaceCheck(dest, req.Overwrite)
+	}
+	if err == nil {
+		err = s.replaceFile(tmp.Name(), dest, "", time.Time{})
+	}
+	if err != nil {
+		return api.FileInfo{}, err
+	}
+	info, err := statFile(dest)
+	info.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return info, err
+}
+
+// archiveEntries calls fn for each entry to pack from src: everything
+// under a directory, or the file itself under its base name.
+func archiveEntries(src string, fi fs.FileInfo, exclude []string, skip map[string]bool, maxEntries int, fn func(name, full string, fi fs.FileInfo) error) error {
+	if !fi.IsDir() {
+		return fn(fi.Name(), src, fi)
+	}
+	n := 0
+	return walkTree(src, exclude, func(rel string, fi fs.FileInfo) error {
+		full := filepath.Join(src, filepath.FromSlash(rel))
+		if skip[full] || !(fi.IsDir() || fi.Mode().IsRegular()) {
+			return nil
+		}
+		if n++; n > maxEntries {
+			return fileErrorf(http.StatusRequestEntityTooLarge, api.CodeTooLarge,
+				"'%s' has more than files.archive_max_entries (%d) entries", src, maxEntries)
+		}
+		return fn(rel, full, fi)
+	})
+}
+
+func writeZip(w io.Writer, src string, fi fs.FileInfo, exclude []string, skip map[string]bool, maxEntries int) error {
+	zw := zip.NewWriter(w)
+	err := archiveEntries(src, fi, exclude, skip, maxEntries, func(name, full string, fi fs.FileInfo) error {
+		hdr, err := zip.FileInfoHeader(fi)
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if fi.IsDir() {
+			hdr.Name += "/"
+			_, err = zw.CreateHeader(hdr)
+			return err
+		}
+		hdr.Method = zip.Deflate
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		return copyFileTo(fw, full)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, src string, fi fs.FileInfo, exclude []string, skip map[string]bool, maxEntries int) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	err := archiveEntries(src, fi, exclude, skip, maxEntries, func(name, full string, fi fs.FileInfo) error {
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = name
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		// Owner names mean nothing on the machine the archive is
+		// unpacked on.
+		hdr.Uname, hdr.Gname = "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		return copyFileTo(tw, full)
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gw.Close()
+	}
+	return err
+}
+
+func copyFileTo(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// archiveEntry is an entry read from an archive. Regular files and
+// directories are unpacked; anything else is skipped.
+type archiveEntry struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	regular bool
+}
+
+// readArchive calls fn for each entry of the archive at path with a reader
+// for its contents.
+func readArchive(path, format string, fn func(e archiveEntry, r io.Reader) error) error {
+	if format == api.ArchiveZip {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "'%s' is not a valid zip archive: %v", path, err)
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			e := archiveEntry{
+				name:    f.Name,
+				size:    int64(f.UncompressedSize64),
+				modTime: f.Modified,
+				dir:     f.FileInfo().IsDir(),
+				regular: f.Mode().IsRegular(),
+			}
+			if e.size < 0 {
+				return fileErrorf(http.StatusRequestEntityTooLarge, api.CodeTooLarge, "entry '%s' is too large", f.Name)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "entry '%s' of '%s' cannot be read: %v", f.Name, path, err)
+			}
+			err = fn(e, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "'%s' is not a valid tar.gz archive: %v", path, err)
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "'%s' is not a valid tar.gz archive: %v", path, err)
+		}
+		e := archiveEntry{
+			name:    hdr.Name,
+			size:    hdr.Size,
+			modTime: hdr.ModTime,
+			dir:     hdr.Typeflag == tar.TypeDir,
+			regular: hdr.Typeflag == tar.TypeReg,
+		}
+		if err := fn(e, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// entryPath returns where the relative name, such as an archive entry or a
+// file in a diff, goes under dest, or a policy error if it would put it
+// anywhere else ("zip slip"). Backslashes count as separators, as Windows
+// tools write them. An empty name, such as "./", is dest itself.
+func entryPath(dest, name string) (string, error) {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	clean := path.Clean("/" + slashed)[1:]
+	switch {
+	case clean == "":
+		return dest, nil
+	case strings.HasPrefix(slashed, "/"), strings.HasPrefix(slashed, "../"), slashed == "..", strings.Contains(slashed, "/../"), strings.HasSuffix(slashed, "/.."),
+		filepath.VolumeName(filepath.FromSlash(slashed)) != "", runtime.GOOS == "windows" && strings.Contains(slashed, ":"):
+		return "", policyError(fmt.Errorf("'%s' would be outside '%s'", name, dest))
+	}
+	return filepath.Join(dest, filepath.FromSlash(clean)), nil
+}
+
+func (s *Server) handleFileExtract(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req api.ExtractRequest
+	err := decodeFileRequest(r, &req)
+	entry := fileEntry(r, req.Path)
+	entry.Target = req.Dest
+	cfg := s.Config()
+	var format string
+	if err == nil {
+		err = checkArchivePaths(cfg, req.Path, req.Dest)
+	}
+	if err == nil {
+		format, err = archiveFormat(req.Format, req.Path)
+	}
+	var resp api.ExtractResponse
+	if err == nil {
+		resp, err = s.extractArchive(cfg, req, format)
+	}
+	entry.Bytes = resp.Bytes
+	if err != nil {
+		s.fileFail(w, r, entry, "extract", err)
+		return
+	}
+	s.fileDone(w, r, entry, "file_extract", resp)
+}
+
+// extractArchive unpacks in two passes. The first reads only the entry
+// headers and refuses the whole archive if any entry would escape dest,
+// break the path policy, replace a file without Overwrite, or exceed the
+// limits. The second unpacks, counting the bytes actually written, since
+// headers can lie; an archive caught lying stops there, with the entries
+// before it already in place.
+func (s *Server) extractArchive(cfg api.Config, req api.ExtractRequest, format string) (api.ExtractResponse, error) {
+	src, dest := filepath.Clean(req.Path), filepath.Clean(req.Dest)
+	if fi, err := os.Stat(src); err != nil {
+		return api.ExtractResponse{}, err
+	} else if fi.IsDir() {
+		return api.ExtractResponse{}, fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "'%s' is a directory", src)
+	}
+	if fi, err := os.Stat(dest); err == nil && !fi.IsDir() {
+		return api.ExtractResponse{}, fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "'%s' is not a directory", dest)
+	}
+
+	maxTotal := int64(cfg.Files.ArchiveMaxMB) << 20
+	var entries int
+	var total int64
+	err := readArchive(src, format, func(e archiveEntry, _ io.Reader) error {
+		if entries++; entries > cfg.Files.ArchiveMaxEntries {
+			return fileErrorf(http.StatusRequestEntityTooLarge, api.CodeTooLarge,
+				"archive has more than files.archive_max_entries (%d) entries", cfg.Files.ArchiveMaxEntries)
+		}
+		full, err := entryPath(dest, e.name)
+		if err != nil || !(e.dir || e.regular) {
+			return err
+		}
+		if err := checkFilePath(cfg, full); err != nil {
+			return policyError(err)
+		}
+		if e.dir {
+			return nil
+		}
+		if total += e.size; e.size > maxFileSize(cfg) || total > maxTotal {
+			return fileErrorf(http.StatusRequestEntityTooLarge, api.CodeTooLarge,
+				"archive unpacks to more than files.archive_max_mb or has an entry over files.max_file_mb")
+		}
+		return replaceCheck(full, req.Overwrite)
+	})
+	if err != nil {
+		return api.ExtractResponse{}, err
+	}
+
+	resp := api.ExtractResponse{Path: dest}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return resp, err
+	}
+	err = readArchive(src, format, func(e archiveEntry, r io.Reader) error {
+		full, err := entryPath(dest, e.name)
+		switch {
+		case err != nil:
+			return err
+		case e.dir:
+			resp.Dirs++
+			return os.MkdirAll(full, 0755)
+		case !e.regular:
+			resp.Skipped = append(resp.Skipped, e.name)
+			return nil
+		}
+		limit := maxTotal - resp.Bytes
+		if max := maxFileSize(cfg); max < limit {
+			limit = max
+		}
+		_, n, err := s.writeFile(full, &limitReader{r: r, n: limit}, "", true, e.modTime)
+		resp.Bytes += n
+		resp.Files++
+		return err
+	})
+	return resp, err
+}
+
+// limitReader fails once more than n bytes are read through it.
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errArchiveTooLarge()
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		// Checked now rather than on the next Read, which a reader
+		// returning its last bytes with io.EOF never gets.
+		return n + int(l.n), errArchiveTooLarge()
+	}
+	return n, err
+}
+
+func errArchiveTooLarge() error {
+	return fileErrorf(http.StatusRequestEntityTooLarge, api.CodeTooLarge,
+		"archive unpacks to more than its headers say, past files.archive_max_mb or files.max_file_mb")
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// writeTestZip writes a zip with the given entries; names ending in / are
+// directories.
+func writeTestZip(t *testing.T, path string, entries map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range entries {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(data))
+	}
+	zw.Close()
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	dir := cfg.AllowedPaths[0]
+	src := filepath.Join(dir, "src")
+	files := map[string]string{
+		"main.go":       "package main\n",
+		"pkg/util.go":   "package pkg\n",
+		".git/HEAD":     "ref\n",
+		"pkg/empty/":    "",
+		"pkg/notes.log": "log\n",
+	}
+	for name, data := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if name[len(name)-1] == '/' {
+			os.MkdirAll(p, 0755)
+			continue
+		}
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, []byte(data), 0644)
+	}
+
+	for _, format := range []string{"zip", "tar.gz"} {
+		archive := filepath.Join(dir, "out."+format)
+		// The archive goes inside the tree it packs, and must not
+		// contain itself.
+		inside := filepath.Join(src, "self."+format)
+		for _, dest := range []string{archive, inside} {
+			body := `{"path":` + mustJSON(src) + `,"dest":` + mustJSON(dest) + `,"exclude":[".git","*.log"]}`
+			resp, data := request(t, ts, "POST", "/v1/files/archive", cfg.APIToken, body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("%s archive: %d %s", format, resp.StatusCode, data)
+			}
+		}
+		resp, data := request(t, ts, "POST", "/v1/files/archive", cfg.APIToken,
+			`{"path":`+mustJSON(src)+`,"dest":`+mustJSON(archive)+`}`)
+		if resp.StatusCode != http.StatusConflict || errorCode(t, data) != api.CodeFileExists {
+			t.Errorf("%s archive over an existing file: %d %s", format, resp.StatusCode, data)
+		}
+
+		out := filepath.Join(dir, "unpacked-"+format)
+		resp, data = request(t, ts, "POST", "/v1/files/extract", cfg.APIToken,
+			`{"path":`+mustJSON(inside)+`,"dest":`+mustJSON(out)+`}`)
+		os.Remove(inside)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s extract: %d %s", format, resp.StatusCode, data)
+		}
+		var er api.ExtractResponse
+		json.Unmarshal(data, &er)
+		if er.Files != 2 || er.Dirs != 2 {
+			t.Errorf("%s extract: %+v, want 2 files and 2 dirs", format, er)
+		}
+		for name, data := range files {
+			got, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(name)))
+			switch {
+			case name == ".git/HEAD" || name == "pkg/notes.log":
+				if err == nil {
+					t.Errorf("%s: excluded %s was packed", format, name)
+				}
+			case name == "pkg/empty/":
+				if fi, err := os.Stat(filepath.Join(out, "pkg", "empty")); err != nil || !fi.IsDir() {
+					t.Errorf("%s: empty directory not packed", format)
+				}
+			case string(got) != data:
+				t.Errorf("%s: %s = %q, want %q", format, name, got, data)
+			}
+		}
+
+		resp, data = request(t, ts, "POST", "/v1/files/extract", cfg.APIToken,
+			`{"path":`+mustJSON(archive)+`,"dest":`+mustJSON(out)+`}`)
+		if resp.StatusCode != http.StatusConflict || errorCode(t, data) != api.CodeFileExists {
+			t.Errorf("%s extract over existing files: %d %s", format, resp.StatusCode, data)
+		}
+	}
+}
+
+func TestExtractRefusesEscapes(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	dir := cfg.AllowedPaths[0]
+	outside := t.TempDir()
+
+	tests := []struct {
+		name  string
+		entry string
+	}{
+		{"parent", "../evil.txt"},
+		{"nested parent", "a/../../evil.txt"},
+		{"backslash parent", `..\evil.txt`},
+		{"absolute", "/tmp/evil.txt"},
+	}
+	for _, tt := range tests {
+		archive := filepath.Join(dir, "slip.zip")
+		writeTestZip(t, archive, map[string]string{"ok.txt": "fine", tt.entry: "evil"})
+		dest := filepath.Join(dir, "out")
+		resp, data := request(t, ts, "POST", "/v1/files/extract", cfg.APIToken,
+			`{"path":`+mustJSON(archive)+`,"dest":`+mustJSON(dest)+`}`)
+		if resp.StatusCode != http.StatusForbidden || errorCode(t, data) != api.CodePolicyViolation {
+			t.Errorf("%s: %d %s, want 403 policy_violation", tt.name, resp.StatusCode, data)
+		}
+		if _, err := os.Stat(filepath.Join(dest, "ok.txt")); err == nil {
+			t.Errorf("%s: entries were unpacked from a refused archive", tt.name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil.txt")); err == nil {
+		t.Error("an entry escaped the destination")
+	}
+
+	if runtime.GOOS != "windows" {
+		// A symlink already in the destination does not lead outside.
+		dest := filepath.Join(dir, "linked")
+		os.MkdirAll(dest, 0755)
+		if err := os.Symlink(outside, filepath.Join(dest, "link")); err != nil {
+			t.Fatal(err)
+		}
+		archive := filepath.Join(dir, "link.zip")
+		writeTestZip(t, archive, map[string]string{"link/evil.txt": "evil"})
+		resp, data := request(t, ts, "POST", "/v1/files/extract", cfg.APIToken,
+			`{"path":`+mustJSON(archive)+`,"dest":`+mustJSON(dest)+`}`)
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("through symlink: %d %s, want 403", resp.StatusCode, data)
+		}
+		if _, err := os.Stat(filepath.Join(outside, "evil.txt")); err == nil {
+			t.Error("an entry was written through a symlink")
+		}
+	}
+
+	// Symlinks in an archive are skipped, not created.
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: outside})
+	tw.WriteHeader(&tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Size: 1, Mode: 0644})
+	tw.Write([]byte("a"))
+	tw.Close()
+	gw.Close()
+	archive := filepath.Join(dir, "links.tar.gz")
+	os.WriteFile(archive, buf.Bytes(), 0644)
+	dest := filepath.Join(dir, "fromtar")
+	resp, data := request(t, ts, "POST", "/v1/files/extract", cfg.APIToken,
+		`{"path":`+mustJSON(archive)+`,"dest":`+mustJSON(dest)+`}`)
+	var er api.ExtractResponse
+	json.Unmarshal(data, &er)
+	if resp.StatusCode != http.StatusOK || er.Files != 1 || len(er.Skipped) != 1 {
+		t.Errorf("archive with a symlink: %d %s", resp.StatusCode, data)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "link")); err == nil {
+		t.Error("a symlink was unpacked")
+	}
+}
+
+func TestExtractLimits(t *testing.T) {
+	ts, cfg := newTestServer(t, func(cfg *api.Config) {
+		cfg.Files.ArchiveMaxEntries = 3
+		cfg.Files.ArchiveMaxMB = 1
+	})
+	dir := cfg.AllowedPaths[0]
+
+	tests := []struct {
+		name    string
+		entries map[string]string
+	}{
+		{"too many entries", map[string]string{"a": "", "b": "", "c": "", "d": ""}},
+		{"too large unpacked", map[string]string{"big": string(make([]byte, 1<<20+1))}},
+	}
+	for _, tt := range tests {
+		archive := filepath.Join(dir, "bomb.zip")
+		writeTestZip(t, archive, tt.entries)
+		resp, data := request(t, ts, "POST", "/v1/files/extract", cfg.APIToken,
+			`{"path":`+mustJSON(archive)+`,"dest":`+mustJSON(filepath.Join(dir, "out"))+`}`)
+		if resp.StatusCode != http.StatusRequestEntityTooLarge || errorCode(t, data) != api.CodeTooLarge {
+			t.Errorf("%s: %d %s, want 413 too_large", tt.name, resp.StatusCode, data)
+		}
+	}
+
+	resp, data := request(t, ts, "POST", "/v1/files/archive", cfg.APIToken,
+		`{"path":`+mustJSON(dir)+`,"dest":`+mustJSON(filepath.Join(t.TempDir(), "x.zip"))+`}`)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("archive outside allowed paths: %d %s", resp.StatusCode, data)
+	}
+}
+
+func TestLimitReader(t *testing.T) {
+	for _, tt := range []struct {
+		data  string
+		limit int64
+		ok    bool
+	}{
+		{"12345", 5, true},
+		{"12345", 4, false},
+		{"", 0, true},
+	} {
+		_, err := io.ReadAll(&limitReader{r: strings.NewReader(tt.data), n: tt.limit})
+		if (err == nil) != tt.ok {
+			t.Errorf("%q with limit %d: %v", tt.data, tt.limit, err)
+		}
+		// A reader may return its last bytes together with io.EOF.
+		got, err := io.ReadAll(&limitReader{r: iotest.DataErrReader(strings.NewReader(tt.data)), n: tt.limit})
+		if (err == nil) != tt.ok {
+			t.Errorf("%q with limit %d, data with EOF: %v", tt.data, tt.limit, err)
+		}
+		if int64(len(got)) > tt.limit {
+			t.Errorf("%q with limit %d: read %d bytes", tt.data, tt.limit, len(got))
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// clientAllowed reports whether a TCP client may connect. Loopback clients
+// are always allowed; anyone else must match allowed_clients. Connections
+// over Unix sockets and named pipes are checked by the listener instead.
+func clientAllowed(cfg api.Config, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return true
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+
+	nets, err := api.ParseClientNets(cfg.AllowedClients)
+	if err != nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientFilter rejects requests from addresses outside allowed_clients
+// before any handler, including the unauthenticated health checks, runs.
+func (s *Server) clientFilter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !clientAllowed(s.Config(), r.RemoteAddr) {
+			s.log(r.Context(), api.LogEntry{
+				Timestamp: time.Now().Format(time.RFC3339),
+				IP:        r.RemoteAddr,
+				Status:    "client_rejected",
+				Reason:    "Client address is not in allowed_clients",
+			})
+			writeError(w, http.StatusForbidden, api.CodeClientNotAllowed, "Client address is not in allowed_clients", nil)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logExposure warns at startup when the API is reachable off-host.
+func (s *Server) logExposure(cfg api.Config, addr string) {
+	if cfg.Listen.Network != "" && cfg.Listen.Network != "tcp" {
+		return
+	}
+	host, err := api.ResolveBindHost(cfg.Bind)
+	if err != nil || api.IsLoopbackHost(host) {
+		return
+	}
+	s.log(context.Background(), api.LogEntry{
+		Timestamp: time.Now().Format(time.RFC3339),
+		IP:        "system",
+		Status:    "non_loopback_bind",
+		Reason:    fmt.Sprintf("Listening on %s for clients in %s", addr, strings.Join(cfg.AllowedClients, ", ")),
+	})
+}
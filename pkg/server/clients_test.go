@@ -0,0 +1,47 @@
+package server
+
+import (
+	"testing"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+func TestClientAllowed(t *testing.T) {
+	cfg := api.Config{AllowedClients: []string{"10.0.0.0/8", "192.168.1.7", "fd00::/8"}}
+	tests := []struct {
+		remote string
+		want   bool
+	}{
+		{"10.1.2.3:5000", true},
+		{"[::ffff:10.1.2.3]:5000", true},
+		{"11.0.0.1:5000", false},
+		{"192.168.1.7:5000", true},
+		{"[::ffff:192.168.1.7]:5000", true},
+		{"192.168.1.8:5000", false},
+		{"[fd12::1]:5000", true},
+		{"[2001:db8::1]:5000", false},
+		{"127.0.0.1:5000", true},
+		{"[::1]:5000", true},
+		{"[::ffff:127.0.0.1]:5000", true},
+		// Local transports report an account rather than an address.
+		{"unix:uid=1000", true},
+		{"pipe:user=alice", true},
+	}
+	for _, tt := range tests {
+		if got := clientAllowed(cfg, tt.remote); got != tt.want {
+			t.Errorf("clientAllowed(%q) = %v, want %v", tt.remote, got, tt.want)
+		}
+	}
+
+	// Without an allowlist only loopback clients get in; with a malformed
+	// one nothing but loopback does.
+	for _, clients := range [][]string{nil, {"10.0.0.0/8", "bogus"}} {
+		cfg := api.Config{AllowedClients: clients}
+		if clientAllowed(cfg, "10.1.2.3:5000") {
+			t.Errorf("allowed_clients %v: 10.1.2.3 allowed", clients)
+		}
+		if !clientAllowed(cfg, "127.0.0.1:5000") {
+			t.Errorf("allowed_clients %v: loopback refused", clients)
+		}
+	}
+}
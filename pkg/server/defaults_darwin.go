@@ -0,0 +1,23 @@
+package server
+
+import "strings"
+
+// restrictedPaths may never appear in command arguments, even beneath an
+// allowed path.
+var restrictedPaths = []string{
+	"/System",
+	"/Library",
+	"/usr",
+	"/bin",
+	"/sbin",
+	"/etc",
+	"/private/etc",
+	"/private/var/db",
+	"/var/root",
+}
+
+// foldPath normalizes a path for prefix comparison. APFS is
+// case-insensitive by default.
+func foldPath(p string) string {
+	return strings.ToLower(p)
+}
@@ -0,0 +1,18 @@
+package server
+
+import "strings"
+
+// restrictedPaths may never appear in command arguments, even beneath an
+// allowed path.
+var restrictedPaths = []string{
+	"C:\\Windows",
+	"C:\\Program Files",
+	"C:\\Program Files (x86)",
+	"C:\\ProgramData",
+	"C:\\System",
+}
+
+// foldPath normalizes a path for prefix comparison. NTFS is case-insensitive.
+func foldPath(p string) string {
+	return strings.ToLower(p)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// Executor runs a command that has passed validation, writing its output
+// to stdout and stderr as it is produced. The writers passed by the Server
+// are safe for concurrent use. Run must return promptly once ctx is
+// cancelled, stopping whatever it started; the Server cancels ctx only when
+// a shutdown grace period expires.
+type Executor interface {
+	Run(ctx context.Context, req api.RunRequest, stdout, stderr io.Writer) RunResult
+}
+
+// RunResult is the outcome of a run.
+type RunResult struct {
+	ExitCode int
+	// Aborted is set when the run was stopped because ctx was cancelled.
+	Aborted bool
+}
+
+// ProcessExecutor runs commands as child processes of the server. On
+// cancellation it kills the whole process tree.
+type ProcessExecutor struct {
+	// Printf, if set, reports a failure to kill a process tree.
+	Printf func(format string, args ...interface{})
+}
+
+func (e ProcessExecutor) Run(ctx context.Context, req api.RunRequest, stdout, stderr io.Writer) RunResult {
+	ctx, span := tracer.Start(ctx, "devproxy.execute", trace.WithAttributes(
+		attribute.String("devproxy.command", req.Command),
+		attribute.StringSlice("devproxy.args", req.Args),
+	))
+	defer span.End()
+
+	cmd := exec.Command(req.Command, req.Args...)
+	cmd.Dir = req.CWD
+	prepareCommand(cmd)
+
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	_, startSpan := tracer.Start(ctx, "devproxy.process_start")
+	if err := cmd.Start(); err != nil {
+		startSpan.SetStatus(codes.Error, err.Error())
+		startSpan.End()
+		span.SetStatus(codes.Error, err.Error())
+		io.WriteString(stderr, err.Error())
+		return RunResult{ExitCode: 1}
+	}
+	startSpan.SetAttributes(attribute.Int("process.pid", cmd.Process.Pid))
+	startSpan.End()
+
+	var aborted atomic.Bool
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			aborted.Store(true)
+			if err := killProcessTree(cmd); err != nil {
+				if e.Printf != nil {
+					e.Printf("Failed to kill process tree of pid %d: %v", cmd.Process.Pid, err)
+				}
+			}
+		case <-done:
+		}
+	}()
+
+	err := cmd.Wait()
+	close(done)
+	exitCode := 0
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			exitCode = exitErr.ExitCode()
+		} else {
+			exitCode = 1
+		}
+	}
+	span.SetAttributes(attribute.Int("process.exit_code", exitCode))
+	if exitCode != 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("exit code %d", exitCode))
+	}
+	if aborted.Load() {
+		span.SetStatus(codes.Error, "aborted by shutdown")
+	}
+
+	return RunResult{ExitCode: exitCode, Aborted: aborted.Load()}
+}
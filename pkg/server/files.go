@@ -0,0 +1,606 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// fileError is a /files failure with its HTTP status and error code.
+// Errors from the os package are mapped by fileErrorStatus instead.
+type fileError struct {
+	status  int
+	code    string
+	msg     string
+	details interface{}
+}
+
+func (e *fileError) Error() string {
+	return e.msg
+}
+
+func fileErrorf(status int, code, format string, args ...interface{}) error {
+	return &fileError{status: status, code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+func policyError(err error) error {
+	return &fileError{status: http.StatusForbidden, code: api.CodePolicyViolation, msg: err.Error()}
+}
+
+// fileErrorStatus returns the status, code and details to report err with.
+func fileErrorStatus(err error) (int, string, interface{}) {
+	var fe *fileError
+	switch {
+	case errors.As(err, &fe):
+		return fe.status, fe.code, fe.details
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound, api.CodeFileNotFound, nil
+	case errors.Is(err, fs.ErrExist):
+		return http.StatusConflict, api.CodeFileExists, nil
+	default:
+		return http.StatusInternalServerError, api.CodeIOError, nil
+	}
+}
+
+// fileEntry starts the audit entry for a /files request.
+func fileEntry(r *http.Request, path string) api.LogEntry {
+	return api.LogEntry{
+		Timestamp: time.Now().Format(time.RFC3339),
+		IP:        r.RemoteAddr,
+		Path:      path,
+	}
+}
+
+// fileDone logs a successful operation under status and sends v.
+func (s *Server) fileDone(w http.ResponseWriter, r *http.Request, entry api.LogEntry, status string, v interface{}) {
+	entry.Status = status
+	s.log(r.Context(), entry)
+	writeJSON(w, http.StatusOK, v)
+}
+
+// fileFail logs a failed operation as file_rejected (policy) or file_failed
+// and sends the error.
+func (s *Server) fileFail(w http.ResponseWriter, r *http.Request, entry api.LogEntry, op string, err error) {
+	status, code, details := fileErrorStatus(err)
+	entry.Status = "file_failed"
+	if code == api.CodePolicyViolation {
+		entry.Status = "file_rejected"
+	}
+	entry.Reason = op + ": " + err.Error()
+	s.log(r.Context(), entry)
+	writeError(w, status, code, err.Error(), details)
+}
+
+// statFile describes path. A symlink is described by its target, with
+// IsSymlink set; a dangling one by the link itself.
+func statFile(path string) (api.FileInfo, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return api.FileInfo{}, err
+	}
+	link := fi.Mode()&os.ModeSymlink != 0
+	if link {
+		if target, err := os.Stat(path); err == nil {
+			fi = target
+		}
+	}
+	return api.FileInfo{
+		Path:      path,
+		Name:      fi.Name(),
+		Size:      fi.Size(),
+		Mode:      fi.Mode().String(),
+		ModTime:   fi.ModTime().UTC().Format(time.RFC3339Nano),
+		IsDir:     fi.IsDir(),
+		IsSymlink: link,
+	}, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// queryPath returns the path query parameter after the path policy check.
+func queryPath(r *http.Request, cfg api.Config) (string, error) {
+	path := r.URL.Query().Get("path")
+	if err := checkFilePath(cfg, path); err != nil {
+		return path, policyError(err)
+	}
+	return filepath.Clean(path), nil
+}
+
+func decodeFileRequest(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: %v", err)
+	}
+	return nil
+}
+
+func queryBool(r *http.Request, name string) bool {
+	b, _ := strconv.ParseBool(r.URL.Query().Get(name))
+	return b
+}
+
+func (s *Server) handleFileStat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	path, err := queryPath(r, s.Config())
+	entry := fileEntry(r, path)
+	if err != nil {
+		s.fileFail(w, r, entry, "stat", err)
+		return
+	}
+
+	info, err := statFile(path)
+	if err == nil && !info.IsDir && queryBool(r, "hash") {
+		info.SHA256, err = hashFile(path)
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "stat", err)
+		return
+	}
+	s.fileDone(w, r, entry, "file_stat", info)
+}
+
+func (s *Server) handleFileList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	path, err := queryPath(r, s.Config())
+	entry := fileEntry(r, path)
+	if err != nil {
+		s.fileFail(w, r, entry, "list", err)
+		return
+	}
+
+	if info, err := statFile(path); err != nil {
+		s.fileFail(w, r, entry, "list", err)
+		return
+	} else if !info.IsDir {
+		s.fileFail(w, r, entry, "list", fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "'%s' is not a directory", path))
+		return
+	}
+	dirents, err := os.ReadDir(path)
+	if err != nil {
+		s.fileFail(w, r, entry, "list", err)
+		return
+	}
+
+	resp := api.ListResponse{Path: path, Entries: []api.FileInfo{}}
+	for _, d := range dirents {
+		// An entry removed since ReadDir is simply left out.
+		if info, err := statFile(filepath.Join(path, d.Name())); err == nil {
+			resp.Entries = append(resp.Entries, info)
+		}
+	}
+	s.fileDone(w, r, entry, "file_list", resp)
+}
+
+func (s *Server) handleFileRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+	path, err := queryPath(r, s.Config())
+	entry := fileEntry(r, path)
+	if err != nil {
+		s.fileFail(w, r, entry, "read", err)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		s.fileFail(w, r, entry, "read", err)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		s.fileFail(w, r, entry, "read", err)
+		return
+	}
+	if fi.IsDir() {
+		s.fileFail(w, r, entry, "read", fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "'%s' is a directory", path))
+		return
+	}
+	start, length, partial, err := parseRange(r.Header.Get("Range"), fi.Size())
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", fi.Size()))
+		s.fileFail(w, r, entry, "read", err)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Length", strconv.FormatInt(length, 10))
+	h.Set("Accept-Ranges", "bytes")
+	h.Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+	status := http.StatusOK
+	if partial {
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, fi.Size()))
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+	n, err := io.Copy(w, io.NewSectionReader(f, start, length))
+
+	entry.Bytes = n
+	entry.Status = "file_read"
+	if err != nil {
+		// The status line is gone; all that is left is the audit log.
+		entry.Status = "file_failed"
+		entry.Reason = "read: " + err.Error()
+	}
+	s.log(r.Context(), entry)
+}
+
+// parseRange parses a single-range Range header against a file of size
+// bytes. Without a header the whole file is returned with partial unset.
+func parseRange(header string, size int64) (start, length int64, partial bool, err error) {
+	if header == "" {
+		return 0, size, false, nil
+	}
+	invalid := fileErrorf(http.StatusRequestedRangeNotSatisfiable, api.CodeInvalidRange, "invalid range %q for a file of %d bytes", header, size)
+
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, false, invalid
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, false, invalid
+	}
+
+	if first == "" {
+		// bytes=-n: the last n bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false, invalid
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false, invalid
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, invalid
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, true, nil
+}
+
+func (s *Server) handleFileWrite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeMethodNotAllowed(w, http.MethodPut)
+		return
+	}
+	cfg := s.Config()
+	path, err := queryPath(r, cfg)
+	entry := fileEntry(r, path)
+	if err != nil {
+		s.fileFail(w, r, entry, "write", err)
+		return
+	}
+
+	modTime, err := parseModTime(r.URL.Query().Get("mod_time"))
+	if err != nil {
+		s.fileFail(w, r, entry, "write", err)
+		return
+	}
+
+	info, n, err := s.writeFile(path, http.MaxBytesReader(w, r.Body, maxFileSize(cfg)),
+		r.URL.Query().Get("expected_sha256"), queryBool(r, "parents"), modTime)
+	entry.Bytes = n
+	if err != nil {
+		s.fileFail(w, r, entry, "write", err)
+		return
+	}
+	s.fileDone(w, r, entry, "file_write", info)
+}
+
+// writeFile replaces path with the contents of body. The data goes to a
+// temporary file in the same directory first, which is renamed over path
+// only once it is complete, so readers never see a partial file. The
+// expected hash is checked just before the rename.
+func (s *Server) writeFile(path string, body io.Reader, expected string, parents bool, modTime time.Time) (api.FileInfo, int64, error) {
+	dir := filepath.Dir(path)
+	if parents {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return api.FileInfo{}, 0, err
+		}
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".devproxy-*")
+	if err != nil {
+		return api.FileInfo{}, 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), body)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			err = fileErrorf(http.StatusRequestEntityTooLarge, api.CodeTooLarge, "file is larger than %d bytes", maxErr.Limit)
+		}
+		return api.FileInfo{}, n, err
+	}
+
+	if err := s.replaceFile(tmp.Name(), path, expected, modTime); err != nil {
+		return api.FileInfo{}, n, err
+	}
+	info, err := statFile(path)
+	info.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return info, n, err
+}
+
+// replaceFile renames the complete file tmp, which must be in the same
+// directory, over path once the expected hash precondition holds. An
+// existing file keeps its permissions. A non-zero modTime is set on the new
+// file.
+func (s *Server) replaceFile(tmp, path, expected string, modTime time.Time) error {
+	s.filesMu.Lock()
+	defer s.filesMu.Unlock()
+	return replaceFileLocked(tmp, path, expected, modTime)
+}
+
+// replaceFileLocked is replaceFile for callers that hold filesMu.
+func replaceFileLocked(tmp, path, expected string, modTime time.Time) error {
+	mode := os.FileMode(0644)
+	existing, err := os.Stat(path)
+	switch {
+	case err == nil && existing.IsDir():
+		return fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "'%s' is a directory", path)
+	case err == nil:
+		mode = existing.Mode().Perm()
+	case !errors.Is(err, fs.ErrNotExist):
+		return err
+	}
+	if err := checkExpectedHash(path, expected, existing != nil); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp, mode); err != nil {
+		return err
+	}
+	if !modTime.IsZero() {
+		if err := os.Chtimes(tmp, modTime, modTime); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp, path)
+}
+
+// parseModTime parses the optional mod_time of a write or upload.
+func parseModTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "mod_time must be an RFC 3339 time: %v", err)
+	}
+	return t, nil
+}
+
+// maxFileSize is files.max_file_mb in bytes.
+func maxFileSize(cfg api.Config) int64 {
+	return int64(cfg.Files.MaxFileMB) << 20
+}
+
+// checkExpectedHash enforces the expected_sha256 precondition of
+// /files/write. "absent" means the file must not exist.
+func checkExpectedHash(path, expected string, exists bool) error {
+	switch {
+	case expected == "":
+		return nil
+	case expected == "absent":
+		if exists {
+			return fileErrorf(http.StatusPreconditionFailed, api.CodeHashMismatch, "'%s' already exists", path)
+		}
+		return nil
+	case !exists:
+		return fileErrorf(http.StatusPreconditionFailed, api.CodeHashMismatch, "'%s' does not exist", path)
+	}
+
+	actual, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, expected) {
+		return fileErrorf(http.StatusPreconditionFailed, api.CodeHashMismatch, "'%s' has SHA-256 %s, not %s", path, actual, expected)
+	}
+	return nil
+}
+
+func (s *Server) handleFileMkdir(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req api.MkdirRequest
+	err := decodeFileRequest(r, &req)
+	entry := fileEntry(r, req.Path)
+	if err == nil {
+		err = checkFilePath(s.Config(), req.Path)
+		if err != nil {
+			err = policyError(err)
+		}
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "mkdir", err)
+		return
+	}
+
+	path := filepath.Clean(req.Path)
+	if req.Parents {
+		err = os.MkdirAll(path, 0755)
+	} else {
+		err = os.Mkdir(path, 0755)
+	}
+	var info api.FileInfo
+	if err == nil {
+		info, err = statFile(path)
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "mkdir", err)
+		return
+	}
+	s.fileDone(w, r, entry, "file_mkdir", info)
+}
+
+func (s *Server) handleFileMove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req api.MoveRequest
+	err := decodeFileRequest(r, &req)
+	entry := fileEntry(r, req.From)
+	entry.Target = req.To
+	if err == nil {
+		err = s.checkMove(req)
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "move", err)
+		return
+	}
+
+	from, to := filepath.Clean(req.From), filepath.Clean(req.To)
+	s.filesMu.Lock()
+	err = replaceCheck(to, req.Overwrite)
+	if err == nil {
+		err = os.Rename(from, to)
+	}
+	s.filesMu.Unlock()
+	var info api.FileInfo
+	if err == nil {
+		info, err = statFile(to)
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "move", err)
+		return
+	}
+	s.fileDone(w, r, entry, "file_move", info)
+}
+
+func (s *Server) checkMove(req api.MoveRequest) error {
+	cfg := s.Config()
+	for _, p := range []string{req.From, req.To} {
+		if err := checkFilePath(cfg, p); err != nil {
+			return policyError(err)
+		}
+	}
+	if isAllowedRoot(cfg, req.From) {
+		return policyError(fmt.Errorf("'%s' is an allowed path and cannot be moved", req.From))
+	}
+	if _, err := os.Lstat(req.From); err != nil {
+		return err
+	}
+	return nil
+}
+
+// replaceCheck reports whether a move may put something at to.
+func replaceCheck(to string, overwrite bool) error {
+	fi, err := os.Lstat(to)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case fi.IsDir():
+		return fileErrorf(http.StatusConflict, api.CodeFileExists, "'%s' is an existing directory", to)
+	case !overwrite:
+		return fileErrorf(http.StatusConflict, api.CodeFileExists, "'%s' already exists; set overwrite to replace it", to)
+	}
+	return nil
+}
+
+func (s *Server) handleFileDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req api.DeleteRequest
+	err := decodeFileRequest(r, &req)
+	entry := fileEntry(r, req.Path)
+	if err == nil {
+		cfg := s.Config()
+		if err = checkFilePath(cfg, req.Path); err == nil && isAllowedRoot(cfg, req.Path) {
+			err = fmt.Errorf("'%s' is an allowed path and cannot be deleted", req.Path)
+		}
+		if err != nil {
+			err = policyError(err)
+		}
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "delete", err)
+		return
+	}
+
+	path := filepath.Clean(req.Path)
+	info, err := statFile(path)
+	if err == nil {
+		switch {
+		case req.Recursive || info.IsSymlink:
+			// RemoveAll removes a link, not what it points to.
+			err = os.RemoveAll(path)
+		case info.IsDir:
+			var dirents []os.DirEntry
+			if dirents, err = os.ReadDir(path); err == nil && len(dirents) > 0 {
+				err = fileErrorf(http.StatusConflict, api.CodeFileExists, "directory '%s' is not empty; set recursive to delete it", path)
+			} else if err == nil {
+				err = os.Remove(path)
+			}
+		default:
+			err = os.Remove(path)
+		}
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "delete", err)
+		return
+	}
+	if !info.IsDir {
+		entry.Bytes = info.Size
+	}
+	s.fileDone(w, r, entry, "file_delete", info)
+}
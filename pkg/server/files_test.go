@@ -0,0 +1,226 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+func fileURL(endpoint, path string, extra ...string) string {
+	u := "/v1" + endpoint + "?path=" + url.QueryEscape(path)
+	for i := 0; i+1 < len(extra); i += 2 {
+		u += "&" + extra[i] + "=" + url.QueryEscape(extra[i+1])
+	}
+	return u
+}
+
+func errorCode(t *testing.T, data []byte) string {
+	t.Helper()
+	var er api.ErrorResponse
+	if err := json.Unmarshal(data, &er); err != nil {
+		t.Fatalf("not an ErrorResponse: %q", data)
+	}
+	return er.Code
+}
+
+func TestFilePathPolicy(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	dir := cfg.AllowedPaths[0]
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0644)
+
+	tests := []struct {
+		name, method, path, body string
+	}{
+		{"outside allowed paths", "GET", fileURL("/files/read", filepath.Join(outside, "secret")), ""},
+		{"relative", "GET", fileURL("/files/stat", "a.txt"), ""},
+		{"dot-dot escape", "GET", fileURL("/files/list", dir+string(filepath.Separator)+".."), ""},
+		{"write outside", "PUT", fileURL("/files/write", filepath.Join(outside, "new")), "x"},
+		{"delete allowed root", "POST", "/v1/files/delete", `{"path":` + mustJSON(dir) + `,"recursive":true}`},
+		{"move allowed root", "POST", "/v1/files/move", `{"from":` + mustJSON(dir) + `,"to":` + mustJSON(filepath.Join(dir, "x")) + `}`},
+		{"move outside", "POST", "/v1/files/move", `{"from":` + mustJSON(filepath.Join(dir, "a")) + `,"to":` + mustJSON(filepath.Join(outside, "a")) + `}`},
+	}
+	if runtime.GOOS != "windows" {
+		if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+			t.Fatal(err)
+		}
+		tests = append(tests,
+			struct{ name, method, path, body string }{"symlink escape", "GET", fileURL("/files/read", filepath.Join(dir, "link", "secret")), ""},
+			struct{ name, method, path, body string }{"write through symlink", "PUT", fileURL("/files/write", filepath.Join(dir, "link", "new")), "x"},
+		)
+	}
+
+	for _, tt := range tests {
+		resp, data := request(t, ts, tt.method, tt.path, cfg.APIToken, tt.body)
+		if resp.StatusCode != http.StatusForbidden || errorCode(t, data) != api.CodePolicyViolation {
+			t.Errorf("%s: got %d %s, want 403 policy_violation", tt.name, resp.StatusCode, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); err == nil {
+		t.Error("a rejected write created a file outside the allowed paths")
+	}
+
+	// A directory that a wildcard entry names is a root too.
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(base, "alice", "Projects")
+	if err := os.MkdirAll(filepath.Join(root, "app"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	ts, cfg = newTestServer(t, func(cfg *api.Config) {
+		cfg.AllowedPaths = []string{filepath.Join(base, "*", "Projects")}
+	})
+	for _, tt := range []struct{ name, path, body string }{
+		{"delete wildcard root", "/v1/files/delete", `{"path":` + mustJSON(root) + `,"recursive":true}`},
+		{"delete wildcard root with trailing separator", "/v1/files/delete", `{"path":` + mustJSON(root+string(filepath.Separator)) + `,"recursive":true}`},
+		{"move wildcard root", "/v1/files/move", `{"from":` + mustJSON(root) + `,"to":` + mustJSON(filepath.Join(root, "app", "x")) + `}`},
+	} {
+		resp, data := request(t, ts, "POST", tt.path, cfg.APIToken, tt.body)
+		if resp.StatusCode != http.StatusForbidden || errorCode(t, data) != api.CodePolicyViolation {
+			t.Errorf("%s: got %d %s, want 403 policy_violation", tt.name, resp.StatusCode, data)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "app")); err != nil {
+		t.Errorf("wildcard root was changed: %v", err)
+	}
+	resp, data := request(t, ts, "PUT", fileURL("/files/write", filepath.Join(root, "x")), cfg.APIToken, "x")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("write under wildcard root: %d %s", resp.StatusCode, data)
+	}
+	resp, data = request(t, ts, "POST", "/v1/files/delete", cfg.APIToken, `{"path":`+mustJSON(filepath.Join(root, "app"))+`,"recursive":true}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("delete under wildcard root: %d %s", resp.StatusCode, data)
+	}
+}
+
+func TestFileWritePreconditions(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	path := filepath.Join(cfg.AllowedPaths[0], "sub", "f.txt")
+
+	resp, data := request(t, ts, "PUT", fileURL("/files/write", path), cfg.APIToken, "v1")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("write without parents into a missing directory: %d %s", resp.StatusCode, data)
+	}
+
+	resp, data = request(t, ts, "PUT", fileURL("/files/write", path, "parents", "true", "expected_sha256", "absent"), cfg.APIToken, "v1")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("first write: %d %s", resp.StatusCode, data)
+	}
+	var info api.FileInfo
+	json.Unmarshal(data, &info)
+	sum := sha256.Sum256([]byte("v1"))
+	if info.SHA256 != hex.EncodeToString(sum[:]) || info.Size != 2 {
+		t.Errorf("first write returned %+v", info)
+	}
+
+	resp, data = request(t, ts, "PUT", fileURL("/files/write", path, "expected_sha256", "absent"), cfg.APIToken, "v2")
+	if resp.StatusCode != http.StatusPreconditionFailed || errorCode(t, data) != api.CodeHashMismatch {
+		t.Errorf("absent precondition on an existing file: %d %s", resp.StatusCode, data)
+	}
+	resp, data = request(t, ts, "PUT", fileURL("/files/write", path, "expected_sha256", "00"), cfg.APIToken, "v2")
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("wrong hash: %d %s", resp.StatusCode, data)
+	}
+	resp, data = request(t, ts, "PUT", fileURL("/files/write", path, "expected_sha256", info.SHA256), cfg.APIToken, "v2")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("matching hash: %d %s", resp.StatusCode, data)
+	}
+
+	if got, _ := os.ReadFile(path); string(got) != "v2" {
+		t.Errorf("file contains %q, want v2", got)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestFileRead(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	path := filepath.Join(cfg.AllowedPaths[0], "f.txt")
+	os.WriteFile(path, []byte("0123456789"), 0644)
+
+	tests := []struct {
+		rng    string
+		status int
+		body   string
+	}{
+		{"", http.StatusOK, "0123456789"},
+		{"bytes=2-4", http.StatusPartialContent, "234"},
+		{"bytes=7-", http.StatusPartialContent, "789"},
+		{"bytes=-3", http.StatusPartialContent, "789"},
+		{"bytes=5-100", http.StatusPartialContent, "56789"},
+		{"bytes=10-", http.StatusRequestedRangeNotSatisfiable, ""},
+		{"bytes=0-1,4-5", http.StatusRequestedRangeNotSatisfiable, ""},
+		{"lines=1-2", http.StatusRequestedRangeNotSatisfiable, ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", ts.URL+fileURL("/files/read", path), nil)
+		req.Header.Set("X-Admin-Token", cfg.APIToken)
+		if tt.rng != "" {
+			req.Header.Set("Range", tt.rng)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, 64)
+		n, _ := resp.Body.Read(data)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("Range %q: status %d, want %d", tt.rng, resp.StatusCode, tt.status)
+		} else if tt.body != "" && string(data[:n]) != tt.body {
+			t.Errorf("Range %q: body %q, want %q", tt.rng, data[:n], tt.body)
+		}
+	}
+}
+
+func TestFileMoveAndDelete(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	dir := cfg.AllowedPaths[0]
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	os.WriteFile(a, []byte("a"), 0644)
+	os.WriteFile(b, []byte("b"), 0644)
+	os.MkdirAll(filepath.Join(dir, "d", "e"), 0755)
+
+	move := `{"from":` + mustJSON(a) + `,"to":` + mustJSON(b) + `}`
+	resp, data := request(t, ts, "POST", "/v1/files/move", cfg.APIToken, move)
+	if resp.StatusCode != http.StatusConflict || errorCode(t, data) != api.CodeFileExists {
+		t.Errorf("move onto an existing file: %d %s", resp.StatusCode, data)
+	}
+	move = `{"from":` + mustJSON(a) + `,"to":` + mustJSON(b) + `,"overwrite":true}`
+	if resp, data = request(t, ts, "POST", "/v1/files/move", cfg.APIToken, move); resp.StatusCode != http.StatusOK {
+		t.Errorf("move with overwrite: %d %s", resp.StatusCode, data)
+	}
+	if got, _ := os.ReadFile(b); string(got) != "a" {
+		t.Errorf("b contains %q after the move", got)
+	}
+
+	del := `{"path":` + mustJSON(filepath.Join(dir, "d")) + `}`
+	resp, data = request(t, ts, "POST", "/v1/files/delete", cfg.APIToken, del)
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("delete a non-empty directory: %d %s", resp.StatusCode, data)
+	}
+	del = `{"path":` + mustJSON(filepath.Join(dir, "d")) + `,"recursive":true}`
+	if resp, data = request(t, ts, "POST", "/v1/files/delete", cfg.APIToken, del); resp.StatusCode != http.StatusOK {
+		t.Errorf("recursive delete: %d %s", resp.StatusCode, data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "d")); err == nil {
+		t.Error("directory still exists after a recursive delete")
+	}
+
+	resp, data = request(t, ts, "POST", "/v1/files/delete", cfg.APIToken, `{"path":`+mustJSON(a)+`}`)
+	if resp.StatusCode != http.StatusNotFound || errorCode(t, data) != api.CodeFileNotFound {
+		t.Errorf("delete a missing file: %d %s", resp.StatusCode, data)
+	}
+}
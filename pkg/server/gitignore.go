@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is one pattern of a .gitignore file.
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+	// anchored rules match the path from the .gitignore's directory;
+	// the others match the last element only.
+	anchored bool
+}
+
+// ignoreFile is the rules of one .gitignore. dir is its directory relative
+// to the search root ("" for the root), and prefix is prepended to paths
+// under it, for a .gitignore above the root: "src/" when the search is in
+// its src directory.
+type ignoreFile struct {
+	dir    string
+	prefix string
+	rules  []ignoreRule
+}
+
+// gitignore applies .gitignore files the way git does: the last matching
+// pattern decides, deeper files take precedence, and "!" re-includes. A
+// path under an ignored directory is never reached, as the walk skips the
+// directory.
+type gitignore struct {
+	files []ignoreFile
+}
+
+// load adds the .gitignore in the directory abs, if there is one.
+func (g *gitignore) load(abs, dir, prefix string) {
+	f, err := os.Open(filepath.Join(abs, ".gitignore"))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	rules := parseGitignore(bufio.NewScanner(f))
+	if len(rules) > 0 {
+		g.files = append(g.files, ignoreFile{dir: dir, prefix: prefix, rules: rules})
+	}
+}
+
+func parseGitignore(sc *bufio.Scanner) []ignoreRule {
+	var rules []ignoreRule
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if !strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " ")
+		}
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		var r ignoreRule
+		switch {
+		case line[0] == '!':
+			r.negate = true
+			line = line[1:]
+		case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		r.anchored = strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		re, err := regexp.Compile("^" + globRegexp(line) + "$")
+		if err != nil {
+			continue
+		}
+		r.re = re
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// globRegexp translates a gitignore glob: * and ? do not match a slash,
+// and ** matches any number of directories.
+func globRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// ignored reports whether rel, slash-separated and relative to the search
+// root, is ignored.
+func (g *gitignore) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, f := range g.files {
+		p := rel
+		if f.dir != "" {
+			if !strings.HasPrefix(rel, f.dir+"/") {
+				continue
+			}
+			p = rel[len(f.dir)+1:]
+		}
+		p = f.prefix + p
+		name := p[strings.LastIndexByte(p, '/')+1:]
+		for _, r := range f.rules {
+			if r.dirOnly && !isDir {
+				continue
+			}
+			target := name
+			if r.anchored {
+				target = p
+			}
+			if r.re.MatchString(target) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, api.HealthResponse{Status: "ok"})
+}
+
+// handleReadyz reports whether the server can usefully accept /run requests:
+// config is loaded, the audit log is writable and the run queue has room.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	cfg := s.Config()
+	checks := map[string]string{}
+	ready := true
+
+	if cfg.APIToken == "" {
+		checks["config"] = "no API token loaded"
+		ready = false
+	} else {
+		checks["config"] = "ok"
+	}
+
+	checks["log"] = "ok"
+	if c, ok := s.logger.(interface{ Check() error }); ok {
+		if err := c.Check(); err != nil {
+			checks["log"] = err.Error()
+			ready = false
+		}
+	}
+
+	running, queued := s.queue.stats()
+	if s.shuttingDown() {
+		checks["queue"] = fmt.Sprintf("shutting down: %d running", running)
+		ready = false
+	} else if queued >= int64(cfg.MaxQueued) {
+		checks["queue"] = fmt.Sprintf("saturated: %d running, %d queued", running, queued)
+		ready = false
+	} else {
+		checks["queue"] = "ok"
+	}
+
+	status, code := "ok", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, api.HealthResponse{Status: status, Checks: checks})
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	cfg := s.Config()
+	writeJSON(w, http.StatusOK, api.VersionResponse{
+		Version:   s.opts.Version,
+		Commit:    s.opts.Commit,
+		GoVersion: runtime.Version(),
+		StartedAt: s.started.Format(time.RFC3339),
+		Uptime:    time.Since(s.started).Round(time.Second).String(),
+		Config: api.ConfigSummary{
+			Port:           cfg.Port,
+			Bind:           cfg.Bind,
+			AllowedClients: cfg.AllowedClients,
+			TLSEnabled:     cfg.TLS.Enabled(),
+			AllowedCmds:    cfg.AllowedCmds,
+			AllowedPaths:   cfg.AllowedPaths,
+			LogFile:        cfg.LogFile,
+			MaxConcurrent:  cfg.MaxConcurrent,
+			MaxQueued:      cfg.MaxQueued,
+			TracingEnabled: cfg.Tracing.Enabled,
+		},
+	})
+}
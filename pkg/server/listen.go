@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/user"
+	"strconv"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// openListener creates the configured listener, preferring a socket passed
+// by systemd socket activation.
+func (s *Server) openListener(cfg api.Config) (net.Listener, error) {
+	ln, err := activationListener()
+	if err != nil {
+		return nil, err
+	}
+	if ln != nil {
+		if cfg.Listen.Network == "unix" {
+			return restrictPeers(ln, cfg.Listen, s.log)
+		}
+		return ln, nil
+	}
+
+	switch cfg.Listen.Network {
+	case "", "tcp":
+		return net.Listen("tcp", ListenAddr(cfg))
+	default:
+		return listenLocal(cfg.Listen, s.log)
+	}
+}
+
+// peerAddr is reported as the RemoteAddr of connections accepted on local
+// transports, so log entries identify the connecting account.
+type peerAddr string
+
+func (a peerAddr) Network() string { return "local" }
+func (a peerAddr) String() string  { return string(a) }
+
+type peerConn struct {
+	net.Conn
+	addr peerAddr
+}
+
+func (c *peerConn) RemoteAddr() net.Addr { return c.addr }
+
+// peerCheckListener rejects connections whose peer is not allowed before
+// any HTTP is read. identify returns a description of the peer and whether
+// it may connect.
+type peerCheckListener struct {
+	net.Listener
+	identify func(net.Conn) (string, bool, error)
+	log      func(context.Context, api.LogEntry)
+}
+
+func (l *peerCheckListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		reason := "Connecting account is not in listen.allowed_users"
+		who, ok, err := l.identify(c)
+		if err != nil {
+			who = "unknown peer"
+			reason = fmt.Sprintf("Cannot identify peer: %v", err)
+			ok = false
+		}
+		if !ok {
+			l.log(context.Background(), api.LogEntry{
+				Timestamp: time.Now().Format(time.RFC3339),
+				IP:        who,
+				Status:    "peer_rejected",
+				Reason:    reason,
+			})
+			c.Close()
+			continue
+		}
+		return &peerConn{Conn: c, addr: peerAddr(who)}, nil
+	}
+}
+
+// ListenAddr is the TCP host:port the server listens on for cfg.
+func ListenAddr(cfg api.Config) string {
+	host, err := api.ResolveBindHost(cfg.Bind)
+	if err != nil {
+		host = cfg.Bind
+	}
+	return net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+}
+
+// lookupUID resolves a user name or numeric ID to a UID string.
+func lookupUID(name string) (string, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return name, nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+// lookupGID resolves a group name or numeric ID to a GID string.
+func lookupGID(name string) (string, error) {
+	if _, err := strconv.Atoi(name); err == nil {
+		return name, nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return "", err
+	}
+	return g.Gid, nil
+}
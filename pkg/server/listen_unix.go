@@ -0,0 +1,117 @@
+//go:build !windows
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// listenLocal creates the Unix domain socket, sets its mode and ownership,
+// and restricts it to allowed accounts.
+func listenLocal(lc api.ListenConfig, logf func(context.Context, api.LogEntry)) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(lc.Path), 0755); err != nil {
+		return nil, err
+	}
+	// A socket left behind by an unclean exit would make Listen fail.
+	if fi, err := os.Lstat(lc.Path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", lc.Path)
+		}
+		if err := os.Remove(lc.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", lc.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := setSocketPermissions(lc); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return restrictPeers(ln, lc, logf)
+}
+
+// lookupPeerUID finds the UID of a Unix socket's peer. Tests replace it to
+// connect as other accounts.
+var lookupPeerUID = peerUID
+
+// restrictPeers wraps a Unix socket listener so that connections from
+// accounts outside listen.allowed_users are closed on accept.
+func restrictPeers(ln net.Listener, lc api.ListenConfig, logf func(context.Context, api.LogEntry)) (net.Listener, error) {
+	allowed, err := allowedUIDs(lc.AllowedUsers)
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return &peerCheckListener{
+		Listener: ln,
+		log:      logf,
+		identify: func(c net.Conn) (string, bool, error) {
+			uid, err := lookupPeerUID(c)
+			if err != nil {
+				return "", false, err
+			}
+			return fmt.Sprintf("unix:uid=%d", uid), allowed[strconv.Itoa(uid)], nil
+		},
+	}, nil
+}
+
+func setSocketPermissions(lc api.ListenConfig) error {
+	mode := uint64(api.DefaultSocketMode)
+	if lc.Mode != "" {
+		var err error
+		if mode, err = strconv.ParseUint(lc.Mode, 8, 32); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(lc.Path, os.FileMode(mode)); err != nil {
+		return err
+	}
+
+	if lc.Owner == "" && lc.Group == "" {
+		return nil
+	}
+	uid, gid := -1, -1
+	if lc.Owner != "" {
+		s, err := lookupUID(lc.Owner)
+		if err != nil {
+			return fmt.Errorf("listen.owner: %v", err)
+		}
+		uid, _ = strconv.Atoi(s)
+	}
+	if lc.Group != "" {
+		s, err := lookupGID(lc.Group)
+		if err != nil {
+			return fmt.Errorf("listen.group: %v", err)
+		}
+		gid, _ = strconv.Atoi(s)
+	}
+	return os.Chown(lc.Path, uid, gid)
+}
+
+// allowedUIDs resolves listen.allowed_users. Root and the server's own
+// account are always allowed.
+func allowedUIDs(users []string) (map[string]bool, error) {
+	allowed := map[string]bool{
+		"0":                       true,
+		strconv.Itoa(os.Getuid()): true,
+	}
+	for _, u := range users {
+		uid, err := lookupUID(u)
+		if err != nil {
+			return nil, fmt.Errorf("listen.allowed_users: %v", err)
+		}
+		allowed[uid] = true
+	}
+	return allowed, nil
+}
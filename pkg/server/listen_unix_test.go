@@ -0,0 +1,132 @@
+//go:build linux || darwin || freebsd
+
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// acceptOne dials the socket at path and returns the accepted connection,
+// or nil if the listener dropped it.
+func acceptOne(t *testing.T, ln net.Listener, path string) net.Conn {
+	t.Helper()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			c = nil
+		}
+		accepted <- c
+	}()
+	client, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// A rejected connection is closed before anything is read from it.
+	client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var buf [1]byte
+	_, rerr := client.Read(buf[:])
+	if errors.Is(rerr, io.EOF) {
+		ln.Close()
+		if c := <-accepted; c != nil {
+			t.Fatal("Accept returned a connection that was closed")
+		}
+		return nil
+	}
+	select {
+	case c := <-accepted:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection neither accepted nor closed")
+		return nil
+	}
+}
+
+func TestPeerCredentials(t *testing.T) {
+	self := os.Getuid()
+	tests := []struct {
+		name    string
+		uid     int
+		uidErr  error
+		allowed []string
+		ok      bool
+		who     string
+	}{
+		{"own account", self, nil, nil, true, "unix:uid=" + strconv.Itoa(self)},
+		{"root", 0, nil, nil, true, "unix:uid=0"},
+		{"other account", 54321, nil, nil, false, "unix:uid=54321"},
+		{"other account allowed", 54321, nil, []string{"54321"}, true, "unix:uid=54321"},
+		{"other account not listed", 54322, nil, []string{"54321"}, false, "unix:uid=54322"},
+		{"unidentified", 0, errors.New("no credentials"), nil, false, "unknown peer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookupPeerUID = func(net.Conn) (int, error) { return tt.uid, tt.uidErr }
+			t.Cleanup(func() { lookupPeerUID = peerUID })
+
+			path := filepath.Join(t.TempDir(), "s")
+			inner, err := net.Listen("unix", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			logs := &recordLogger{}
+			ln, err := restrictPeers(inner, api.ListenConfig{Network: "unix", Path: path, AllowedUsers: tt.allowed},
+				func(_ context.Context, e api.LogEntry) { logs.Log(e) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+
+			c := acceptOne(t, ln, path)
+			if (c != nil) != tt.ok {
+				t.Fatalf("accepted = %v, want %v", c != nil, tt.ok)
+			}
+			if c != nil {
+				defer c.Close()
+				if got := c.RemoteAddr().String(); got != tt.who {
+					t.Errorf("RemoteAddr = %q, want %q", got, tt.who)
+				}
+				return
+			}
+			entries := logs.entries()
+			if len(entries) != 1 || entries[0].Status != "peer_rejected" || entries[0].IP != tt.who {
+				t.Errorf("log = %+v, want one peer_rejected entry for %s", entries, tt.who)
+			}
+		})
+	}
+}
+
+// TestPeerCredentialsReal checks the platform lookup against a real
+// connection, which comes from the test's own account.
+func TestPeerCredentialsReal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "s")
+	inner, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := restrictPeers(inner, api.ListenConfig{Network: "unix", Path: path}, func(context.Context, api.LogEntry) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	c := acceptOne(t, ln, path)
+	if c == nil {
+		t.Fatal("own account rejected")
+	}
+	defer c.Close()
+	if want := "unix:uid=" + strconv.Itoa(os.Getuid()); c.RemoteAddr().String() != want {
+		t.Errorf("RemoteAddr = %q, want %q", c.RemoteAddr(), want)
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Microsoft/go-winio"
+	"golang.org/x/sys/windows"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// listenLocal creates the named pipe with an ACL granting access only to
+// SYSTEM, Administrators, the server's own account and listen.allowed_users.
+func listenLocal(lc api.ListenConfig, logf func(context.Context, api.LogEntry)) (net.Listener, error) {
+	sddl, err := pipeSecurityDescriptor(lc.AllowedUsers)
+	if err != nil {
+		return nil, err
+	}
+	return winio.ListenPipe(lc.Path, &winio.PipeConfig{SecurityDescriptor: sddl})
+}
+
+// restrictPeers is only reached for Unix sockets, which Windows does not
+// serve; pipes are restricted by their ACL instead.
+func restrictPeers(ln net.Listener, lc api.ListenConfig, logf func(context.Context, api.LogEntry)) (net.Listener, error) {
+	return ln, nil
+}
+
+func pipeSecurityDescriptor(users []string) (string, error) {
+	var sb strings.Builder
+	// P: protected, so no inherited entries widen access.
+	sb.WriteString("D:P(A;;GA;;;SY)(A;;GA;;;BA)")
+
+	token := windows.GetCurrentProcessToken()
+	self, err := token.GetTokenUser()
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&sb, "(A;;GA;;;%s)", self.User.Sid.String())
+
+	for _, u := range users {
+		sid, _, _, err := windows.LookupSID("", u)
+		if err != nil {
+			return "", fmt.Errorf("listen.allowed_users: %s: %v", u, err)
+		}
+		fmt.Fprintf(&sb, "(A;;GRGW;;;%s)", sid.String())
+	}
+	return sb.String(), nil
+}
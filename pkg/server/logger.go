@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// Logger records audit log entries. A Logger may also implement
+//
+//	Check() error                              // reported by /readyz
+//	Reopen(path string) error                  // called when a reload changes log_file
+//	Printf(format string, args ...interface{}) // diagnostic messages
+//
+// Diagnostic messages, such as the listening address or the TLS
+// certificate's fingerprint, are dropped if the Logger has no Printf; the
+// server never writes to stdout or the standard logger.
+type Logger interface {
+	Log(entry api.LogEntry)
+}
+
+// FileLogger appends one JSON object per line to a file.
+type FileLogger struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenFileLogger opens (creating if needed) the log at path. Relative paths
+// are resolved against the executable's directory.
+func OpenFileLogger(path string) (*FileLogger, error) {
+	f, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLogger{f: f}, nil
+}
+
+func (l *FileLogger) Log(entry api.LogEntry) {
+	data, _ := json.Marshal(entry)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return
+	}
+	l.f.Write(data)
+	l.f.Write([]byte("\n"))
+	l.f.Sync()
+}
+
+// Reopen switches to the log at path, closing the previous file.
+func (l *FileLogger) Reopen(path string) error {
+	f, err := openLogFile(path)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	old := l.f
+	l.f = f
+	l.mu.Unlock()
+
+	if old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+// Check reports whether the log file is still open and writable.
+func (l *FileLogger) Check() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return fmt.Errorf("log file not open")
+	}
+	if _, err := l.f.Stat(); err != nil {
+		return fmt.Errorf("log file unavailable: %v", err)
+	}
+	if err := l.f.Sync(); err != nil {
+		return fmt.Errorf("log file not writable: %v", err)
+	}
+	return nil
+}
+
+func (l *FileLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
+
+func openLogFile(logPath string) (*os.File, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	baseDir := filepath.Dir(exePath)
+
+	if !filepath.IsAbs(logPath) {
+		logPath = filepath.Join(baseDir, logPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+}
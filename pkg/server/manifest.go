@@ -0,0 +1,166 @@
+package server
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// maxManifestEntries bounds the size of a manifest; a tree larger than this
+// needs excludes.
+const maxManifestEntries = 200000
+
+func (s *Server) handleFileManifest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req api.ManifestRequest
+	err := decodeFileRequest(r, &req)
+	entry := fileEntry(r, req.Path)
+	if err == nil {
+		if err = checkFilePath(s.Config(), req.Path); err != nil {
+			err = policyError(err)
+		}
+	}
+	if err == nil {
+		if err = api.ValidateExcludes(req.Exclude); err != nil {
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "%v", err)
+		}
+	}
+	var resp api.ManifestResponse
+	if err == nil {
+		resp, err = buildManifest(req)
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "manifest", err)
+		return
+	}
+	s.fileDone(w, r, entry, "file_manifest", resp)
+}
+
+// buildManifest describes the tree under req.Path, or only req.Paths in
+// it. Symlinks are skipped rather than followed, so the manifest never
+// reaches outside the root, which the caller has checked.
+func buildManifest(req api.ManifestRequest) (api.ManifestResponse, error) {
+	root := filepath.Clean(req.Path)
+	if fi, err := os.Stat(root); err != nil {
+		return api.ManifestResponse{}, err
+	} else if !fi.IsDir() {
+		return api.ManifestResponse{}, fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "'%s' is not a directory", root)
+	}
+
+	resp := api.ManifestResponse{Path: root, Entries: []api.ManifestEntry{}}
+	add := func(rel string, fi fs.FileInfo) error {
+		if len(resp.Entries) >= maxManifestEntries {
+			return fileErrorf(http.StatusRequestEntityTooLarge, api.CodeTooLarge,
+				"'%s' has more than %d entries; exclude some", root, maxManifestEntries)
+		}
+		e := api.ManifestEntry{
+			Path:    rel,
+			ModTime: fi.ModTime().UTC().Format(time.RFC3339Nano),
+			IsDir:   fi.IsDir(),
+		}
+		if !fi.IsDir() {
+			e.Size = fi.Size()
+			if req.Hash {
+				sum, err := hashFile(filepath.Join(root, filepath.FromSlash(rel)))
+				if err != nil {
+					return err
+				}
+				e.SHA256 = sum
+			}
+		}
+		resp.Entries = append(resp.Entries, e)
+		return nil
+	}
+
+	if len(req.Paths) > 0 {
+		for _, rel := range req.Paths {
+			clean := path.Clean(rel)
+			if rel == "" || path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(rel, `\`) {
+				return api.ManifestResponse{}, fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest,
+					"'%s' is not a relative path inside the root", rel)
+			}
+			if api.Excluded(clean, req.Exclude) {
+				continue
+			}
+			fi, err := lstatNoLinks(root, clean)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return api.ManifestResponse{}, err
+			}
+			if err := add(clean, fi); err != nil {
+				return api.ManifestResponse{}, err
+			}
+		}
+	} else if err := walkTree(root, req.Exclude, add); err != nil {
+		return api.ManifestResponse{}, err
+	}
+
+	sort.Slice(resp.Entries, func(i, j int) bool { return resp.Entries[i].Path < resp.Entries[j].Path })
+	return resp, nil
+}
+
+// lstatNoLinks describes rel under root, reporting it as not existing if it
+// or anything on the way is a symlink or not a directory, just as the walk skips them.
+func lstatNoLinks(root, rel string) (fs.FileInfo, error) {
+	p := root
+	var fi fs.FileInfo
+	elems := strings.Split(rel, "/")
+	for i, elem := range elems {
+		p = filepath.Join(p, elem)
+		var err error
+		if fi, err = os.Lstat(p); err != nil {
+			return nil, err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 || (i < len(elems)-1 && !fi.IsDir()) {
+			return nil, fs.ErrNotExist
+		}
+	}
+	return fi, nil
+}
+
+// walkTree calls fn for everything under root with its slash-separated
+// path relative to root, parents before their contents. Excluded paths,
+// symlinks and restricted directories are skipped, so the walk never
+// leaves root.
+func walkTree(root string, exclude []string, fn func(rel string, fi fs.FileInfo) error) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		skip := api.Excluded(rel, exclude) || d.Type()&fs.ModeSymlink != 0 || isRestrictedPath(p)
+		switch {
+		case skip && d.IsDir():
+			return filepath.SkipDir
+		case skip:
+			return nil
+		}
+		fi, err := d.Info()
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return fn(rel, fi)
+	})
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+func TestFileManifest(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	dir := cfg.AllowedPaths[0]
+	for name, data := range map[string]string{
+		"main.go":            "package main\n",
+		"src/util.go":        "package src\n",
+		".git/HEAD":          "ref: refs/heads/main\n",
+		"web/node_modules/x": "x",
+		"debug.log":          "log\n",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret"), []byte("x"), 0644)
+	if runtime.GOOS != "windows" {
+		if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest := func(body string) api.ManifestResponse {
+		t.Helper()
+		resp, data := request(t, ts, "POST", "/v1/files/manifest", cfg.APIToken, body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("manifest %s: %d %s", body, resp.StatusCode, data)
+		}
+		var m api.ManifestResponse
+		json.Unmarshal(data, &m)
+		return m
+	}
+	paths := func(m api.ManifestResponse) string {
+		var p []string
+		for _, e := range m.Entries {
+			p = append(p, e.Path)
+		}
+		return strings.Join(p, " ")
+	}
+
+	m := manifest(`{"path":` + mustJSON(dir) + `,"exclude":[".git","node_modules","*.log"]}`)
+	if got, want := paths(m), "main.go src src/util.go web"; got != want {
+		t.Errorf("entries %q, want %q", got, want)
+	}
+	for _, e := range m.Entries {
+		if e.SHA256 != "" {
+			t.Errorf("%s hashed without hash", e.Path)
+		}
+	}
+
+	// Paths limits the manifest; missing, excluded and linked entries are
+	// left out.
+	m = manifest(`{"path":` + mustJSON(dir) + `,"exclude":["*.log"],"hash":true,"paths":["main.go","gone.go","debug.log","link/secret"]}`)
+	if len(m.Entries) != 1 || m.Entries[0].Path != "main.go" || m.Entries[0].SHA256 != sha256Hex("package main\n") {
+		t.Errorf("limited manifest: %+v", m.Entries)
+	}
+
+	for _, body := range []string{
+		`{"path":` + mustJSON(dir) + `,"paths":["../x"]}`,
+		`{"path":` + mustJSON(dir) + `,"exclude":["["]}`,
+		`{"path":` + mustJSON(filepath.Join(dir, "main.go")) + `}`,
+	} {
+		resp, data := request(t, ts, "POST", "/v1/files/manifest", cfg.APIToken, body)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: %d %s, want 400", body, resp.StatusCode, data)
+		}
+	}
+	resp, data := request(t, ts, "POST", "/v1/files/manifest", cfg.APIToken, `{"path":`+mustJSON(outside)+`}`)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("outside allowed paths: %d %s", resp.StatusCode, data)
+	}
+}
+
+func TestFileWriteModTime(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	path := filepath.Join(cfg.AllowedPaths[0], "f")
+	mtime := time.Date(2025, 6, 7, 8, 9, 10, 123456700, time.UTC)
+
+	resp, data := request(t, ts, "PUT", fileURL("/files/write", path, "mod_time", mtime.Format(time.RFC3339Nano)), cfg.APIToken, "x")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("write: %d %s", resp.StatusCode, data)
+	}
+	if fi, err := os.Stat(path); err != nil || !fi.ModTime().Equal(mtime) {
+		t.Errorf("mod time %v, want %v", fi.ModTime(), mtime)
+	}
+
+	resp, data = request(t, ts, "PUT", fileURL("/files/write", path, "mod_time", "yesterday"), cfg.APIToken, "y")
+	if resp.StatusCode != http.StatusBadRequest || errorCode(t, data) != api.CodeInvalidRequest {
+		t.Errorf("bad mod_time: %d %s", resp.StatusCode, data)
+	}
+}
@@ -0,0 +1,688 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// filePatch is the part of a unified diff for one file. A name is empty
+// for /dev/null, i.e. a created or deleted file.
+type filePatch struct {
+	oldName, newName string
+	hunks            []hunk
+}
+
+// hunk is one @@ section. Lines start with ' ', '-' or '+'. The noEOL
+// flags record "\ No newline at end of file" after the old or new side's
+// last line.
+type hunk struct {
+	oldStart, oldCount int
+	newStart, newCount int
+	lines              []string
+	oldNoEOL, newNoEOL bool
+}
+
+// side returns the hunk's old (context and '-') or new (context and '+')
+// lines without their prefix.
+func (h hunk) side(op byte) []string {
+	var out []string
+	for _, l := range h.lines {
+		if l[0] == ' ' || l[0] == op {
+			out = append(out, l[1:])
+		}
+	}
+	return out
+}
+
+// context returns how many context lines the hunk starts and ends with.
+func (h hunk) context() (lead, trail int) {
+	for lead < len(h.lines) && h.lines[lead][0] == ' ' {
+		lead++
+	}
+	for trail < len(h.lines)-lead && h.lines[len(h.lines)-1-trail][0] == ' ' {
+		trail++
+	}
+	return lead, trail
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// parseDiff splits a unified diff into its files. Besides ---/+++ headers
+// it understands the git extended headers that describe files without
+// hunks: new and deleted empty files and pure renames.
+func parseDiff(diff string, strip int) ([]filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(diff, "\r\n", "\n"), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var patches []filePatch
+	// State of a "diff --git" section that has not had ---/+++ yet.
+	var git *filePatch
+	gitNames := false
+	flushGit := func() {
+		if git != nil && (git.oldName != git.newName || git.oldName == "" || git.newName == "") {
+			patches = append(patches, *git)
+		}
+		git = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			flushGit()
+			gitNames = true
+			oldName, newName := splitGitNames(strings.TrimPrefix(line, "diff --git "))
+			git = &filePatch{oldName: stripName(oldName, strip, true), newName: stripName(newName, strip, true)}
+		case git != nil && strings.HasPrefix(line, "new file mode"):
+			git.oldName = ""
+		case git != nil && strings.HasPrefix(line, "deleted file mode"):
+			git.newName = ""
+		case git != nil && strings.HasPrefix(line, "rename from "):
+			git.oldName = stripName(unquoteName(strings.TrimPrefix(line, "rename from ")), 0, false)
+		case git != nil && strings.HasPrefix(line, "rename to "):
+			git.newName = stripName(unquoteName(strings.TrimPrefix(line, "rename to ")), 0, false)
+		case strings.HasPrefix(line, "GIT binary patch"), strings.HasPrefix(line, "Binary files "):
+			return nil, fmt.Errorf("line %d: binary patches are not supported", i+1)
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			oldName := headerName(line[4:])
+			newName := headerName(lines[i+1][4:])
+			isGit := gitNames ||
+				((oldName == "/dev/null" || strings.HasPrefix(oldName, "a/")) && (newName == "/dev/null" || strings.HasPrefix(newName, "b/")))
+			fp := filePatch{oldName: stripName(oldName, strip, isGit), newName: stripName(newName, strip, isGit)}
+			git = nil
+			i++
+			for i+1 < len(lines) && strings.HasPrefix(lines[i+1], "@@") {
+				h, next, err := parseHunk(lines, i+1)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", displayName(fp), err)
+				}
+				fp.hunks = append(fp.hunks, h)
+				i = next - 1
+			}
+			if len(fp.hunks) == 0 {
+				return nil, fmt.Errorf("%s: no hunks after the file header at line %d", displayName(fp), i)
+			}
+			patches = append(patches, fp)
+		case strings.HasPrefix(line, "@@"):
+			return nil, fmt.Errorf("line %d: hunk without a ---/+++ file header", i+1)
+		}
+		// Anything else (index lines, mode changes, commit messages) is
+		// ignored, like patch does.
+	}
+	flushGit()
+	return patches, nil
+}
+
+// parseHunk parses the hunk whose header is lines[i] and returns it with
+// the index of the line after it.
+func parseHunk(lines []string, i int) (hunk, int, error) {
+	m := hunkHeader.FindStringSubmatch(lines[i])
+	if m == nil {
+		return hunk{}, 0, fmt.Errorf("line %d: malformed hunk header %q", i+1, lines[i])
+	}
+	num := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	h := hunk{oldStart: num(m[1]), oldCount: num(m[2]), newStart: num(m[3]), newCount: num(m[4])}
+	header := i + 1
+	oldSeen, newSeen := 0, 0
+	i++
+	for ; i < len(lines) && (oldSeen < h.oldCount || newSeen < h.newCount); i++ {
+		l := lines[i]
+		if l == "" {
+			// Some tools strip the space of an empty context line.
+			l = " "
+		}
+		switch l[0] {
+		case ' ':
+			oldSeen++
+			newSeen++
+		case '-':
+			oldSeen++
+		case '+':
+			newSeen++
+		case '\\':
+			markNoEOL(&h)
+			continue
+		default:
+			return hunk{}, 0, fmt.Errorf("line %d: unexpected %q in the hunk at line %d", i+1, l, header)
+		}
+		h.lines = append(h.lines, l)
+	}
+	if oldSeen != h.oldCount || newSeen != h.newCount {
+		return hunk{}, 0, fmt.Errorf("the hunk at line %d has %d old and %d new lines, its header says %d and %d",
+			header, oldSeen, newSeen, h.oldCount, h.newCount)
+	}
+	for i < len(lines) && strings.HasPrefix(lines[i], `\`) {
+		markNoEOL(&h)
+		i++
+	}
+	return h, i, nil
+}
+
+// markNoEOL applies a "\ No newline at end of file" line to the side of
+// the line before it.
+func markNoEOL(h *hunk) {
+	if len(h.lines) == 0 {
+		return
+	}
+	switch h.lines[len(h.lines)-1][0] {
+	case '-':
+		h.oldNoEOL = true
+	case '+':
+		h.newNoEOL = true
+	default:
+		h.oldNoEOL, h.newNoEOL = true, true
+	}
+}
+
+// headerName returns the file name of a ---/+++ line, without the
+// timestamp diff -u appends after a tab.
+func headerName(s string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	return unquoteName(strings.TrimRight(s, " "))
+}
+
+// unquoteName undoes git's quoting of names with unusual characters.
+func unquoteName(s string) string {
+	if strings.HasPrefix(s, `"`) {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+	}
+	return s
+}
+
+// splitGitNames splits the "a/x b/y" of a diff --git line.
+func splitGitNames(s string) (string, string) {
+	if strings.HasPrefix(s, `"`) {
+		if end := strings.Index(s[1:], `" `); end >= 0 {
+			return unquoteName(s[:end+2]), unquoteName(s[end+3:])
+		}
+	}
+	if i := strings.Index(s, " b/"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	if i := strings.LastIndex(s, " "); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return s, s
+}
+
+// stripName removes strip leading components from name, or git's a/ or b/
+// prefix when strip is 0 and git is set. /dev/null becomes "".
+func stripName(name string, strip int, git bool) string {
+	if name == "/dev/null" {
+		return ""
+	}
+	if strip == 0 && git {
+		strip = 1
+	}
+	for ; strip > 0; strip-- {
+		i := strings.IndexByte(name, '/')
+		if i < 0 {
+			break
+		}
+		name = name[i+1:]
+	}
+	return name
+}
+
+func displayName(fp filePatch) string {
+	if fp.newName != "" {
+		return fp.newName
+	}
+	return fp.oldName
+}
+
+// text is a file split into lines without their line endings.
+type text struct {
+	lines   []string
+	crlf    bool
+	finalNL bool
+}
+
+func splitText(data []byte) text {
+	s := string(data)
+	if s == "" {
+		return text{}
+	}
+	t := text{finalNL: strings.HasSuffix(s, "\n")}
+	t.lines = strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	crlf := 0
+	for i, l := range t.lines {
+		if strings.HasSuffix(l, "\r") {
+			crlf++
+			t.lines[i] = l[:len(l)-1]
+		}
+	}
+	t.crlf = crlf > len(t.lines)/2
+	return t
+}
+
+func (t text) bytes() []byte {
+	eol := "\n"
+	if t.crlf {
+		eol = "\r\n"
+	}
+	s := strings.Join(t.lines, eol)
+	if t.finalNL && len(t.lines) > 0 {
+		s += eol
+	}
+	return []byte(s)
+}
+
+// applyHunks applies the hunks in order, each at the place nearest to
+// where its header says (following the offset of the hunk before) that
+// matches, ignoring up to fuzz lines of context at either end if need
+// be. It reports every hunk, and whether all applied.
+func applyHunks(t text, hunks []hunk, fuzz int) (text, []api.PatchHunk, bool) {
+	out := text{crlf: t.crlf, finalNL: t.finalNL || len(t.lines) == 0}
+	results := make([]api.PatchHunk, 0, len(hunks))
+	pos, lastOffset, ok := 0, 0, true
+	for i, h := range hunks {
+		res := api.PatchHunk{Hunk: i + 1}
+		old, new := h.side('-'), h.side('+')
+		base := h.oldStart - 1
+		if h.oldCount == 0 {
+			base = h.oldStart
+		}
+		maxLead, maxTrail := h.context()
+
+		found, lead, trail := -1, 0, 0
+		for f := 0; f <= fuzz && found < 0; f++ {
+			l, tr := min(f, maxLead), min(f, maxTrail)
+			// Stop when there is no more context to ignore, or
+			// ignoring it would leave nothing to match.
+			if f > 0 && (l+tr == lead+trail || l+tr >= len(old)) {
+				break
+			}
+			lead, trail = l, tr
+			found = findLines(t.lines, old[lead:len(old)-trail], base+lastOffset+lead, pos)
+			res.Fuzz = max(lead, trail)
+		}
+		if found < 0 {
+			res.Fuzz = 0
+			res.Error = fmt.Sprintf("no match for the %d lines of context and removals near line %d", len(old), base+lastOffset+1)
+			results = append(results, res)
+			ok = false
+			continue
+		}
+
+		out.lines = append(out.lines, t.lines[pos:found]...)
+		out.lines = append(out.lines, new[lead:len(new)-trail]...)
+		pos = found + len(old) - lead - trail
+		if pos == len(t.lines) && trail == 0 {
+			switch {
+			case h.newNoEOL:
+				out.finalNL = false
+			case h.oldNoEOL:
+				out.finalNL = true
+			}
+		}
+		lastOffset = found - lead - base
+		res.Applied, res.Line, res.Offset = true, found-lead+1, lastOffset
+		results = append(results, res)
+	}
+	out.lines = append(out.lines, t.lines[pos:]...)
+	return out, results, ok
+}
+
+// findLines returns the index of want in lines nearest to at and not
+// before from, or -1.
+func findLines(lines, want []string, at, from int) int {
+	last := len(lines) - len(want)
+	if len(want) == 0 {
+		return max(from, min(at, len(lines)))
+	}
+	for d := 0; at-d >= from || at+d <= last; d++ {
+		for _, i := range []int{at - d, at + d} {
+			if i >= from && i <= last && matchAt(lines, want, i) {
+				return i
+			}
+			if d == 0 {
+				break
+			}
+		}
+	}
+	return -1
+}
+
+func matchAt(lines, want []string, i int) bool {
+	for j, w := range want {
+		if lines[i+j] != strings.TrimSuffix(w, "\r") {
+			return false
+		}
+	}
+	return true
+}
+
+// patchChange is a file change of a patch that applies: new contents for
+// path (nil when it is deleted), replacing the file read with hash sum ("",
+// if it did not exist) at from, which differs from path for a rename.
+type patchChange struct {
+	from, path string
+	sum        string
+	orig, data []byte
+	mode       fs.FileMode
+	tmp        string
+}
+
+func (s *Server) handleFilePatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	cfg := s.Config()
+	r.Body = http.MaxBytesReader(w, r.Body, maxFileSize(cfg))
+	var req api.PatchRequest
+	err := decodeFileRequest(r, &req)
+	entry := fileEntry(r, req.Root)
+	entry.Bytes = int64(len(req.Diff))
+	if err == nil {
+		if err = checkFilePath(cfg, req.Root); err != nil {
+			err = policyError(err)
+		}
+	}
+	if err == nil {
+		if fi, serr := os.Stat(req.Root); serr != nil {
+			err = serr
+		} else if !fi.IsDir() {
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "'%s' is not a directory", req.Root)
+		}
+	}
+	var patches []filePatch
+	if err == nil {
+		if patches, err = parseDiff(req.Diff, req.Strip); err != nil {
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "invalid diff: %v", err)
+		} else if len(patches) == 0 {
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "the diff changes no files")
+		}
+	}
+	if err == nil && (req.Strip < 0 || req.Fuzz < 0) {
+		err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "strip and fuzz must not be negative")
+	}
+	var resp api.PatchResponse
+	var changes []patchChange
+	if err == nil {
+		resp, changes, err = planPatch(cfg, filepath.Clean(req.Root), patches, req)
+	}
+	if err == nil && !req.DryRun {
+		err = s.applyPatch(changes)
+		resp.Applied = err == nil
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "patch", err)
+		return
+	}
+
+	if req.DryRun {
+		s.fileDone(w, r, entry, "file_patch_checked", resp)
+		return
+	}
+	for _, c := range changes {
+		e := fileEntry(r, c.path)
+		e.Status = "file_patch"
+		e.Bytes = int64(len(c.data))
+		if c.from != c.path {
+			e.Path, e.Target = c.from, c.path
+		}
+		s.log(r.Context(), e)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// planPatch works out the new contents of every file without changing
+// anything. A patch that does not apply is a patch_failed error whose
+// details are the response, saying which files and hunks failed.
+func planPatch(cfg api.Config, root string, patches []filePatch, req api.PatchRequest) (api.PatchResponse, []patchChange, error) {
+	resp := api.PatchResponse{Root: root, DryRun: req.DryRun, Files: []api.PatchFile{}}
+	var changes []patchChange
+	failed := false
+	seen := map[string]bool{}
+	for _, fp := range patches {
+		c, pf, err := planFile(cfg, root, fp, req.Fuzz)
+		if err != nil {
+			return api.PatchResponse{}, nil, err
+		}
+		for _, p := range []string{c.from, c.path} {
+			if seen[p] {
+				return api.PatchResponse{}, nil, fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest,
+					"the diff changes '%s' more than once", p)
+			}
+		}
+		seen[c.from], seen[c.path] = true, true
+		if pf.Error != "" {
+			failed = true
+		}
+		resp.Files = append(resp.Files, pf)
+		changes = append(changes, c)
+	}
+	if failed {
+		return resp, nil, &fileError{status: http.StatusConflict, code: api.CodePatchFailed, details: resp,
+			msg: "the patch does not apply; nothing was changed"}
+	}
+	return resp, changes, nil
+}
+
+// planFile applies one file's hunks in memory. Problems with the file are
+// reported in the PatchFile; only the path policy and I/O errors are
+// returned as errors.
+func planFile(cfg api.Config, root string, fp filePatch, fuzz int) (patchChange, api.PatchFile, error) {
+	var c patchChange
+	pf := api.PatchFile{Op: api.PatchModify, Hunks: []api.PatchHunk{}}
+	switch {
+	case fp.oldName == "":
+		pf.Op = api.PatchCreate
+	case fp.newName == "":
+		pf.Op = api.PatchDelete
+	case fp.oldName != fp.newName:
+		pf.Op = api.PatchRename
+	}
+
+	for _, name := range []string{fp.oldName, fp.newName} {
+		if name == "" {
+			continue
+		}
+		p, err := entryPath(root, name)
+		if err == nil && p == root {
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "the diff names the directory '%s' itself", root)
+		}
+		if err == nil {
+			if err = checkFilePath(cfg, p); err != nil {
+				err = policyError(err)
+			}
+		}
+		if err != nil {
+			return c, pf, err
+		}
+		if c.from == "" {
+			c.from = p
+		}
+		c.path = p
+	}
+	pf.Path = c.path
+	if pf.Op == api.PatchRename {
+		pf.OldPath = c.from
+	}
+	if pf.Op == api.PatchDelete {
+		c.path = c.from
+	}
+
+	fail := func(format string, args ...interface{}) (patchChange, api.PatchFile, error) {
+		pf.Error = fmt.Sprintf(format, args...)
+		return c, pf, nil
+	}
+
+	c.mode = 0644
+	if pf.Op == api.PatchCreate {
+		if _, err := os.Lstat(c.path); err == nil {
+			return fail("'%s' already exists", c.path)
+		}
+	} else {
+		fi, err := os.Stat(c.from)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return fail("'%s' does not exist", c.from)
+		case err != nil:
+			return c, pf, err
+		case fi.IsDir():
+			return fail("'%s' is a directory", c.from)
+		case fi.Size() > maxFileSize(cfg):
+			return fail("'%s' is larger than files.max_file_mb", c.from)
+		}
+		c.mode = fi.Mode().Perm()
+		if c.orig, err = os.ReadFile(c.from); err != nil {
+			return c, pf, err
+		}
+		sum := sha256.Sum256(c.orig)
+		c.sum = hex.EncodeToString(sum[:])
+	}
+	if pf.Op == api.PatchRename {
+		if _, err := os.Lstat(c.path); err == nil {
+			return fail("'%s' already exists", c.path)
+		}
+	}
+
+	result, hunks, ok := applyHunks(splitText(c.orig), fp.hunks, fuzz)
+	pf.Hunks = hunks
+	switch {
+	case !ok:
+		return fail("%d of %d hunks do not apply", countFailed(hunks), len(hunks))
+	case pf.Op == api.PatchDelete && len(result.lines) > 0:
+		return fail("'%s' has lines the patch does not delete", c.from)
+	case pf.Op != api.PatchDelete && len(fp.hunks) == 0:
+		// A pure rename, or a new empty file, keeps the bytes as they
+		// are.
+		c.data = append([]byte{}, c.orig...)
+		sum := sha256.Sum256(c.data)
+		pf.SHA256 = hex.EncodeToString(sum[:])
+	case pf.Op != api.PatchDelete:
+		c.data = result.bytes()
+		sum := sha256.Sum256(c.data)
+		pf.SHA256 = hex.EncodeToString(sum[:])
+	}
+	return c, pf, nil
+}
+
+func countFailed(hunks []api.PatchHunk) int {
+	n := 0
+	for _, h := range hunks {
+		if !h.Applied {
+			n++
+		}
+	}
+	return n
+}
+
+// applyPatch writes the new contents to temporary files, then, holding
+// filesMu, checks that no file changed since it was read and replaces them
+// all. Should a replacement still fail, the files already replaced are
+// restored from what was read.
+func (s *Server) applyPatch(changes []patchChange) error {
+	defer func() {
+		for _, c := range changes {
+			if c.tmp != "" {
+				os.Remove(c.tmp)
+			}
+		}
+	}()
+	for i := range changes {
+		c := &changes[i]
+		if c.data == nil {
+			continue
+		}
+		dir := filepath.Dir(c.path)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		f, err := os.CreateTemp(dir, "."+filepath.Base(c.path)+".devproxy-*")
+		if err != nil {
+			return err
+		}
+		c.tmp = f.Name()
+		_, err = f.Write(c.data)
+		if err == nil {
+			err = f.Sync()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Chmod(c.tmp, c.mode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	s.filesMu.Lock()
+	defer s.filesMu.Unlock()
+	for _, c := range changes {
+		if c.sum != "" {
+			if err := checkExpectedHash(c.from, c.sum, true); err != nil {
+				return err
+			}
+		}
+		if c.from != c.path || c.sum == "" {
+			if err := checkExpectedHash(c.path, "absent", fileExists(c.path)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, c := range changes {
+		var err error
+		switch {
+		case c.data == nil:
+			err = os.Remove(c.from)
+		default:
+			err = replaceFileLocked(c.tmp, c.path, "", time.Time{})
+			if err == nil && c.from != c.path {
+				err = os.Remove(c.from)
+			}
+		}
+		if err != nil {
+			for _, done := range changes[:i+1] {
+				restoreFile(done)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// restoreFile undoes a change of applyPatch as far as possible.
+func restoreFile(c patchChange) {
+	if c.sum != "" {
+		os.WriteFile(c.from, c.orig, c.mode)
+	}
+	if c.from != c.path || c.sum == "" {
+		os.Remove(c.path)
+	}
+}
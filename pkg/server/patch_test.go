@@ -0,0 +1,248 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return string(data)
+}
+
+func patchBody(root, diff string, extra string) string {
+	return `{"root":` + mustJSON(root) + `,"diff":` + mustJSON(diff) + extra + `}`
+}
+
+const gitDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,4 +1,4 @@
+ package main
+
+-func old() {}
++func renamed() {}
+
+diff --git a/docs/new.md b/docs/new.md
+new file mode 100644
+--- /dev/null
++++ b/docs/new.md
+@@ -0,0 +1,2 @@
++# New
++text
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+diff --git a/old/name.go b/new/name.go
+similarity index 90%
+rename from old/name.go
+rename to new/name.go
+--- a/old/name.go
++++ b/new/name.go
+@@ -1,2 +1,2 @@
+-package old
++package new
+ // shared
+diff --git a/empty.txt b/empty.txt
+new file mode 100644
+index 0000000..e69de29
+`
+
+func TestPatchMultiFile(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	dir := cfg.AllowedPaths[0]
+	writeFiles(t, dir, map[string]string{
+		// Two lines more than the diff expects: the hunk applies at an
+		// offset.
+		"main.go":     "// Code generated.\n// Edit anyway.\npackage main\n\nfunc old() {}\n\n",
+		"gone.txt":    "bye\n",
+		"old/name.go": "package old\n// shared\n",
+	})
+
+	resp, data := request(t, ts, "POST", "/v1/files/patch", cfg.APIToken, patchBody(dir, gitDiff, ""))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("patch: %d %s", resp.StatusCode, data)
+	}
+	var pr api.PatchResponse
+	json.Unmarshal(data, &pr)
+	if !pr.Applied || len(pr.Files) != 5 {
+		t.Fatalf("response: %s", data)
+	}
+	if h := pr.Files[0].Hunks[0]; !h.Applied || h.Line != 3 || h.Offset != 2 || h.Fuzz != 0 {
+		t.Errorf("main.go hunk: %+v, want line 3 offset 2", h)
+	}
+	ops := []string{}
+	for _, f := range pr.Files {
+		ops = append(ops, f.Op)
+	}
+	if got := strings.Join(ops, " "); got != "modify create delete rename create" {
+		t.Errorf("ops %q", got)
+	}
+
+	for name, want := range map[string]string{
+		"main.go":     "// Code generated.\n// Edit anyway.\npackage main\n\nfunc renamed() {}\n\n",
+		"docs/new.md": "# New\ntext\n",
+		"new/name.go": "package new\n// shared\n",
+		"empty.txt":   "",
+	} {
+		if got := readFile(dir, name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	for _, name := range []string{"gone.txt", "old/name.go"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s still exists", name)
+		}
+	}
+}
+
+func TestPatchAllOrNothing(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	dir := cfg.AllowedPaths[0]
+	files := map[string]string{
+		"a.txt": "one\ntwo\nthree\n",
+		"b.txt": "ALPHA\nbeta\ngamma\ndelta\n",
+	}
+	writeFiles(t, dir, files)
+	diff := `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++2
+ three
+--- a/b.txt
++++ b/b.txt
+@@ -1,4 +1,4 @@
+ alpha
+ beta
+-gamma
++GAMMA
+ delta
+`
+
+	resp, data := request(t, ts, "POST", "/v1/files/patch", cfg.APIToken, patchBody(dir, diff, ""))
+	var er struct {
+		Code    string            `json:"code"`
+		Details api.PatchResponse `json:"details"`
+	}
+	json.Unmarshal(data, &er)
+	if resp.StatusCode != http.StatusConflict || er.Code != api.CodePatchFailed {
+		t.Fatalf("mismatched context: %d %s", resp.StatusCode, data)
+	}
+	if f := er.Details.Files; len(f) != 2 || f[0].Error != "" || f[1].Error == "" || f[1].Hunks[0].Applied || f[1].Hunks[0].Error == "" {
+		t.Errorf("details: %s", data)
+	}
+	for name, want := range files {
+		if got := readFile(dir, name); got != want {
+			t.Errorf("%s changed by a failed patch: %q", name, got)
+		}
+	}
+
+	// A dry run with fuzz reports how it would apply and changes nothing.
+	resp, data = request(t, ts, "POST", "/v1/files/patch", cfg.APIToken, patchBody(dir, diff, `,"fuzz":1,"dry_run":true`))
+	var pr api.PatchResponse
+	json.Unmarshal(data, &pr)
+	if resp.StatusCode != http.StatusOK || pr.Applied || !pr.DryRun || pr.Files[1].Hunks[0].Fuzz != 1 {
+		t.Fatalf("dry run: %d %s", resp.StatusCode, data)
+	}
+	if got := readFile(dir, "a.txt"); got != files["a.txt"] {
+		t.Errorf("dry run changed a.txt: %q", got)
+	}
+
+	resp, data = request(t, ts, "POST", "/v1/files/patch", cfg.APIToken, patchBody(dir, diff, `,"fuzz":1`))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("with fuzz: %d %s", resp.StatusCode, data)
+	}
+	if got := readFile(dir, "b.txt"); got != "ALPHA\nbeta\nGAMMA\ndelta\n" {
+		t.Errorf("b.txt = %q", got)
+	}
+}
+
+func TestPatchLineEndings(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	dir := cfg.AllowedPaths[0]
+	writeFiles(t, dir, map[string]string{
+		"win.txt":   "one\r\ntwo\r\n",
+		"noeol.txt": "one\ntwo",
+	})
+	diff := `--- win.txt
++++ win.txt
+@@ -1,2 +1,3 @@
+ one
+ two
++three
+--- noeol.txt
++++ noeol.txt
+@@ -1,2 +1,3 @@
+ one
+-two
+\ No newline at end of file
++two
++three
+`
+	resp, data := request(t, ts, "POST", "/v1/files/patch", cfg.APIToken, patchBody(dir, diff, ""))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("patch: %d %s", resp.StatusCode, data)
+	}
+	if got := readFile(dir, "win.txt"); got != "one\r\ntwo\r\nthree\r\n" {
+		t.Errorf("win.txt = %q", got)
+	}
+	if got := readFile(dir, "noeol.txt"); got != "one\ntwo\nthree\n" {
+		t.Errorf("noeol.txt = %q", got)
+	}
+}
+
+func TestPatchRejects(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	dir := cfg.AllowedPaths[0]
+	writeFiles(t, dir, map[string]string{"a.txt": "a\n"})
+
+	tests := []struct {
+		name   string
+		diff   string
+		status int
+		code   string
+	}{
+		{"escape", "--- a/../x\n+++ b/../x\n@@ -0,0 +1 @@\n+x\n", http.StatusForbidden, api.CodePolicyViolation},
+		{"absolute", "--- /etc/passwd\n+++ /etc/passwd\n@@ -1 +1 @@\n-a\n+b\n", http.StatusForbidden, api.CodePolicyViolation},
+		{"bad counts", "--- a.txt\n+++ a.txt\n@@ -1,2 +1,2 @@\n-a\n+b\n", http.StatusBadRequest, api.CodeInvalidRequest},
+		{"no files", "just text\n", http.StatusBadRequest, api.CodeInvalidRequest},
+		{"binary", "diff --git a/x b/x\nBinary files a/x and b/x differ\n", http.StatusBadRequest, api.CodeInvalidRequest},
+		{"missing file", "--- a/nope.txt\n+++ b/nope.txt\n@@ -1 +1 @@\n-a\n+b\n", http.StatusConflict, api.CodePatchFailed},
+		{"create existing", "--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1 @@\n+a\n", http.StatusConflict, api.CodePatchFailed},
+	}
+	for _, tt := range tests {
+		resp, data := request(t, ts, "POST", "/v1/files/patch", cfg.APIToken, patchBody(dir, tt.diff, ""))
+		if resp.StatusCode != tt.status || errorCode(t, data) != tt.code {
+			t.Errorf("%s: %d %s, want %d %s", tt.name, resp.StatusCode, data, tt.status, tt.code)
+		}
+	}
+	if got := readFile(dir, "a.txt"); got != "a\n" {
+		t.Errorf("a.txt = %q", got)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package server
+
+import (
+	"fmt"
+	"net"
+)
+
+// peerUID is not implemented on this platform, so every connection to a
+// Unix socket is rejected rather than trusted.
+func peerUID(c net.Conn) (int, error) {
+	return 0, fmt.Errorf("peer credentials are not supported on this platform")
+}
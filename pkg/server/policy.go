@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+func validateRequest(ctx context.Context, cfg api.Config, req *api.RunRequest) (err error) {
+	_, span := tracer.Start(ctx, "devproxy.validate", trace.WithAttributes(
+		attribute.String("devproxy.command", req.Command),
+		attribute.String("devproxy.cwd", req.CWD),
+	))
+	defer func() {
+		if err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if !isCommandAllowed(cfg, req.Command) {
+		return fmt.Errorf("command '%s' is not allowed", req.Command)
+	}
+
+	if !isPathAllowed(cfg, req.CWD) {
+		return fmt.Errorf("working directory '%s' is not in allowed paths", req.CWD)
+	}
+
+	fullCmd := req.Command + " " + strings.Join(req.Args, " ")
+	fullCmdLower := strings.ToLower(fullCmd)
+	for _, banned := range api.BannedKeywords {
+		// Check for banned keyword with word boundaries
+		// This prevents false positives like "Scripts" matching "sc"
+		if banned == "sc" {
+			// Special case for "sc" - must be whole word
+			if strings.Contains(fullCmdLower, " "+banned+" ") ||
+				strings.HasPrefix(fullCmdLower, banned+" ") ||
+				strings.HasSuffix(fullCmdLower, " "+banned) ||
+				fullCmdLower == banned {
+				return fmt.Errorf("command contains banned keyword: %s", banned)
+			}
+		} else if strings.Contains(fullCmdLower, banned) {
+			return fmt.Errorf("command contains banned keyword: %s", banned)
+		}
+	}
+
+	for _, arg := range req.Args {
+		if strings.Contains(arg, "..") {
+			return fmt.Errorf("path traversal detected in arguments")
+		}
+
+		// Relative arguments are resolved against the request's working
+		// directory, not the server's (a Windows service starts in
+		// System32, which would make every relative argument restricted).
+		argPath := arg
+		if !filepath.IsAbs(argPath) {
+			argPath = filepath.Join(req.CWD, arg)
+		}
+		if isRestrictedPath(argPath) {
+			return fmt.Errorf("argument contains restricted path: %s", arg)
+		}
+	}
+
+	return nil
+}
+
+func isCommandAllowed(cfg api.Config, cmd string) bool {
+	cmd = strings.ToLower(filepath.Base(cmd))
+	cmd = strings.TrimSuffix(cmd, ".exe")
+
+	for _, allowed := range cfg.AllowedCmds {
+		if strings.ToLower(allowed) == cmd {
+			return true
+		}
+	}
+	return false
+}
+
+func isPathAllowed(cfg api.Config, path string) bool {
+	if path == "" {
+		return false
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	for _, allowed := range cfg.AllowedPaths {
+		if strings.Contains(allowed, "*") {
+			if matchPathGlob(allowed, absPath) {
+				return true
+			}
+		} else {
+			if withinPath(absPath, allowed) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchPathGlob reports whether absPath, or a directory above it, matches
+// pattern, a glob such as /home/*/Projects in which * stands for part of
+// one path element.
+func matchPathGlob(pattern, absPath string) bool {
+	pattern, parts, n := globElements(pattern, absPath)
+	if len(parts) < n {
+		return false
+	}
+	matched, _ := path.Match(pattern, strings.Join(parts[:n], "/"))
+	return matched
+}
+
+// isGlobRoot reports whether absPath is a directory that pattern names
+// itself, such as /home/alice/Projects for /home/*/Projects, rather than
+// one beneath it.
+func isGlobRoot(pattern, absPath string) bool {
+	_, parts, n := globElements(pattern, absPath)
+	return len(parts) == n && matchPathGlob(pattern, absPath)
+}
+
+// globElements normalizes pattern and absPath for comparison by element,
+// returning the pattern, the path's elements and the pattern's count of
+// elements.
+func globElements(pattern, absPath string) (string, []string, int) {
+	pattern = foldPath(strings.TrimRight(strings.ReplaceAll(pattern, "\\", "/"), "/"))
+	absPath = foldPath(strings.TrimRight(strings.ReplaceAll(absPath, "\\", "/"), "/"))
+	return pattern, strings.Split(absPath, "/"), strings.Count(pattern, "/") + 1
+}
+
+// withinPath reports whether the absolute path p is dir or lies beneath
+// it, so that /srv/dev does not take in /srv/dev-secrets.
+func withinPath(p, dir string) bool {
+	p, dir = foldPath(p), foldPath(filepath.Clean(dir))
+	if p == dir {
+		return true
+	}
+	if !strings.HasSuffix(dir, string(filepath.Separator)) {
+		dir += string(filepath.Separator)
+	}
+	return strings.HasPrefix(p, dir)
+}
+
+func isRestrictedPath(path string) bool {
+	absPath, _ := filepath.Abs(path)
+
+	for _, r := range restrictedPaths {
+		if withinPath(absPath, r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkFilePath applies the path policy to a /files request. The path must
+// be absolute, and it is checked both as given and with symlinks resolved,
+// so that a link inside an allowed path cannot reach outside it.
+func checkFilePath(cfg api.Config, path string) error {
+	if path == "" {
+		return fmt.Errorf("path is required")
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("path '%s' is not absolute", path)
+	}
+	if !isPathAllowed(cfg, path) {
+		return fmt.Errorf("path '%s' is not in allowed paths", path)
+	}
+	if isRestrictedPath(path) {
+		return fmt.Errorf("path '%s' is restricted", path)
+	}
+
+	resolved := cfg
+	resolved.AllowedPaths = make([]string, len(cfg.AllowedPaths))
+	for i, allowed := range cfg.AllowedPaths {
+		if !strings.Contains(allowed, "*") {
+			allowed = resolveExisting(allowed)
+		}
+		resolved.AllowedPaths[i] = allowed
+	}
+	real := resolveExisting(path)
+	if !isPathAllowed(resolved, real) || isRestrictedPath(real) {
+		return fmt.Errorf("path '%s' resolves to '%s', which is not allowed", path, real)
+	}
+	return nil
+}
+
+// isAllowedRoot reports whether path is one of the allowed paths itself,
+// or a directory a wildcard entry names, which may be read and written
+// into but not moved or deleted.
+func isAllowedRoot(cfg api.Config, path string) bool {
+	path = filepath.Clean(path)
+	for _, allowed := range cfg.AllowedPaths {
+		if strings.Contains(allowed, "*") {
+			if isGlobRoot(allowed, path) {
+				return true
+			}
+		} else if foldPath(filepath.Clean(allowed)) == foldPath(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveExisting evaluates symlinks in the longest existing prefix of path
+// and appends the rest unchanged.
+func resolveExisting(path string) string {
+	path = filepath.Clean(path)
+	rest := ""
+	for {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(real, rest)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest)
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"runtime"
+	"testing"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+func TestIsPathAllowed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix paths")
+	}
+	cfg := api.Config{AllowedPaths: []string{"/home/*/Projects", "/srv/dev", "/opt/x*y", "/data/"}}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/home/alice/Projects", true},
+		{"/home/alice/Projects/app/main.go", true},
+		{"/home/alice/Projects2", false},
+		{"/home/alice/src/Projects", false},
+		{"/home/alice", false},
+		{"/home/a/b/Projects", false},
+		{"/opt/xzy/f", true},
+		{"/opt/x/y", false},
+		{"/srv/dev", true},
+		{"/srv/dev/app", true},
+		{"/srv/dev-secrets", false},
+		{"/srv/dev-secrets/key", false},
+		{"/srv/devx", false},
+		{"/data", true},
+		{"/data/f", true},
+		{"/database", false},
+	}
+	for _, tt := range tests {
+		if got := isPathAllowed(cfg, tt.path); got != tt.want {
+			t.Errorf("isPathAllowed(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestGlobRootIsProtected(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix paths")
+	}
+	cfg := api.Config{AllowedPaths: []string{"/home/*/Projects", "/srv/dev"}}
+	tests := []struct {
+		path    string
+		allowed bool
+		root    bool
+	}{
+		{"/home/alice/Projects", true, true},
+		{"/home/alice/Projects/", true, true},
+		{"/home/alice/Projects/x", true, false},
+		{"/home/alice/Projects/x/y", true, false},
+		{"/home/alice", false, false},
+		{"/srv/dev", true, true},
+		{"/srv/dev/x", true, false},
+	}
+	for _, tt := range tests {
+		if got := isPathAllowed(cfg, tt.path); got != tt.allowed {
+			t.Errorf("isPathAllowed(%q) = %v, want %v", tt.path, got, tt.allowed)
+		}
+		if got := isAllowedRoot(cfg, tt.path); got != tt.root {
+			t.Errorf("isAllowedRoot(%q) = %v, want %v", tt.path, got, tt.root)
+		}
+	}
+}
+
+func TestIsRestrictedPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix paths")
+	}
+	for path, want := range map[string]bool{
+		"/etc":          true,
+		"/etc/passwd":   true,
+		"/etcetera/x":   false,
+		"/usr/bin/go":   true,
+		"/usrdata":      false,
+		"/home/etc/usr": false,
+	} {
+		if got := isRestrictedPath(path); got != want {
+			t.Errorf("isRestrictedPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestDefaultAllowedPathsMatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Linux defaults")
+	}
+	cfg := api.DefaultConfig()
+	for _, p := range []string{"/home/alice/Projects/app", "/home/alice/src/app/main.go", "/srv/dev/app"} {
+		if !isPathAllowed(cfg, p) {
+			t.Errorf("default allowed_paths do not allow %s", p)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package server
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// prepareCommand starts the command in its own process group so that
+// killProcessTree reaches every descendant.
+func prepareCommand(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessTree(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,18 @@
+package server
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+func prepareCommand(cmd *exec.Cmd) {}
+
+// killProcessTree uses taskkill /T, which walks the parent-child tree that
+// Windows records for every process.
+func killProcessTree(cmd *exec.Cmd) error {
+	err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+	if err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var errQueueFull = errors.New("run queue is full")
+
+// runQueue limits how many commands run at once. It is sized from the
+// startup config; changing max_concurrent requires a restart, while
+// max_queued is re-read on every request.
+type runQueue struct {
+	slots   chan struct{}
+	queued  int64
+	running int64
+}
+
+func newRunQueue(maxConcurrent int) *runQueue {
+	return &runQueue{slots: make(chan struct{}, maxConcurrent)}
+}
+
+// acquire blocks until a command may start, the request is cancelled or
+// shutdown begins, or immediately fails with errQueueFull when more than
+// maxQueued requests are waiting. The returned function releases the slot.
+func (q *runQueue) acquire(ctx context.Context, maxQueued int, shutdown <-chan struct{}) (func(), error) {
+	_, span := tracer.Start(ctx, "devproxy.queue")
+	defer span.End()
+
+	if atomic.AddInt64(&q.queued, 1) > int64(maxQueued) {
+		atomic.AddInt64(&q.queued, -1)
+		span.SetStatus(codes.Error, errQueueFull.Error())
+		return nil, errQueueFull
+	}
+	defer atomic.AddInt64(&q.queued, -1)
+
+	select {
+	case q.slots <- struct{}{}:
+	case <-ctx.Done():
+		span.SetStatus(codes.Error, ctx.Err().Error())
+		return nil, ctx.Err()
+	case <-shutdown:
+		span.SetStatus(codes.Error, errShuttingDown.Error())
+		return nil, errShuttingDown
+	}
+
+	running := atomic.AddInt64(&q.running, 1)
+	span.SetAttributes(attribute.Int64("devproxy.running", running))
+
+	return func() {
+		atomic.AddInt64(&q.running, -1)
+		<-q.slots
+	}, nil
+}
+
+func (q *runQueue) stats() (running, queued int64) {
+	return atomic.LoadInt64(&q.running), atomic.LoadInt64(&q.queued)
+}
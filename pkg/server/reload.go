@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// restartOnly reports whether the config field with the given JSON name is
+// one of api.RestartOnlyFields.
+func restartOnly(name string) bool {
+	return slices.Contains(api.RestartOnlyFields, name)
+}
+
+var errNoConfigSource = errors.New("server has no config source to reload from")
+
+// Reload fetches a fresh config from Options.Load, validates it and
+// atomically swaps it in. On any failure the running configuration is left
+// untouched. source describes what triggered the reload; the outcome is
+// written to the audit log as config_reloaded or config_reload_failed. It
+// returns a summary of what changed.
+func (s *Server) Reload(source string) ([]string, error) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	changes, err := s.apply()
+	if err != nil {
+		s.printf("Config reload (%s) failed: %v", source, err)
+		s.log(context.Background(), api.LogEntry{
+			Timestamp: time.Now().Format(time.RFC3339),
+			IP:        "system",
+			Status:    "config_reload_failed",
+			Reason:    fmt.Sprintf("%s: %v", source, err),
+		})
+		return nil, err
+	}
+
+	summary := "no changes"
+	if len(changes) > 0 {
+		summary = strings.Join(changes, "; ")
+	}
+	s.printf("Config reloaded (%s): %s", source, summary)
+	s.log(context.Background(), api.LogEntry{
+		Timestamp: time.Now().Format(time.RFC3339),
+		IP:        "system",
+		Status:    "config_reloaded",
+		Reason:    fmt.Sprintf("%s: %s", source, summary),
+	})
+	return changes, nil
+}
+
+func (s *Server) apply() ([]string, error) {
+	if s.opts.Load == nil {
+		return nil, errNoConfigSource
+	}
+	next, err := s.opts.Load()
+	if err != nil {
+		return nil, err
+	}
+	api.ApplyDefaults(&next)
+	if err := api.ValidateConfig(next); err != nil {
+		return nil, err
+	}
+
+	prev := s.Config()
+	if next.LogFile != prev.LogFile {
+		if r, ok := s.logger.(interface{ Reopen(string) error }); ok {
+			if err := r.Reopen(next.LogFile); err != nil {
+				return nil, fmt.Errorf("cannot open new log file: %v", err)
+			}
+		}
+	}
+
+	changes := diffConfig(prev, next)
+	keepRestartOnly(prev, &next)
+	s.cfgMu.Lock()
+	s.cfg = next
+	s.cfgMu.Unlock()
+	return changes, nil
+}
+
+// keepRestartOnly copies the restart-only fields of the running config
+// into next, so that the config in effect, which /version reports, does not
+// claim settings that are not applied yet. The change is still reported on
+// every reload until a restart picks it up.
+func keepRestartOnly(running api.Config, next *api.Config) {
+	rv, nv := reflect.ValueOf(running), reflect.ValueOf(next).Elem()
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if restartOnly(strings.Split(t.Field(i).Tag.Get("json"), ",")[0]) {
+			nv.Field(i).Set(rv.Field(i))
+		}
+	}
+}
+
+// diffConfig summarizes the differences between two configs by JSON field
+// name. Secrets are reported as changed without their values.
+func diffConfig(prev, next api.Config) []string {
+	var changes []string
+
+	pv, nv := reflect.ValueOf(prev), reflect.ValueOf(next)
+	t := pv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		a, b := pv.Field(i).Interface(), nv.Field(i).Interface()
+		if reflect.DeepEqual(a, b) {
+			continue
+		}
+
+		var change string
+		switch {
+		case name == "api_token":
+			change = "api_token changed"
+		case pv.Field(i).Type() == reflect.TypeOf([]string(nil)):
+			added, removed := diffStrings(a.([]string), b.([]string))
+			change = fmt.Sprintf("%s +%d -%d", name, len(added), len(removed))
+			if len(added) > 0 {
+				change += fmt.Sprintf(" added [%s]", strings.Join(added, ", "))
+			}
+			if len(removed) > 0 {
+				change += fmt.Sprintf(" removed [%s]", strings.Join(removed, ", "))
+			}
+		case pv.Field(i).Kind() == reflect.Struct, pv.Field(i).Kind() == reflect.Slice, pv.Field(i).Kind() == reflect.Map:
+			change = name + " changed"
+		default:
+			change = fmt.Sprintf("%s %v -> %v", name, a, b)
+		}
+		if restartOnly(name) {
+			change += " (restart required)"
+		}
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+func diffStrings(prev, next []string) (added, removed []string) {
+	in := func(list []string, s string) bool {
+		for _, v := range list {
+			if v == s {
+				return true
+			}
+		}
+		return false
+	}
+	for _, s := range next {
+		if !in(prev, s) {
+			added = append(added, s)
+		}
+	}
+	for _, s := range prev {
+		if !in(next, s) {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+func (s *Server) handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if s.opts.Load == nil {
+		writeError(w, http.StatusNotImplemented, api.CodeReloadUnavailable, errNoConfigSource.Error(), nil)
+		return
+	}
+	changes, err := s.Reload("admin endpoint from " + r.RemoteAddr)
+	if err != nil {
+		var details interface{}
+		if problems, ok := err.(api.ConfigErrors); ok {
+			details = problems
+		}
+		writeError(w, http.StatusUnprocessableEntity, api.CodeInvalidConfig, err.Error(), details)
+		return
+	}
+	writeJSON(w, http.StatusOK, api.ReloadResponse{Status: "reloaded", Changes: changes})
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+func TestReloadKeepsRestartOnlyFields(t *testing.T) {
+	dir := t.TempDir()
+	cfg := api.DefaultConfig()
+	cfg.APIToken = "test-token-0123456789"
+	cfg.AllowedCmds = []string{"go"}
+	cfg.AllowedPaths = []string{dir}
+
+	next := cfg
+	next.Port = cfg.Port + 1
+	next.MaxConcurrent = cfg.MaxConcurrent + 1
+	next.TLS = api.TLSConfig{SelfSigned: true, ClientCAFile: "ca.pem", ClientIdentities: []string{"alice"}}
+	next.AllowedCmds = []string{"go", "npm"}
+	s, err := New(cfg, Options{
+		Executor: stubExecutor{},
+		Logger:   discardLogger{},
+		StateDir: dir,
+		Load:     func() (api.Config, error) { return next, nil },
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		changes, err := s.Reload("test")
+		if err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+		// The pending restart is reported until it happens.
+		if got := strings.Join(changes, "; "); !strings.Contains(got, "port") || !strings.Contains(got, "(restart required)") {
+			t.Errorf("reload %d: changes %q", i, got)
+		}
+	}
+	got := s.Config()
+	if got.Port != cfg.Port || got.MaxConcurrent != cfg.MaxConcurrent || got.TLS.Enabled() || len(got.TLS.ClientIdentities) != 0 {
+		t.Errorf("restart-only fields took effect: port %d, max_concurrent %d, client_identities %v",
+			got.Port, got.MaxConcurrent, got.TLS.ClientIdentities)
+	}
+	if len(got.AllowedCmds) != 2 {
+		t.Errorf("allowed_commands = %v, want the reloaded list", got.AllowedCmds)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// routes builds the mux from api.Endpoints. Every endpoint is served under
+// api.Prefix and, for clients written before versioning, at its bare path.
+func (s *Server) routes() *http.ServeMux {
+	handlers := map[string]http.HandlerFunc{
+		"/run":                       s.handleRun,
+		"/healthz":                   s.handleHealthz,
+		"/readyz":                    s.handleReadyz,
+		"/version":                   s.handleVersion,
+		"/admin/reload":              s.handleAdminReload,
+		"/files/stat":                s.handleFileStat,
+		"/files/list":                s.handleFileList,
+		"/files/read":                s.handleFileRead,
+		"/files/write":               s.handleFileWrite,
+		"/files/manifest":            s.handleFileManifest,
+		"/files/archive":             s.handleFileArchive,
+		"/files/extract":             s.handleFileExtract,
+		"/files/patch":               s.handleFilePatch,
+		"/files/watch":               s.handleFileWatch,
+		"/files/search":              s.handleFileSearch,
+		"/files/mkdir":               s.handleFileMkdir,
+		"/files/move":                s.handleFileMove,
+		"/files/delete":              s.handleFileDelete,
+		"/files/uploads":             s.handleUploads,
+		"/files/uploads/{id}":        s.handleUpload,
+		"/files/uploads/{id}/commit": s.handleUploadCommit,
+		"/openapi.json":              handleOpenAPI,
+	}
+
+	mux := http.NewServeMux()
+	registered := map[string]bool{}
+	for _, ep := range api.Endpoints {
+		// Handlers for paths with several methods dispatch on the
+		// method themselves.
+		if registered[ep.Path] {
+			continue
+		}
+		registered[ep.Path] = true
+		h, ok := handlers[ep.Path]
+		if !ok {
+			panic("server: no handler for " + ep.Path)
+		}
+		if ep.Auth {
+			h = s.authMiddleware(h)
+		}
+		mux.HandleFunc(api.Prefix+ep.Path, h)
+		mux.HandleFunc(ep.Path, h)
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, api.CodeNotFound, fmt.Sprintf("No endpoint at %s", r.URL.Path), nil)
+	})
+	return mux
+}
+
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(api.OpenAPI())
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError sends an api.ErrorResponse. Every error the API returns goes
+// through here so clients can rely on the shape.
+func writeError(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	writeJSON(w, status, api.ErrorResponse{Code: code, Message: message, Details: details})
+}
+
+func writeMethodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	writeError(w, http.StatusMethodNotAllowed, api.CodeMethodNotAllowed, "Use "+allowed, nil)
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+const (
+	defaultSearchResults = 1000
+	maxSearchResults     = 100000
+	maxSearchContext     = 50
+	// maxSearchLine is the longest line returned; longer ones, such as
+	// minified code, are cut short.
+	maxSearchLine = 1000
+	// binarySniffLen is how much of a file is checked for a NUL byte, as
+	// git does.
+	binarySniffLen = 8000
+)
+
+func (s *Server) handleFileSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	cfg := s.Config()
+	var req api.SearchRequest
+	err := decodeFileRequest(r, &req)
+	entry := fileEntry(r, req.Path)
+	if err == nil {
+		if err = checkFilePath(cfg, req.Path); err != nil {
+			err = policyError(err)
+		}
+	}
+	if err == nil {
+		if err = api.ValidateExcludes(req.Include); err == nil {
+			err = api.ValidateExcludes(req.Exclude)
+		}
+		if err != nil {
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "%v", err)
+		}
+	}
+	if err == nil {
+		switch {
+		case req.Context < 0 || req.Context > maxSearchContext:
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "context must be between 0 and %d", maxSearchContext)
+		case req.MaxResults < 0 || req.MaxResults > maxSearchResults:
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "max_results must be between 0 and %d", maxSearchResults)
+		}
+	}
+	var re *regexp.Regexp
+	if err == nil && req.Pattern != "" {
+		expr := req.Pattern
+		if req.Literal {
+			expr = regexp.QuoteMeta(expr)
+		}
+		if req.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		if re, err = regexp.Compile(expr); err != nil {
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "invalid pattern: %v", err)
+		}
+	}
+	var resp api.SearchResponse
+	if err == nil {
+		resp, err = searchTree(r.Context(), cfg, req, re)
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "search", err)
+		return
+	}
+	if re != nil {
+		entry.Reason = fmt.Sprintf("%d matches in %d of %d files", len(resp.Matches), len(resp.Files), resp.Searched)
+	} else {
+		entry.Reason = fmt.Sprintf("%d files", len(resp.Files))
+	}
+	s.fileDone(w, r, entry, "file_search", resp)
+}
+
+// searchTree walks req.Path, skipping what walkTree skips as well as
+// ignored files, and lists or searches the files it finds.
+func searchTree(ctx context.Context, cfg api.Config, req api.SearchRequest, re *regexp.Regexp) (api.SearchResponse, error) {
+	root := filepath.Clean(req.Path)
+	resp := api.SearchResponse{Path: root, Files: []string{}, Matches: []api.SearchMatch{}}
+	limit := req.MaxResults
+	if limit == 0 {
+		limit = defaultSearchResults
+	}
+
+	fi, err := os.Stat(root)
+	if err != nil {
+		return resp, err
+	}
+	if !fi.IsDir() {
+		// A single file is searched whatever the filters say.
+		if re == nil {
+			resp.Files = append(resp.Files, fi.Name())
+			return resp, nil
+		}
+		err := searchFile(cfg, root, fi.Name(), re, req.Context, limit, &resp)
+		return resp, err
+	}
+
+	var ig gitignore
+	if !req.NoIgnore {
+		loadParentIgnores(cfg, root, &ig)
+	}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p != root && os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p == root {
+			if !req.NoIgnore {
+				ig.load(p, "", "")
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		isDir := d.IsDir()
+		skip := api.Excluded(rel, req.Exclude) || d.Type()&fs.ModeSymlink != 0 || isRestrictedPath(p) ||
+			(!req.NoIgnore && ((isDir && d.Name() == ".git") || ig.ignored(rel, isDir)))
+		switch {
+		case skip && isDir:
+			return filepath.SkipDir
+		case skip:
+			return nil
+		case isDir:
+			if !req.NoIgnore {
+				ig.load(p, rel, "")
+			}
+			return nil
+		case !d.Type().IsRegular():
+			return nil
+		case len(req.Include) > 0 && !api.Excluded(rel, req.Include):
+			return nil
+		}
+
+		if re == nil {
+			resp.Files = append(resp.Files, rel)
+		} else if err := searchFile(cfg, p, rel, re, req.Context, limit, &resp); err != nil {
+			return err
+		}
+		if len(resp.Files) >= limit || len(resp.Matches) >= limit {
+			resp.Truncated = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return resp, err
+}
+
+// loadParentIgnores adds the .gitignore files of root's parents, up to the
+// repository root (the directory holding .git) and only as far as the path
+// policy allows, outermost first.
+func loadParentIgnores(cfg api.Config, root string, ig *gitignore) {
+	if _, err := os.Lstat(filepath.Join(root, ".git")); err == nil {
+		return
+	}
+	var dirs []string
+	for dir := root; ; {
+		parent := filepath.Dir(dir)
+		if parent == dir || checkFilePath(cfg, parent) != nil {
+			return
+		}
+		dirs = append(dirs, parent)
+		if _, err := os.Lstat(filepath.Join(parent, ".git")); err == nil {
+			break
+		}
+		dir = parent
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rel, err := filepath.Rel(dirs[i], root)
+		if err != nil {
+			return
+		}
+		ig.load(dirs[i], "", filepath.ToSlash(rel)+"/")
+	}
+}
+
+// searchFile adds the lines of the file at p matching re to resp, with
+// context lines around them. Binary and oversized files are counted as
+// skipped. It stops at limit matches, once the last one has its context.
+func searchFile(cfg api.Config, p, rel string, re *regexp.Regexp, context, limit int, resp *api.SearchResponse) error {
+	f, err := os.Open(p)
+	if err != nil {
+		if os.IsPermission(err) {
+			resp.Skipped++
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err == nil && fi.Size() > maxFileSize(cfg) {
+		resp.Skipped++
+		return nil
+	}
+
+	br := bufio.NewReaderSize(f, 64*1024)
+	head, _ := br.Peek(binarySniffLen)
+	if bytes.IndexByte(head, 0) >= 0 {
+		resp.Skipped++
+		return nil
+	}
+	resp.Searched++
+
+	sc := bufio.NewScanner(br)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var before []string
+	var pending []int // matches still collecting After lines
+	found := false
+	for line := 1; sc.Scan(); line++ {
+		text := clipLine(strings.TrimSuffix(sc.Text(), "\r"))
+		for _, i := range pending {
+			resp.Matches[i].After = append(resp.Matches[i].After, text)
+		}
+		if len(pending) > 0 && len(resp.Matches[pending[0]].After) == context {
+			pending = pending[1:]
+		}
+
+		if len(resp.Matches) < limit {
+			if loc := re.FindStringIndex(text); loc != nil {
+				resp.Matches = append(resp.Matches, api.SearchMatch{
+					Path:   rel,
+					Line:   line,
+					Column: loc[0] + 1,
+					Text:   text,
+					Before: append([]string(nil), before...),
+				})
+				if context > 0 {
+					pending = append(pending, len(resp.Matches)-1)
+				}
+				found = true
+			}
+		} else if len(pending) == 0 {
+			break
+		}
+
+		if context > 0 {
+			if len(before) == context {
+				before = before[1:]
+			}
+			before = append(before, text)
+		}
+	}
+	if found {
+		resp.Files = append(resp.Files, rel)
+	}
+	if err := sc.Err(); err != nil && err != bufio.ErrTooLong {
+		return err
+	}
+	return nil
+}
+
+// clipLine cuts s to maxSearchLine bytes, on a character boundary.
+func clipLine(s string) string {
+	if len(s) <= maxSearchLine {
+		return s
+	}
+	i := maxSearchLine
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return s[:i]
+}
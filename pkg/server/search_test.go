@@ -0,0 +1,148 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+func TestSearch(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	dir := cfg.AllowedPaths[0]
+	writeFiles(t, dir, map[string]string{
+		".git/config":    "needle\n",
+		".gitignore":     "build/\n*.log\n!keep.log\n/top.txt\n",
+		"main.go":        "package main\n\n// needle one\nfunc main() {}\n// Needle two\n",
+		"src/.gitignore": "gen_*.go\n",
+		"src/a.go":       "package src\r\nvar x = \"a.b needle\"\r\n",
+		"src/gen_x.go":   "needle\n",
+		"src/top.txt":    "needle\n",
+		"src/x.log":      "needle\n",
+		"build/out.go":   "needle\n",
+		"debug.log":      "needle\n",
+		"keep.log":       "needle\n",
+		"top.txt":        "needle\n",
+		"bin.dat":        "needle\x00\x01\n",
+	})
+
+	search := func(body string) api.SearchResponse {
+		t.Helper()
+		resp, data := request(t, ts, "POST", "/v1/files/search", cfg.APIToken, `{"path":`+mustJSON(dir)+body+`}`)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("search %s: %d %s", body, resp.StatusCode, data)
+		}
+		var sr api.SearchResponse
+		json.Unmarshal(data, &sr)
+		return sr
+	}
+	files := func(sr api.SearchResponse) string { return strings.Join(sr.Files, " ") }
+
+	tests := []struct {
+		body, want string
+	}{
+		{``, ".gitignore bin.dat keep.log main.go src/.gitignore src/a.go src/top.txt"},
+		{`,"include":["*.go"]`, "main.go src/a.go"},
+		{`,"include":["*.go"],"no_ignore":true`, "build/out.go main.go src/a.go src/gen_x.go"},
+		{`,"include":["src"],"exclude":["*.txt"]`, "src/.gitignore src/a.go"},
+		{`,"pattern":"needle"`, "keep.log main.go src/a.go src/top.txt"},
+		{`,"pattern":"needle","ignore_case":true,"include":["*.go"]`, "main.go src/a.go"},
+		{`,"pattern":"a.b","literal":true`, "src/a.go"},
+		{`,"pattern":"a\\.c"`, ""},
+	}
+	for _, tt := range tests {
+		if got := files(search(tt.body)); got != tt.want {
+			t.Errorf("%s: files %q, want %q", tt.body, got, tt.want)
+		}
+	}
+
+	sr := search(`,"pattern":"(?i)needle","context":1,"include":["main.go","src/a.go"]`)
+	want := []api.SearchMatch{
+		{Path: "main.go", Line: 3, Column: 4, Text: "// needle one", Before: []string{""}, After: []string{"func main() {}"}},
+		{Path: "main.go", Line: 5, Column: 4, Text: "// Needle two", Before: []string{"func main() {}"}},
+		{Path: "src/a.go", Line: 2, Column: 14, Text: `var x = "a.b needle"`, Before: []string{"package src"}},
+	}
+	if got, _ := json.Marshal(sr.Matches); string(got) != string(mustMarshal(t, want)) {
+		t.Errorf("matches:\n%s\nwant\n%s", got, mustMarshal(t, want))
+	}
+	if sr.Searched != 2 || sr.Truncated {
+		t.Errorf("searched %d, truncated %v", sr.Searched, sr.Truncated)
+	}
+
+	sr = search(`,"pattern":"needle","no_ignore":true`)
+	if sr.Skipped != 1 {
+		t.Errorf("binary file not skipped: %+v", sr)
+	}
+	sr = search(`,"pattern":"needle","max_results":2`)
+	if len(sr.Matches) != 2 || !sr.Truncated {
+		t.Errorf("max_results: %d matches, truncated %v", len(sr.Matches), sr.Truncated)
+	}
+
+	// A search below the repository root still honours its .gitignore.
+	resp, data := request(t, ts, "POST", "/v1/files/search", cfg.APIToken,
+		`{"path":`+mustJSON(filepath.Join(dir, "src"))+`,"pattern":"needle"}`)
+	if err := json.Unmarshal(data, &sr); err != nil || resp.StatusCode != http.StatusOK || files(sr) != "a.go top.txt" {
+		t.Errorf("search in src: %d %s", resp.StatusCode, data)
+	}
+
+	for _, body := range []string{`,"pattern":"("`, `,"context":51`, `,"max_results":-1`, `,"include":["["]`} {
+		resp, data := request(t, ts, "POST", "/v1/files/search", cfg.APIToken, `{"path":`+mustJSON(dir)+body+`}`)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: %d %s, want 400", body, resp.StatusCode, data)
+		}
+	}
+	resp, data = request(t, ts, "POST", "/v1/files/search", cfg.APIToken, `{"path":`+mustJSON(t.TempDir())+`}`)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("outside allowed paths: %d %s", resp.StatusCode, data)
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestGitignore(t *testing.T) {
+	rules := "*.o\n/root.txt\ndoc/*.txt\n**/cache\nlogs/**\na/**/z\n[!b]at\nout/\n!important.o\n# comment\n\\#hash\n"
+	var ig gitignore
+	ig.files = []ignoreFile{{rules: parseGitignore(bufio.NewScanner(strings.NewReader(rules)))}}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"x.o", false, true},
+		{"src/x.o", false, true},
+		{"src/important.o", false, false},
+		{"root.txt", false, true},
+		{"src/root.txt", false, false},
+		{"doc/a.txt", false, true},
+		{"doc/sub/a.txt", false, false},
+		{"cache", true, true},
+		{"x/y/cache", false, true},
+		{"logs/a/b", false, true},
+		{"logs", true, false},
+		{"a/z", false, true},
+		{"a/b/c/z", false, true},
+		{"cat", false, true},
+		{"bat", false, false},
+		{"out", true, true},
+		{"out", false, false},
+		{"#hash", false, true},
+		{"comment", false, false},
+	}
+	for _, tt := range tests {
+		if got := ig.ignored(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+// Package server implements the DevProxy HTTP API: authenticated, policy
+// checked execution of allow-listed commands with an audit log.
+//
+// A Server is built from an api.Config and owns its mux, listener, run queue and
+// lifecycle, so it can be embedded in other programs and tests:
+//
+//	srv, err := server.New(cfg, server.Options{})
+//	if err != nil { ... }
+//	if err := srv.Start(); err != nil { ... }
+//	defer srv.Shutdown(context.Background())
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// abortWait bounds how long killed runs get to write their log entries.
+const abortWait = 5 * time.Second
+
+var errShuttingDown = errors.New("server is shutting down")
+
+// Options are the dependencies of a Server. Every field is optional.
+type Options struct {
+	// Executor runs approved commands. Defaults to ProcessExecutor.
+	Executor Executor
+	// Logger receives audit log entries. Defaults to a FileLogger on
+	// api.Config.LogFile.
+	Logger Logger
+	// Listener, if set, is served instead of the one api.Config.Listen and
+	// api.Config.Port describe.
+	Listener net.Listener
+	// Load returns a freshly loaded config for POST /admin/reload. Without
+	// it the endpoint reports that reloading is not available.
+	Load func() (api.Config, error)
+	// StateDir holds generated files such as the self-signed certificate.
+	// Defaults to the working directory.
+	StateDir string
+	// Version and Commit are reported by /version.
+	Version string
+	Commit  string
+}
+
+// Server is a DevProxy API server.
+type Server struct {
+	opts   Options
+	exec   Executor
+	logger Logger
+	mux    *http.ServeMux
+	http   *http.Server
+
+	cfgMu    sync.RWMutex
+	cfg      api.Config
+	reloadMu sync.Mutex
+	// filesMu makes a /files/write precondition check and the replace
+	// that follows it atomic.
+	filesMu sync.Mutex
+
+	// uploadsMu guards uploads and the state of each upload in it.
+	uploadsMu sync.Mutex
+	uploads   map[string]*upload
+
+	// watchMu guards the count of running watches and the cursors kept
+	// for polling clients.
+	watchMu      sync.Mutex
+	watches      int
+	watchCursors map[string]*watchCursor
+
+	queue   *runQueue
+	started time.Time
+
+	ln        net.Listener
+	serveErr  error
+	serveDone chan struct{}
+
+	shutdownCh   chan struct{}
+	shutdownOnce sync.Once
+	shutdownDone chan struct{}
+	// abortCtx is cancelled when the shutdown grace period expires; every
+	// run's context is derived from it.
+	abortCtx context.Context
+	abort    context.CancelFunc
+}
+
+// New validates cfg and builds a Server. It does not listen until Start.
+func New(cfg api.Config, opts Options) (*Server, error) {
+	api.ApplyDefaults(&cfg)
+	if err := api.ValidateConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		opts:         opts,
+		exec:         opts.Executor,
+		logger:       opts.Logger,
+		cfg:          cfg,
+		queue:        newRunQueue(cfg.MaxConcurrent),
+		uploads:      map[string]*upload{},
+		watchCursors: map[string]*watchCursor{},
+		serveDone:    make(chan struct{}),
+		shutdownCh:   make(chan struct{}),
+		shutdownDone: make(chan struct{}),
+	}
+	s.abortCtx, s.abort = context.WithCancel(context.Background())
+
+	if s.exec == nil {
+		s.exec = ProcessExecutor{Printf: s.printf}
+	}
+	if s.logger == nil {
+		fl, err := OpenFileLogger(cfg.LogFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open log file: %v", err)
+		}
+		s.logger = fl
+	}
+
+	s.mux = s.routes()
+	s.http = &http.Server{Handler: s.Handler()}
+
+	return s, nil
+}
+
+// Config returns a snapshot of the active configuration. Request handlers
+// take one snapshot and use it throughout so that a concurrent reload
+// cannot mix old and new settings.
+func (s *Server) Config() api.Config {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.cfg
+}
+
+// Handler returns the API handler, including the client address filter,
+// for use without Start (for example with httptest).
+func (s *Server) Handler() http.Handler {
+	return s.clientFilter(s.mux)
+}
+
+// Start opens the listener and serves in the background. It returns once
+// the server is accepting connections.
+func (s *Server) Start() error {
+	cfg := s.Config()
+
+	ln := s.opts.Listener
+	if ln == nil {
+		var err error
+		if ln, err = s.openListener(cfg); err != nil {
+			return err
+		}
+	}
+	if cfg.TLS.Enabled() {
+		tc, err := buildTLSConfig(cfg, s.opts.StateDir, s.printf)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("TLS: %v", err)
+		}
+		s.http.TLSConfig = tc
+	}
+	s.ln = ln
+	s.started = time.Now()
+
+	addr := ln.Addr().String()
+	s.printf("DevProxy starting on %s", addr)
+	s.log(context.Background(), api.LogEntry{
+		Timestamp: time.Now().Format(time.RFC3339),
+		IP:        "system",
+		Status:    "server_start",
+		Reason:    fmt.Sprintf("DevProxy started on %s", addr),
+	})
+	s.logExposure(cfg, addr)
+
+	go func() {
+		var err error
+		if cfg.TLS.Enabled() {
+			err = s.http.ServeTLS(ln, "", "")
+		} else {
+			err = s.http.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			s.serveErr = err
+		}
+		close(s.serveDone)
+	}()
+	return nil
+}
+
+// Addr returns the listening address, or nil before Start.
+func (s *Server) Addr() net.Addr {
+	if s.ln == nil {
+		return nil
+	}
+	return s.ln.Addr()
+}
+
+// Wait blocks until the server stops serving and, if Shutdown was called,
+// until shutdown has finished. It returns the serve error, if any.
+func (s *Server) Wait() error {
+	<-s.serveDone
+	if s.shuttingDown() {
+		<-s.shutdownDone
+	}
+	return s.serveErr
+}
+
+// Shutdown stops accepting connections and new runs, waits up to
+// shutdown_grace_seconds (or until ctx is done) for in-flight commands, then
+// kills what is left. Aborted runs are logged as aborted_shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	first := false
+	s.shutdownOnce.Do(func() {
+		close(s.shutdownCh)
+		first = true
+	})
+	if !first {
+		<-s.shutdownDone
+		return nil
+	}
+	defer close(s.shutdownDone)
+	defer s.discardUploads()
+
+	grace := time.Duration(s.Config().ShutdownGrace) * time.Second
+	running, _ := s.queue.stats()
+	s.printf("Shutting down: waiting up to %v for %d running command(s)", grace, running)
+	s.log(context.Background(), api.LogEntry{
+		Timestamp: time.Now().Format(time.RFC3339),
+		IP:        "system",
+		Status:    "server_stop",
+		Reason:    "DevProxy stopping",
+	})
+
+	gctx, cancel := context.WithTimeout(ctx, grace)
+	defer cancel()
+	if err := s.http.Shutdown(gctx); err == nil {
+		s.log(context.Background(), api.LogEntry{
+			Timestamp: time.Now().Format(time.RFC3339),
+			IP:        "system",
+			Status:    "shutdown_complete",
+			Reason:    "All in-flight commands finished",
+		})
+		return nil
+	}
+
+	running, _ = s.queue.stats()
+	s.abort()
+	s.printf("Grace period expired; killed %d command(s)", running)
+
+	actx, cancel := context.WithTimeout(context.Background(), abortWait)
+	defer cancel()
+	if err := s.http.Shutdown(actx); err != nil {
+		s.http.Close()
+	}
+	s.log(context.Background(), api.LogEntry{
+		Timestamp: time.Now().Format(time.RFC3339),
+		IP:        "system",
+		Status:    "shutdown_complete",
+		Reason:    fmt.Sprintf("Grace period of %v expired; aborted %d command(s)", grace, running),
+	})
+	return nil
+}
+
+// printf passes a diagnostic message to the Logger, if it takes them.
+func (s *Server) printf(format string, args ...interface{}) {
+	if p, ok := s.logger.(interface {
+		Printf(format string, args ...interface{})
+	}); ok {
+		p.Printf(format, args...)
+	}
+}
+
+// Close releases the logger if the Server opened it. Call it after Wait.
+func (s *Server) Close() error {
+	if s.opts.Logger == nil {
+		if c, ok := s.logger.(interface{ Close() error }); ok {
+			return c.Close()
+		}
+	}
+	return nil
+}
+
+func (s *Server) shuttingDown() bool {
+	select {
+	case <-s.shutdownCh:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := extractTraceContext(r.Context(), r.Header)
+		ctx, span := tracer.Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", r.RemoteAddr),
+			))
+		defer span.End()
+
+		_, authSpan := tracer.Start(ctx, "devproxy.auth")
+		cfg := s.Config()
+		if id := clientIdentity(cfg, r); id != "" {
+			// A verified client certificate listed in
+			// tls.client_identities stands in for the token.
+			authSpan.SetAttributes(attribute.String("devproxy.client_identity", id))
+			ctx = withIdentity(ctx, id)
+		} else if r.Header.Get("X-Admin-Token") != cfg.APIToken {
+			authSpan.SetStatus(codes.Error, "invalid or missing token")
+			authSpan.End()
+			span.SetStatus(codes.Error, "unauthorized")
+			s.log(ctx, api.LogEntry{
+				Timestamp: time.Now().Format(time.RFC3339),
+				IP:        r.RemoteAddr,
+				Status:    "auth_failed",
+				Reason:    "Invalid or missing token",
+			})
+			writeError(w, http.StatusUnauthorized, api.CodeUnauthorized, "Invalid or missing token", nil)
+			return
+		}
+		authSpan.End()
+
+		next(w, r.WithContext(ctx))
+	}
+}
+
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req api.RunRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, api.CodeInvalidRequest, "Invalid request body: "+err.Error(), nil)
+		return
+	}
+
+	entry := api.LogEntry{
+		Timestamp: time.Now().Format(time.RFC3339),
+		IP:        r.RemoteAddr,
+		Command:   req.Command,
+		Args:      req.Args,
+		CWD:       req.CWD,
+	}
+
+	ctx := r.Context()
+	cfg := s.Config()
+	if s.shuttingDown() {
+		entry.Status = "rejected"
+		entry.Reason = errShuttingDown.Error()
+		s.log(ctx, entry)
+		writeError(w, http.StatusServiceUnavailable, api.CodeShuttingDown, errShuttingDown.Error(), nil)
+		return
+	}
+	if err := validateRequest(ctx, cfg, &req); err != nil {
+		entry.Status = "rejected"
+		entry.Reason = err.Error()
+		s.log(ctx, entry)
+		writeError(w, http.StatusForbidden, api.CodePolicyViolation, err.Error(), nil)
+		return
+	}
+
+	release, err := s.queue.acquire(ctx, cfg.MaxQueued, s.shutdownCh)
+	if err != nil {
+		entry.Status = "rejected"
+		entry.Reason = err.Error()
+		s.log(ctx, entry)
+		code := api.CodeQueueFull
+		if err == errShuttingDown {
+			code = api.CodeShuttingDown
+		}
+		writeError(w, http.StatusServiceUnavailable, code, err.Error(), nil)
+		return
+	}
+
+	// A client disconnect does not stop the command; only the end of the
+	// shutdown grace period does.
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(s.abortCtx, cancel)
+	out := newRunOutput(w, wantsStream(r))
+	res := s.exec.Run(runCtx, req, out.writer("stdout"), out.writer("stderr"))
+	stop()
+	cancel()
+	release()
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	entry.Stdout = out.stdout.String()
+	entry.Stderr = out.stderr.String()
+	entry.ExitCode = res.ExitCode
+	entry.Status = "completed"
+	if res.Aborted {
+		entry.Status = "aborted_shutdown"
+		entry.Reason = "Killed after the shutdown grace period expired"
+	}
+	s.log(ctx, entry)
+
+	if out.enc != nil {
+		out.send(api.RunEvent{Done: true, ExitCode: res.ExitCode})
+		return
+	}
+
+	resp := api.RunResponse{
+		Stdout:   entry.Stdout,
+		Stderr:   entry.Stderr,
+		ExitCode: res.ExitCode,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// log writes entry to the audit log, filling in the trace ID and client
+// identity from ctx.
+func (s *Server) log(ctx context.Context, entry api.LogEntry) {
+	_, span := tracer.Start(ctx, "devproxy.log", trace.WithAttributes(
+		attribute.String("devproxy.status", entry.Status),
+	))
+	defer span.End()
+
+	if entry.TraceID == "" {
+		entry.TraceID = traceID(ctx)
+	}
+	if entry.Identity == "" {
+		entry.Identity = identityFrom(ctx)
+	}
+	s.logger.Log(entry)
+}
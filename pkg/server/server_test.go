@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+type stubExecutor struct{}
+
+func (stubExecutor) Run(ctx context.Context, req api.RunRequest, stdout, stderr io.Writer) RunResult {
+	io.WriteString(stdout, "ran "+req.Command+"\n")
+	return RunResult{ExitCode: 0}
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Log(api.LogEntry) {}
+
+// recordLogger keeps the entries logged to it.
+type recordLogger struct {
+	mu  sync.Mutex
+	log []api.LogEntry
+}
+
+func (l *recordLogger) Log(e api.LogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.log = append(l.log, e)
+}
+
+func (l *recordLogger) entries() []api.LogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]api.LogEntry(nil), l.log...)
+}
+
+// newTestServer starts a server whose only allowed path is a new temporary
+// directory. configure, if given, adjusts the config first.
+func newTestServer(t *testing.T, configure ...func(*api.Config)) (*httptest.Server, api.Config) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := api.DefaultConfig()
+	cfg.APIToken = "test-token-0123456789"
+	cfg.AllowedCmds = []string{"go"}
+	cfg.AllowedPaths = []string{dir}
+	for _, fn := range configure {
+		fn(&cfg)
+	}
+
+	s, err := New(cfg, Options{Executor: stubExecutor{}, Logger: discardLogger{}, StateDir: dir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return ts, s.Config()
+}
+
+func request(t *testing.T, ts *httptest.Server, method, path, token, body string) (*http.Response, []byte) {
+	t.Helper()
+	req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("X-Admin-Token", token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, data
+}
+
+// TestEndpointsAnswerAsDocumented sends an authenticated request to every
+// endpoint, with and without api.Prefix, and checks the status is one the
+// OpenAPI document lists.
+func TestEndpointsAnswerAsDocumented(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	dir := cfg.AllowedPaths[0]
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	queries := map[string]string{
+		"/files/stat":  "?path=" + url.QueryEscape(file),
+		"/files/list":  "?path=" + url.QueryEscape(dir),
+		"/files/read":  "?path=" + url.QueryEscape(file),
+		"/files/write": "?path=" + url.QueryEscape(file),
+	}
+	bodies := map[string]string{
+		"/run":            `{"command":"go","args":["version"],"cwd":` + mustJSON(dir) + `}`,
+		"/files/write":    "replaced\n",
+		"/files/mkdir":    `{"path":` + mustJSON(filepath.Join(dir, "sub")) + `}`,
+		"/files/manifest": `{"path":` + mustJSON(dir) + `}`,
+		"/files/archive":  `{"path":` + mustJSON(file) + `,"dest":` + mustJSON(filepath.Join(dir, "a.zip")) + `,"overwrite":true}`,
+		"/files/extract":  `{"path":` + mustJSON(filepath.Join(dir, "a.zip")) + `,"dest":` + mustJSON(filepath.Join(dir, "x")) + `,"overwrite":true}`,
+		"/files/patch":    `{"root":` + mustJSON(dir) + `,"diff":"--- a.txt\n+++ a.txt\n@@ -1 +1 @@\n-hello\n+patched\n","dry_run":true}`,
+		"/files/watch":    `{"path":` + mustJSON(filepath.Join(dir, "missing")) + `}`,
+		"/files/search":   `{"path":` + mustJSON(dir) + `,"pattern":"hel+o","context":1}`,
+		"/files/move":     `{"from":` + mustJSON(file) + `,"to":` + mustJSON(filepath.Join(dir, "b.txt")) + `}`,
+		"/files/delete":   `{"path":` + mustJSON(filepath.Join(dir, "b.txt")) + `}`,
+	}
+
+	for _, ep := range api.Endpoints {
+		for _, path := range []string{api.Prefix + ep.Path, ep.Path} {
+			resp, data := request(t, ts, ep.Method, path+queries[ep.Path], cfg.APIToken, bodies[ep.Path])
+			if _, ok := ep.Responses[resp.StatusCode]; !ok {
+				t.Errorf("%s %s: undocumented status %d: %s", ep.Method, path, resp.StatusCode, data)
+			}
+			if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") && ep.Responses[resp.StatusCode] != (api.Binary{}) {
+				t.Errorf("%s %s: Content-Type %q", ep.Method, path, ct)
+			}
+		}
+	}
+}
+
+func TestErrorsAreJSON(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	tests := []struct {
+		method, path, token, body string
+		status                    int
+		code                      string
+	}{
+		{"POST", "/v1/run", "", `{}`, http.StatusUnauthorized, api.CodeUnauthorized},
+		{"POST", "/v1/run", cfg.APIToken, `not json`, http.StatusBadRequest, api.CodeInvalidRequest},
+		{"GET", "/v1/run", cfg.APIToken, ``, http.StatusMethodNotAllowed, api.CodeMethodNotAllowed},
+		{"POST", "/v1/run", cfg.APIToken, `{"command":"rm","cwd":"/"}`, http.StatusForbidden, api.CodePolicyViolation},
+		{"GET", "/v1/admin/reload", cfg.APIToken, ``, http.StatusMethodNotAllowed, api.CodeMethodNotAllowed},
+		{"POST", "/v1/admin/reload", cfg.APIToken, ``, http.StatusNotImplemented, api.CodeReloadUnavailable},
+		{"GET", "/v2/run", "", ``, http.StatusNotFound, api.CodeNotFound},
+	}
+
+	for _, tt := range tests {
+		resp, data := request(t, ts, tt.method, tt.path, tt.token, tt.body)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, resp.StatusCode, tt.status)
+		}
+		var er api.ErrorResponse
+		if err := json.Unmarshal(data, &er); err != nil {
+			t.Errorf("%s %s: body is not an ErrorResponse: %q", tt.method, tt.path, data)
+			continue
+		}
+		if er.Code != tt.code || er.Message == "" {
+			t.Errorf("%s %s: got %+v, want code %q", tt.method, tt.path, er, tt.code)
+		}
+	}
+}
+
+func TestOpenAPIIsServed(t *testing.T) {
+	ts, _ := newTestServer(t)
+	resp, data := request(t, ts, "GET", "/openapi.json", "", "")
+	if resp.StatusCode != http.StatusOK || string(data) != string(api.OpenAPI()) {
+		t.Fatalf("GET /openapi.json: %d, %d bytes", resp.StatusCode, len(data))
+	}
+}
+
+func mustJSON(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// printfLogger is a recordLogger that also keeps diagnostic messages.
+type printfLogger struct {
+	recordLogger
+	msgs []string
+}
+
+func (l *printfLogger) Printf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, fmt.Sprintf(format, args...))
+}
+
+func (l *printfLogger) messages() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.msgs...)
+}
+
+func TestLifecycle(t *testing.T) {
+	dir := t.TempDir()
+	cfg := api.DefaultConfig()
+	cfg.APIToken = "test-token-0123456789"
+	cfg.AllowedCmds = []string{"go"}
+	cfg.AllowedPaths = []string{dir}
+	cfg.TLS.SelfSigned = true
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := &printfLogger{}
+	s, err := New(cfg, Options{Executor: stubExecutor{}, Logger: logs, Listener: ln, StateDir: dir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if s.Addr() != nil {
+		t.Errorf("Addr before Start = %v, want nil", s.Addr())
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if s.Addr().String() != ln.Addr().String() {
+		t.Errorf("Addr = %v, want %v", s.Addr(), ln.Addr())
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	req, _ := http.NewRequest("POST", "https://"+ln.Addr().String()+"/v1/run",
+		strings.NewReader(`{"command":"go","args":["version"],"cwd":`+mustJSON(dir)+`}`))
+	req.Header.Set("X-Admin-Token", cfg.APIToken)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "ran go") {
+		t.Fatalf("run: %d %s", resp.StatusCode, body)
+	}
+
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := s.Wait(); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := client.Do(req); err == nil {
+		t.Error("request after Shutdown succeeded")
+	}
+
+	var got []string
+	for _, e := range logs.entries() {
+		if e.IP == "system" {
+			got = append(got, e.Status)
+		}
+	}
+	if want := []string{"server_start", "server_stop", "shutdown_complete"}; !slices.Equal(got, want) {
+		t.Errorf("system entries = %v, want %v", got, want)
+	}
+	msgs := strings.Join(logs.messages(), "\n")
+	for _, want := range []string{"Generated self-signed certificate", "pin with devctl -pin", "DevProxy starting on " + ln.Addr().String(), "Shutting down"} {
+		if !strings.Contains(msgs, want) {
+			t.Errorf("diagnostics missing %q:\n%s", want, msgs)
+		}
+	}
+}
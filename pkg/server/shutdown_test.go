@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// blockingExecutor runs until finish is closed or the run is aborted.
+type blockingExecutor struct {
+	started chan struct{}
+	finish  chan struct{}
+}
+
+func (e blockingExecutor) Run(ctx context.Context, req api.RunRequest, stdout, stderr io.Writer) RunResult {
+	e.started <- struct{}{}
+	select {
+	case <-e.finish:
+		return RunResult{ExitCode: 0}
+	case <-ctx.Done():
+		return RunResult{ExitCode: -1, Aborted: true}
+	}
+}
+
+// startShutdownServer serves on a loopback port with a one-second grace
+// period and starts one run, returning once the executor has it.
+func startShutdownServer(t *testing.T, exec blockingExecutor, logs *recordLogger) (*Server, <-chan int) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := api.DefaultConfig()
+	cfg.APIToken = "test-token-0123456789"
+	cfg.AllowedCmds = []string{"go"}
+	cfg.AllowedPaths = []string{dir}
+	cfg.ShutdownGrace = 1
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(cfg, Options{Executor: exec, Logger: logs, Listener: ln, StateDir: dir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	status := make(chan int, 1)
+	go func() {
+		req, _ := http.NewRequest("POST", "http://"+ln.Addr().String()+"/v1/run",
+			strings.NewReader(`{"command":"go","args":["test"],"cwd":`+mustJSON(dir)+`}`))
+		req.Header.Set("X-Admin-Token", cfg.APIToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	select {
+	case <-exec.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not start")
+	}
+	return s, status
+}
+
+// statuses returns the Status and Reason of each logged entry.
+func statuses(logs *recordLogger) map[string]string {
+	m := map[string]string{}
+	for _, e := range logs.entries() {
+		m[e.Status] = e.Reason
+	}
+	return m
+}
+
+func TestShutdownDrainsRuns(t *testing.T) {
+	exec := blockingExecutor{started: make(chan struct{}, 1), finish: make(chan struct{})}
+	logs := &recordLogger{}
+	s, status := startShutdownServer(t, exec, logs)
+
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(context.Background()) }()
+	time.Sleep(100 * time.Millisecond)
+	close(exec.finish)
+
+	if got := <-status; got != http.StatusOK {
+		t.Errorf("run status %d, want 200", got)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if err := s.Wait(); err != nil {
+		t.Errorf("Wait: %v", err)
+	}
+	got := statuses(logs)
+	if _, ok := got["completed"]; !ok {
+		t.Errorf("run not logged as completed: %v", got)
+	}
+	if _, ok := got["aborted_shutdown"]; ok {
+		t.Errorf("run aborted although it finished in time: %v", got)
+	}
+	if reason := got["shutdown_complete"]; !strings.Contains(reason, "All in-flight") {
+		t.Errorf("shutdown_complete reason %q", reason)
+	}
+}
+
+func TestShutdownKillsAfterGrace(t *testing.T) {
+	exec := blockingExecutor{started: make(chan struct{}, 1), finish: make(chan struct{})}
+	logs := &recordLogger{}
+	s, status := startShutdownServer(t, exec, logs)
+
+	start := time.Now()
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 10*time.Second {
+		t.Errorf("Shutdown took %v, want about the 1s grace period", elapsed)
+	}
+	<-status
+	got := statuses(logs)
+	if reason, ok := got["aborted_shutdown"]; !ok || !strings.Contains(reason, "grace period") {
+		t.Errorf("run not logged as aborted_shutdown: %v", got)
+	}
+	if reason := got["shutdown_complete"]; !strings.Contains(reason, "aborted 1 command") {
+		t.Errorf("shutdown_complete reason %q", reason)
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// wantsStream reports whether the client asked for a streamed response.
+func wantsStream(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mt == api.StreamContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// runOutput collects a run's stdout and stderr for the audit log and, when
+// streaming, forwards every write to the client as an api.RunEvent. It is safe
+// for concurrent use by both output streams.
+type runOutput struct {
+	mu     sync.Mutex
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+
+	enc     *json.Encoder
+	flusher http.Flusher
+}
+
+func newRunOutput(w http.ResponseWriter, stream bool) *runOutput {
+	o := &runOutput{}
+	if stream {
+		w.Header().Set("Content-Type", api.StreamContentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+		o.enc = json.NewEncoder(w)
+		o.flusher, _ = w.(http.Flusher)
+		o.flush()
+	}
+	return o
+}
+
+func (o *runOutput) flush() {
+	if o.flusher != nil {
+		o.flusher.Flush()
+	}
+}
+
+// send writes ev to a streaming client. Write errors are ignored: a client
+// that goes away does not stop the command.
+func (o *runOutput) send(ev api.RunEvent) {
+	if o.enc == nil {
+		return
+	}
+	o.enc.Encode(ev)
+	o.flush()
+}
+
+func (o *runOutput) writer(stream string) *streamWriter {
+	return &streamWriter{out: o, stream: stream}
+}
+
+type streamWriter struct {
+	out    *runOutput
+	stream string
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	o := sw.out
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if sw.stream == "stderr" {
+		o.stderr.Write(p)
+	} else {
+		o.stdout.Write(p)
+	}
+	o.send(api.RunEvent{Stream: sw.stream, Data: string(p)})
+	return len(p), nil
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+const selfSignedValidity = 2 * 365 * 24 * time.Hour
+
+// tlsFiles returns the certificate and key paths, defaulting generated
+// files to stateDir.
+func tlsFiles(t api.TLSConfig, stateDir string) (string, string) {
+	dir := stateDir
+	cert, key := t.CertFile, t.KeyFile
+	if cert == "" {
+		cert = filepath.Join(dir, "devproxy-cert.pem")
+	}
+	if key == "" {
+		key = filepath.Join(dir, "devproxy-key.pem")
+	}
+	return cert, key
+}
+
+// buildTLSConfig loads (or generates) the server certificate and the
+// client CA pool, reporting the certificate's fingerprint through printf.
+func buildTLSConfig(cfg api.Config, stateDir string, printf func(string, ...interface{})) (*tls.Config, error) {
+	certFile, keyFile := tlsFiles(cfg.TLS, stateDir)
+
+	if cfg.TLS.SelfSigned {
+		if _, err := os.Stat(certFile); os.IsNotExist(err) {
+			if err := generateSelfSigned(cfg, certFile, keyFile); err != nil {
+				return nil, fmt.Errorf("generating self-signed certificate: %v", err)
+			}
+			printf("Generated self-signed certificate %s", certFile)
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	fp := certFingerprint(cert.Certificate[0])
+	if cfg.TLS.SelfSigned {
+		printf("TLS certificate SHA-256 fingerprint (pin with devctl -pin): %s", fp)
+	} else {
+		printf("TLS certificate SHA-256 fingerprint: %s", fp)
+	}
+
+	tc := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.TLS.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.TLS.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("%s contains no PEM certificates", cfg.TLS.ClientCAFile)
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.TLS.RequireClientCert {
+			tc.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tc, nil
+}
+
+// generateSelfSigned writes an ECDSA P-256 certificate valid for loopback,
+// the bind address, the host name and tls.hosts.
+func generateSelfSigned(cfg api.Config, certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "devproxy"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if name, err := os.Hostname(); err == nil {
+		hosts = append(hosts, name)
+	}
+	if host, err := api.ResolveBindHost(cfg.Bind); err == nil {
+		if ip := net.ParseIP(host); ip == nil || !ip.IsUnspecified() {
+			hosts = append(hosts, host)
+		}
+	}
+	hosts = append(hosts, cfg.TLS.Hosts...)
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else if h != "" {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// certFingerprint formats the SHA-256 of a DER certificate as colon
+// separated hex, the form devctl -pin accepts.
+func certFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+type identityKey struct{}
+
+// clientIdentity returns the common name of a verified client certificate
+// listed in tls.client_identities, or "".
+func clientIdentity(cfg api.Config, r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return ""
+	}
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	for _, id := range cfg.TLS.ClientIdentities {
+		if cn == id {
+			return cn
+		}
+	}
+	return ""
+}
+
+func withIdentity(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+func identityFrom(ctx context.Context) string {
+	id, _ := ctx.Value(identityKey{}).(string)
+	return id
+}
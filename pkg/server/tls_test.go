@@ -0,0 +1,235 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// testCA is a certificate authority for client certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// writePEM writes the CA certificate to a file and returns its path.
+func (ca *testCA) writePEM(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// issue returns a client certificate for cn signed by the CA.
+func (ca *testCA) issue(t *testing.T, cn string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	cfg := api.DefaultConfig()
+	cfg.TLS = api.TLSConfig{SelfSigned: true, Hosts: []string{"devbox", "10.0.0.9"}}
+	var msgs []string
+	printf := func(format string, args ...interface{}) { msgs = append(msgs, fmt.Sprintf(format, args...)) }
+
+	tc, err := buildTLSConfig(cfg, dir, printf)
+	if err != nil {
+		t.Fatalf("buildTLSConfig: %v", err)
+	}
+	certFile, keyFile := tlsFiles(cfg.TLS, dir)
+	if runtime.GOOS != "windows" {
+		if fi, err := os.Stat(keyFile); err != nil || fi.Mode().Perm() != 0o600 {
+			t.Errorf("key file: %v, mode %v; want 0600", err, fi.Mode().Perm())
+		}
+	}
+	leaf, err := x509.ParseCertificate(tc.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"localhost", "devbox"} {
+		if !slices.Contains(leaf.DNSNames, name) {
+			t.Errorf("certificate DNS names %v lack %s", leaf.DNSNames, name)
+		}
+	}
+	for _, ip := range []string{"127.0.0.1", "10.0.0.9"} {
+		if !slices.ContainsFunc(leaf.IPAddresses, func(a net.IP) bool { return a.Equal(net.ParseIP(ip)) }) {
+			t.Errorf("certificate IP addresses %v lack %s", leaf.IPAddresses, ip)
+		}
+	}
+	fp := certFingerprint(leaf.Raw)
+	if len(msgs) != 2 || !strings.Contains(msgs[0], certFile) || !strings.HasSuffix(msgs[1], fp) {
+		t.Errorf("messages = %q, want the generated file and fingerprint %s", msgs, fp)
+	}
+	if len(fp) != 32*3-1 || strings.Count(fp, ":") != 31 {
+		t.Errorf("fingerprint %q is not 32 colon-separated bytes", fp)
+	}
+
+	// A second start reuses the certificate.
+	msgs = nil
+	tc, err = buildTLSConfig(cfg, dir, printf)
+	if err != nil {
+		t.Fatalf("buildTLSConfig again: %v", err)
+	}
+	if got := certFingerprint(tc.Certificates[0].Certificate[0]); got != fp {
+		t.Errorf("certificate regenerated: fingerprint %s, was %s", got, fp)
+	}
+	if len(msgs) != 1 || strings.Contains(msgs[0], "Generated") {
+		t.Errorf("messages on reuse = %q", msgs)
+	}
+}
+
+// startTLSServer serves cfg over TLS on a loopback port.
+func startTLSServer(t *testing.T, cfg api.Config, logs Logger) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(cfg, Options{Executor: stubExecutor{}, Logger: logs, Listener: ln, StateDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { s.http.Close() })
+	return "https://" + ln.Addr().String()
+}
+
+func TestClientCertificates(t *testing.T) {
+	ca, other := newTestCA(t), newTestCA(t)
+	dir := t.TempDir()
+	cfg := api.DefaultConfig()
+	cfg.APIToken = "test-token-0123456789"
+	cfg.AllowedCmds = []string{"go"}
+	cfg.AllowedPaths = []string{dir}
+	cfg.TLS = api.TLSConfig{SelfSigned: true, ClientCAFile: ca.writePEM(t), ClientIdentities: []string{"alice"}}
+	logs := &recordLogger{}
+	url := startTLSServer(t, cfg, logs)
+
+	get := func(cert *tls.Certificate, token string) (int, error) {
+		tc := &tls.Config{InsecureSkipVerify: true}
+		if cert != nil {
+			tc.Certificates = []tls.Certificate{*cert}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tc}}
+		req, _ := http.NewRequest("POST", url+"/v1/run",
+			strings.NewReader(`{"command":"go","args":["version"],"cwd":`+mustJSON(dir)+`}`))
+		if token != "" {
+			req.Header.Set("X-Admin-Token", token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	alice, bob, mallory := ca.issue(t, "alice"), ca.issue(t, "bob"), other.issue(t, "alice")
+	tests := []struct {
+		name   string
+		cert   *tls.Certificate
+		token  string
+		status int // 0: the handshake fails
+	}{
+		{"listed identity without token", &alice, "", http.StatusOK},
+		{"unlisted identity without token", &bob, "", http.StatusUnauthorized},
+		{"unlisted identity with token", &bob, cfg.APIToken, http.StatusOK},
+		{"no certificate with token", nil, cfg.APIToken, http.StatusOK},
+		{"no certificate without token", nil, "", http.StatusUnauthorized},
+		{"certificate from another CA", &mallory, "", 0},
+	}
+	for _, tt := range tests {
+		status, err := get(tt.cert, tt.token)
+		if tt.status == 0 {
+			if err == nil {
+				t.Errorf("%s: handshake succeeded with status %d", tt.name, status)
+			}
+			continue
+		}
+		if err != nil || status != tt.status {
+			t.Errorf("%s: %d, %v; want %d", tt.name, status, err, tt.status)
+		}
+	}
+
+	// The identity stands in for the token in the audit log.
+	var identities []string
+	for _, e := range logs.entries() {
+		if e.Command == "go" {
+			identities = append(identities, e.Identity)
+		}
+	}
+	if want := []string{"alice", "", ""}; !slices.Equal(identities, want) {
+		t.Errorf("identities of the runs = %q, want %q", identities, want)
+	}
+
+	// With require_client_cert a token alone is not enough.
+	cfg.TLS.RequireClientCert = true
+	url = startTLSServer(t, cfg, discardLogger{})
+	if _, err := get(nil, cfg.APIToken); err == nil {
+		t.Error("require_client_cert: request without a certificate succeeded")
+	}
+	if status, err := get(&alice, ""); err != nil || status != http.StatusOK {
+		t.Errorf("require_client_cert: listed identity got %d, %v", status, err)
+	}
+}
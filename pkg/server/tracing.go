@@ -0,0 +1,31 @@
+package server
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/mscrnt/DevProxy/pkg/server"
+
+var tracer = otel.Tracer(tracerName)
+
+// extractTraceContext returns ctx joined to any trace context carried in
+// the request headers (traceparent/tracestate). The W3C headers are always
+// read, whether or not the program has set a global propagator; one it has
+// set, for baggage say, is applied too.
+func extractTraceContext(ctx context.Context, header map[string][]string) context.Context {
+	p := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, otel.GetTextMapPropagator())
+	return p.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// traceID returns the hex trace ID of the span in ctx, or "" if none.
+func traceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
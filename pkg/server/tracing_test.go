@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// TestTracing runs a command with an incoming traceparent and checks that
+// the request's spans are exported, joined to the caller's trace, and that
+// the audit log entry carries the trace ID. No global propagator is set, as
+// in a program that only installs a tracer provider.
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+
+	dir := t.TempDir()
+	cfg := api.DefaultConfig()
+	cfg.APIToken = "test-token-0123456789"
+	cfg.AllowedCmds = []string{"go"}
+	cfg.AllowedPaths = []string{dir}
+	logs := &recordLogger{}
+	s, err := New(cfg, Options{Executor: stubExecutor{}, Logger: logs, StateDir: dir})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	const traceID, parentID = "0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331"
+	req, _ := http.NewRequest("POST", ts.URL+"/v1/run",
+		strings.NewReader(`{"command":"go","args":["version"],"cwd":`+mustJSON(cfg.AllowedPaths[0])+`}`))
+	req.Header.Set("X-Admin-Token", cfg.APIToken)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("run: %d", resp.StatusCode)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, s := range exporter.GetSpans() {
+		if got := s.SpanContext.TraceID().String(); got != traceID {
+			t.Errorf("span %s has trace %s, want %s", s.Name, got, traceID)
+		}
+		spans[s.Name] = s
+	}
+	for _, name := range []string{"POST /v1/run", "devproxy.auth", "devproxy.validate", "devproxy.queue", "devproxy.log"} {
+		if _, ok := spans[name]; !ok {
+			t.Errorf("no %s span among %d exported", name, len(spans))
+		}
+	}
+	if root := spans["POST /v1/run"]; root.Parent.SpanID().String() != parentID || !root.Parent.IsRemote() {
+		t.Errorf("server span parent = %v, want remote %s", root.Parent.SpanID(), parentID)
+	}
+
+	entries := logs.entries()
+	if len(entries) == 0 || entries[len(entries)-1].TraceID != traceID {
+		t.Errorf("log entries %+v, want trace_id %s", entries, traceID)
+	}
+}
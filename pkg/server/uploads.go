@@ -0,0 +1,439 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+// upload is an upload session. Its data goes to part, a hidden file next to
+// the destination, which is renamed into place on commit. Uploads live in
+// memory only: a restart discards them with their part files.
+type upload struct {
+	// busy serializes the chunks, commit and abort of one upload.
+	busy sync.Mutex
+
+	// Set when the upload starts and never changed.
+	id, path, sha256 string
+	size             int64
+	owner            string
+	part             string
+	expected         string
+	modTime          time.Time
+
+	// Guarded by Server.uploadsMu.
+	received int64
+	expires  time.Time
+	done     bool
+}
+
+func (u *upload) state() api.Upload {
+	return api.Upload{
+		ID:        u.id,
+		Path:      u.path,
+		Size:      u.size,
+		Received:  u.received,
+		SHA256:    u.sha256,
+		ExpiresAt: u.expires.UTC().Format(time.RFC3339),
+	}
+}
+
+// uploadOwner identifies the client an upload and its quota belong to: the
+// certificate identity, or else the shared token.
+func uploadOwner(ctx context.Context) string {
+	if id := identityFrom(ctx); id != "" {
+		return id
+	}
+	return "token"
+}
+
+func newUploadID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func isSHA256(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == 32
+}
+
+func uploadTTL(cfg api.Config) time.Duration {
+	return time.Duration(cfg.Files.UploadTTLMinutes) * time.Minute
+}
+
+func (s *Server) handleUploads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var req api.UploadRequest
+	err := decodeFileRequest(r, &req)
+	entry := fileEntry(r, req.Path)
+	entry.Bytes = req.Size
+	cfg := s.Config()
+	if err == nil {
+		if err = checkFilePath(cfg, req.Path); err != nil {
+			err = policyError(err)
+		}
+	}
+	var state api.Upload
+	resumed := false
+	if err == nil {
+		state, resumed, err = s.startUpload(r.Context(), cfg, req)
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "upload", err)
+		return
+	}
+
+	status := "upload_started"
+	if resumed {
+		status = "upload_resumed"
+	}
+	entry.Reason = "upload " + state.ID
+	s.fileDone(w, r, entry, status, state)
+}
+
+// startUpload creates an upload session, or returns the caller's
+// unfinished one for the same file, size and hash.
+func (s *Server) startUpload(ctx context.Context, cfg api.Config, req api.UploadRequest) (api.Upload, bool, error) {
+	switch {
+	case req.Size < 0:
+		return api.Upload{}, false, fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "size must not be negative")
+	case req.Size > maxFileSize(cfg):
+		return api.Upload{}, false, fileErrorf(http.StatusRequestEntityTooLarge, api.CodeTooLarge, "file is larger than %d bytes", maxFileSize(cfg))
+	case req.SHA256 != "" && !isSHA256(req.SHA256):
+		return api.Upload{}, false, fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "sha256 must be 64 hex digits")
+	}
+	modTime, err := parseModTime(req.ModTime)
+	if err != nil {
+		return api.Upload{}, false, err
+	}
+	path := filepath.Clean(req.Path)
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() {
+		return api.Upload{}, false, fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "'%s' is a directory", path)
+	}
+
+	now := time.Now()
+	owner := uploadOwner(ctx)
+	sum := strings.ToLower(req.SHA256)
+	s.sweepUploads(now)
+
+	s.uploadsMu.Lock()
+	defer s.uploadsMu.Unlock()
+
+	var used int64
+	for _, u := range s.uploads {
+		if u.owner != owner {
+			continue
+		}
+		if sum != "" && u.path == path && u.size == req.Size && u.sha256 == sum {
+			u.expires = now.Add(uploadTTL(cfg))
+			return u.state(), true, nil
+		}
+		used += u.size
+	}
+	if quota := int64(cfg.Files.UploadQuotaMB) << 20; used+req.Size > quota {
+		return api.Upload{}, false, fileErrorf(http.StatusRequestEntityTooLarge, api.CodeQuotaExceeded,
+			"unfinished uploads would total %d bytes, over the quota of %d", used+req.Size, quota)
+	}
+	// The precondition is checked again on commit; failing early saves
+	// sending data that cannot be used.
+	_, statErr := os.Stat(path)
+	if err := checkExpectedHash(path, req.ExpectedSHA256, statErr == nil); err != nil {
+		return api.Upload{}, false, err
+	}
+
+	dir := filepath.Dir(path)
+	if req.Parents {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return api.Upload{}, false, err
+		}
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".devproxy-upload-*")
+	if err != nil {
+		return api.Upload{}, false, err
+	}
+	f.Close()
+
+	u := &upload{
+		id:       newUploadID(),
+		path:     path,
+		sha256:   sum,
+		size:     req.Size,
+		owner:    owner,
+		part:     f.Name(),
+		expected: req.ExpectedSHA256,
+		modTime:  modTime,
+		expires:  now.Add(uploadTTL(cfg)),
+	}
+	s.uploads[u.id] = u
+	return u.state(), false, nil
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		u, err := s.lookupUpload(r)
+		if err != nil {
+			s.fileFail(w, r, fileEntry(r, ""), "upload status", err)
+			return
+		}
+		s.uploadsMu.Lock()
+		state := u.state()
+		s.uploadsMu.Unlock()
+		writeJSON(w, http.StatusOK, state)
+	case http.MethodPut:
+		s.handleUploadChunk(w, r)
+	case http.MethodDelete:
+		s.handleUploadAbort(w, r)
+	default:
+		writeMethodNotAllowed(w, "GET, PUT, DELETE")
+	}
+}
+
+// lookupUpload returns the caller's upload named in the request path.
+// Another client's upload is reported as not found.
+func (s *Server) lookupUpload(r *http.Request) (*upload, error) {
+	s.sweepUploads(time.Now())
+	id := r.PathValue("id")
+
+	s.uploadsMu.Lock()
+	defer s.uploadsMu.Unlock()
+	u, ok := s.uploads[id]
+	if !ok || u.done || u.owner != uploadOwner(r.Context()) {
+		return nil, fileErrorf(http.StatusNotFound, api.CodeUploadNotFound, "no upload %q; it may have expired", id)
+	}
+	return u, nil
+}
+
+// beginUpload looks up the upload, takes its busy lock and checks that it
+// is still open and its destination still allowed. On success the caller
+// must unlock u.busy.
+func (s *Server) beginUpload(r *http.Request) (*upload, error) {
+	u, err := s.lookupUpload(r)
+	if err != nil {
+		return nil, err
+	}
+	u.busy.Lock()
+	s.uploadsMu.Lock()
+	done := u.done
+	s.uploadsMu.Unlock()
+	if done {
+		u.busy.Unlock()
+		return nil, fileErrorf(http.StatusNotFound, api.CodeUploadNotFound, "upload %q is finished", u.id)
+	}
+	if err := checkFilePath(s.Config(), u.path); err != nil {
+		u.busy.Unlock()
+		return nil, policyError(err)
+	}
+	return u, nil
+}
+
+// handleUploadChunk writes the request body at the given offset. Chunks are
+// not logged individually; the start and the outcome of the upload are.
+func (s *Server) handleUploadChunk(w http.ResponseWriter, r *http.Request) {
+	entry := fileEntry(r, "")
+	u, err := s.beginUpload(r)
+	if err != nil {
+		s.fileFail(w, r, entry, "upload", err)
+		return
+	}
+	defer u.busy.Unlock()
+	entry.Path = u.path
+
+	s.uploadsMu.Lock()
+	received := u.received
+	s.uploadsMu.Unlock()
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	switch {
+	case err != nil:
+		err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "offset must be an integer")
+	case offset != received:
+		s.uploadsMu.Lock()
+		state := u.state()
+		s.uploadsMu.Unlock()
+		err = &fileError{
+			status:  http.StatusConflict,
+			code:    api.CodeOffsetMismatch,
+			msg:     fmt.Sprintf("upload %s has received %d bytes; the next chunk must start there, not at %d", u.id, received, offset),
+			details: state,
+		}
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "upload", err)
+		return
+	}
+
+	n, err := appendChunk(u.part, offset, u.size, r.Body)
+
+	cfg := s.Config()
+	s.uploadsMu.Lock()
+	u.received = offset + n
+	u.expires = time.Now().Add(uploadTTL(cfg))
+	state := u.state()
+	s.uploadsMu.Unlock()
+	if err != nil {
+		s.fileFail(w, r, entry, "upload", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+// appendChunk writes body to part at offset and returns how much was
+// kept. A chunk reaching past size is dropped entirely. If body fails
+// midway, what arrived before the failure is kept so the client can resume
+// from there.
+func appendChunk(part string, offset, size int64, body io.Reader) (int64, error) {
+	f, err := os.OpenFile(part, os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.Copy(f, io.LimitReader(body, size-offset))
+	if err != nil {
+		return n, err
+	}
+	if extra, _ := body.Read(make([]byte, 1)); extra > 0 {
+		if err := f.Truncate(offset); err != nil {
+			return n, err
+		}
+		return 0, fileErrorf(http.StatusRequestEntityTooLarge, api.CodeTooLarge, "chunk reaches past the upload's size of %d bytes", size)
+	}
+	return n, nil
+}
+
+func (s *Server) handleUploadCommit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	entry := fileEntry(r, "")
+	u, err := s.beginUpload(r)
+	if err != nil {
+		s.fileFail(w, r, entry, "upload commit", err)
+		return
+	}
+	defer u.busy.Unlock()
+	entry.Path = u.path
+	entry.Reason = "upload " + u.id
+
+	s.uploadsMu.Lock()
+	received := u.received
+	s.uploadsMu.Unlock()
+	if received != u.size {
+		s.fileFail(w, r, entry, "upload commit", fileErrorf(http.StatusConflict, api.CodeUploadIncomplete,
+			"upload %s has received %d of %d bytes", u.id, received, u.size))
+		return
+	}
+
+	// From here on the upload is finished whatever happens: data that
+	// does not match its hash, or a destination that changed, will not get
+	// better by retrying the commit.
+	sum, err := hashFile(u.part)
+	if err == nil && u.sha256 != "" && sum != u.sha256 {
+		err = fileErrorf(http.StatusUnprocessableEntity, api.CodeChecksumMismatch,
+			"uploaded data has SHA-256 %s, not the announced %s", sum, u.sha256)
+	}
+	if err == nil {
+		err = s.replaceFile(u.part, u.path, u.expected, u.modTime)
+	}
+	s.finishUpload(u)
+	var info api.FileInfo
+	if err == nil {
+		info, err = statFile(u.path)
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "upload commit", err)
+		return
+	}
+
+	info.SHA256 = sum
+	entry.Bytes = u.size
+	s.fileDone(w, r, entry, "upload_committed", info)
+}
+
+func (s *Server) handleUploadAbort(w http.ResponseWriter, r *http.Request) {
+	entry := fileEntry(r, "")
+	u, err := s.beginUpload(r)
+	if err != nil {
+		s.fileFail(w, r, entry, "upload abort", err)
+		return
+	}
+	defer u.busy.Unlock()
+	entry.Path = u.path
+	entry.Reason = "upload " + u.id
+
+	s.uploadsMu.Lock()
+	state := u.state()
+	s.uploadsMu.Unlock()
+	s.finishUpload(u)
+	entry.Bytes = state.Received
+	s.fileDone(w, r, entry, "upload_aborted", state)
+}
+
+// finishUpload removes u and its part file, if still there. The caller
+// holds u.busy.
+func (s *Server) finishUpload(u *upload) {
+	os.Remove(u.part)
+	s.uploadsMu.Lock()
+	u.done = true
+	delete(s.uploads, u.id)
+	s.uploadsMu.Unlock()
+}
+
+// sweepUploads discards uploads that have been idle past their expiry.
+// An upload busy with a chunk is left alone; it is not idle.
+func (s *Server) sweepUploads(now time.Time) {
+	s.uploadsMu.Lock()
+	var expired []*upload
+	for _, u := range s.uploads {
+		if now.After(u.expires) {
+			expired = append(expired, u)
+		}
+	}
+	s.uploadsMu.Unlock()
+
+	for _, u := range expired {
+		if !u.busy.TryLock() {
+			continue
+		}
+		s.finishUpload(u)
+		s.log(context.Background(), api.LogEntry{
+			Timestamp: now.Format(time.RFC3339),
+			IP:        "system",
+			Status:    "upload_expired",
+			Path:      u.path,
+			Reason:    "upload " + u.id,
+			Bytes:     u.received,
+		})
+		u.busy.Unlock()
+	}
+}
+
+// discardUploads removes every open upload's part file on shutdown.
+func (s *Server) discardUploads() {
+	s.uploadsMu.Lock()
+	defer s.uploadsMu.Unlock()
+	for id, u := range s.uploads {
+		os.Remove(u.part)
+		u.done = true
+		delete(s.uploads, id)
+	}
+}
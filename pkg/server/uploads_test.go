@@ -0,0 +1,141 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestUploadLifecycle(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	dir := cfg.AllowedPaths[0]
+	path := filepath.Join(dir, "out", "app.bin")
+	data := "0123456789abcdef"
+
+	start := `{"path":` + mustJSON(path) + `,"size":16,"sha256":"` + sha256Hex(data) + `","parents":true}`
+	resp, body := request(t, ts, "POST", "/v1/files/uploads", cfg.APIToken, start)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("start: %d %s", resp.StatusCode, body)
+	}
+	var up api.Upload
+	json.Unmarshal(body, &up)
+	chunk := func(offset int, data string) (*http.Response, []byte) {
+		return request(t, ts, "PUT", "/v1/files/uploads/"+up.ID+"?offset="+strconv.Itoa(offset), cfg.APIToken, data)
+	}
+
+	if resp, body = chunk(0, data[:10]); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first chunk: %d %s", resp.StatusCode, body)
+	}
+
+	// A resent chunk is refused, with the upload's state to resume from.
+	resp, body = chunk(0, data[:10])
+	var er struct {
+		Code    string     `json:"code"`
+		Details api.Upload `json:"details"`
+	}
+	json.Unmarshal(body, &er)
+	if resp.StatusCode != http.StatusConflict || er.Code != api.CodeOffsetMismatch || er.Details.Received != 10 {
+		t.Fatalf("repeated chunk: %d %s", resp.StatusCode, body)
+	}
+
+	// Starting the same upload again resumes it.
+	resp, body = request(t, ts, "POST", "/v1/files/uploads", cfg.APIToken, start)
+	var again api.Upload
+	json.Unmarshal(body, &again)
+	if again.ID != up.ID || again.Received != 10 {
+		t.Fatalf("restart did not resume: %s", body)
+	}
+
+	resp, body = request(t, ts, "POST", "/v1/files/uploads/"+up.ID+"/commit", cfg.APIToken, "")
+	if resp.StatusCode != http.StatusConflict || errorCode(t, body) != api.CodeUploadIncomplete {
+		t.Fatalf("early commit: %d %s", resp.StatusCode, body)
+	}
+	if resp, body = chunk(10, data[10:]+"x"); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("chunk past the size: %d %s", resp.StatusCode, body)
+	}
+	if resp, body = chunk(10, data[10:]); resp.StatusCode != http.StatusOK {
+		t.Fatalf("last chunk: %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = request(t, ts, "POST", "/v1/files/uploads/"+up.ID+"/commit", cfg.APIToken, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("commit: %d %s", resp.StatusCode, body)
+	}
+	var info api.FileInfo
+	json.Unmarshal(body, &info)
+	if got, _ := os.ReadFile(path); string(got) != data || info.SHA256 != sha256Hex(data) {
+		t.Errorf("committed %q (sha256 %s)", got, info.SHA256)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("part files left behind: %v", entries)
+	}
+
+	resp, body = request(t, ts, "GET", "/v1/files/uploads/"+up.ID, cfg.APIToken, "")
+	if resp.StatusCode != http.StatusNotFound || errorCode(t, body) != api.CodeUploadNotFound {
+		t.Errorf("status after commit: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestUploadChecksumMismatch(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	path := filepath.Join(cfg.AllowedPaths[0], "f")
+
+	start := `{"path":` + mustJSON(path) + `,"size":3,"sha256":"` + sha256Hex("abc") + `"}`
+	_, body := request(t, ts, "POST", "/v1/files/uploads", cfg.APIToken, start)
+	var up api.Upload
+	json.Unmarshal(body, &up)
+	request(t, ts, "PUT", "/v1/files/uploads/"+up.ID+"?offset=0", cfg.APIToken, "abd")
+
+	resp, body := request(t, ts, "POST", "/v1/files/uploads/"+up.ID+"/commit", cfg.APIToken, "")
+	if resp.StatusCode != http.StatusUnprocessableEntity || errorCode(t, body) != api.CodeChecksumMismatch {
+		t.Fatalf("commit of corrupt data: %d %s", resp.StatusCode, body)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Error("corrupt upload was moved into place")
+	}
+	if entries, _ := os.ReadDir(cfg.AllowedPaths[0]); len(entries) != 0 {
+		t.Errorf("part file left behind: %v", entries)
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	ts, cfg := newTestServer(t)
+	path := filepath.Join(cfg.AllowedPaths[0], "big")
+	mb := int64(1 << 20)
+
+	type limitTest struct {
+		name string
+		size int64
+		code string
+	}
+	max := int64(cfg.Files.MaxFileMB) * mb
+	tests := []limitTest{{"over max_file_mb", max + 1, api.CodeTooLarge}}
+	for used := int64(0); used+max <= int64(cfg.Files.UploadQuotaMB)*mb; used += max {
+		tests = append(tests, limitTest{"within quota", max, ""})
+	}
+	tests = append(tests, limitTest{"over quota", 1, api.CodeQuotaExceeded})
+	for i, tt := range tests {
+		// Distinct paths so no upload resumes another.
+		start := `{"path":` + mustJSON(path+strconv.Itoa(i)) + `,"size":` + strconv.FormatInt(tt.size, 10) + `}`
+		resp, body := request(t, ts, "POST", "/v1/files/uploads", cfg.APIToken, start)
+		switch {
+		case tt.code == "" && resp.StatusCode != http.StatusOK:
+			t.Errorf("%s: %d %s", tt.name, resp.StatusCode, body)
+		case tt.code != "" && (resp.StatusCode != http.StatusRequestEntityTooLarge || !strings.Contains(string(body), tt.code)):
+			t.Errorf("%s: %d %s, want 413 %s", tt.name, resp.StatusCode, body, tt.code)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+const (
+	defaultWatchTimeout  = 30 * time.Second
+	maxWatchTimeout      = 300 * time.Second
+	defaultWatchDebounce = 200 * time.Millisecond
+	maxWatchDebounce     = time.Minute
+	// watchCursorTTL is how long a cursor waits for the next poll.
+	watchCursorTTL = 5 * time.Minute
+)
+
+// watchEntry is what a watch remembers of a file or directory.
+type watchEntry struct {
+	size    int64
+	modTime time.Time
+	isDir   bool
+}
+
+// watchSnapshot maps the slash-separated paths under a watched directory
+// to their state.
+type watchSnapshot map[string]watchEntry
+
+// watchCursor is a tree as last reported to a polling client. It is only
+// valid for the same root, excludes and owner.
+type watchCursor struct {
+	root    string
+	exclude []string
+	owner   string
+	snap    watchSnapshot
+	expires time.Time
+}
+
+func (s *Server) handleFileWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+	cfg := s.Config()
+	var req api.WatchRequest
+	err := decodeFileRequest(r, &req)
+	entry := fileEntry(r, req.Path)
+	if err == nil {
+		if err = checkFilePath(cfg, req.Path); err != nil {
+			err = policyError(err)
+		}
+	}
+	if err == nil {
+		if err = api.ValidateExcludes(req.Include); err == nil {
+			err = api.ValidateExcludes(req.Exclude)
+		}
+		if err != nil {
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "%v", err)
+		}
+	}
+	debounce := time.Duration(req.DebounceMS) * time.Millisecond
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	if err == nil {
+		switch {
+		case debounce < 0 || debounce > maxWatchDebounce:
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "debounce_ms must be between 0 and %d", maxWatchDebounce.Milliseconds())
+		case timeout < 0 || timeout > maxWatchTimeout:
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "timeout_seconds must be between 0 and %d", int(maxWatchTimeout.Seconds()))
+		}
+	}
+	root := filepath.Clean(req.Path)
+	if err == nil {
+		if fi, serr := os.Stat(root); serr != nil {
+			err = serr
+		} else if !fi.IsDir() {
+			err = fileErrorf(http.StatusBadRequest, api.CodeInvalidRequest, "'%s' is not a directory", root)
+		}
+	}
+	var release func()
+	if err == nil {
+		release, err = s.startWatch(cfg)
+	}
+	if err != nil {
+		s.fileFail(w, r, entry, "watch", err)
+		return
+	}
+	defer release()
+
+	owner := uploadOwner(r.Context())
+	var base watchSnapshot
+	reset := false
+	if req.Cursor != "" {
+		base = s.takeWatchCursor(req.Cursor, root, req.Exclude, owner)
+		reset = base == nil
+	}
+	if base == nil {
+		if base, err = scanTree(root, req.Exclude); err != nil {
+			s.fileFail(w, r, entry, "watch", err)
+			return
+		}
+	}
+
+	if debounce == 0 {
+		debounce = defaultWatchDebounce
+	}
+	stream := wantsStream(r)
+	if timeout == 0 && !stream {
+		timeout = defaultWatchTimeout
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	if timeout > 0 {
+		var tcancel context.CancelFunc
+		ctx, tcancel = context.WithTimeout(ctx, timeout)
+		defer tcancel()
+	}
+	go func() {
+		select {
+		case <-s.shutdownCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	interval := time.Duration(cfg.Files.WatchIntervalMS) * time.Millisecond
+	started := time.Now()
+	count := 0
+	entry.Status = "file_watch"
+
+	if stream {
+		w.Header().Set("Content-Type", api.StreamContentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusOK)
+		enc := json.NewEncoder(w)
+		flusher, _ := w.(http.Flusher)
+		flush := func() {
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		flush()
+		_, err = watchTree(ctx, root, req, base, interval, debounce, func(events []api.WatchEvent) bool {
+			for _, ev := range events {
+				if enc.Encode(ev) != nil {
+					return false
+				}
+			}
+			count += len(events)
+			flush()
+			return true
+		})
+		if err != nil {
+			enc.Encode(api.WatchEvent{Type: api.WatchError, Error: err.Error()})
+			entry.Status = "file_failed"
+		}
+		entry.Reason = watchReason(count, started, err)
+		s.log(r.Context(), entry)
+		return
+	}
+
+	resp := api.WatchResponse{Path: root, Reset: reset, Events: []api.WatchEvent{}}
+	base, err = watchTree(ctx, root, req, base, interval, debounce, func(events []api.WatchEvent) bool {
+		resp.Events = events
+		return false
+	})
+	if err != nil {
+		s.fileFail(w, r, entry, "watch", err)
+		return
+	}
+	count = len(resp.Events)
+	resp.Cursor = s.saveWatchCursor(cfg, &watchCursor{root: root, exclude: req.Exclude, owner: owner, snap: base})
+	entry.Reason = watchReason(count, started, nil)
+	s.fileDone(w, r, entry, entry.Status, resp)
+}
+
+func watchReason(events int, started time.Time, err error) string {
+	reason := fmt.Sprintf("%d events in %s", events, time.Since(started).Round(time.Second))
+	if err != nil {
+		reason += ": " + err.Error()
+	}
+	return reason
+}
+
+// startWatch counts a running watch against files.max_watches. The
+// returned func ends it.
+func (s *Server) startWatch(cfg api.Config) (func(), error) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	if s.watches >= cfg.Files.MaxWatches {
+		return nil, fileErrorf(http.StatusTooManyRequests, api.CodeTooManyWatches,
+			"%d watches are already running; retry later", s.watches)
+	}
+	s.watches++
+	return func() {
+		s.watchMu.Lock()
+		s.watches--
+		s.watchMu.Unlock()
+	}, nil
+}
+
+// takeWatchCursor returns and forgets the snapshot of cursor id, or nil if
+// it expired or belongs to a different watch. A cursor is used only once,
+// as every poll returns a new one.
+func (s *Server) takeWatchCursor(id, root string, exclude []string, owner string) watchSnapshot {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	c, ok := s.watchCursors[id]
+	delete(s.watchCursors, id)
+	if !ok || time.Now().After(c.expires) || c.root != root || c.owner != owner || !slices.Equal(c.exclude, exclude) {
+		return nil
+	}
+	return c.snap
+}
+
+// saveWatchCursor keeps c for the next poll and returns its id. Expired
+// cursors are dropped, and the oldest ones beyond files.max_watches.
+func (s *Server) saveWatchCursor(cfg api.Config, c *watchCursor) string {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+	now := time.Now()
+	for id, old := range s.watchCursors {
+		if now.After(old.expires) {
+			delete(s.watchCursors, id)
+		}
+	}
+	for len(s.watchCursors) >= cfg.Files.MaxWatches {
+		oldest := ""
+		for id, old := range s.watchCursors {
+			if oldest == "" || old.expires.Before(s.watchCursors[oldest].expires) {
+				oldest = id
+			}
+		}
+		delete(s.watchCursors, oldest)
+	}
+	c.expires = now.Add(watchCursorTTL)
+	id := newUploadID()
+	s.watchCursors[id] = c
+	return id
+}
+
+// scanTree takes a snapshot of the tree under root, skipping what walkTree
+// skips. A root that has gone away is an empty tree, so deleting and
+// recreating the watched directory is reported rather than ending the
+// watch.
+func scanTree(root string, exclude []string) (watchSnapshot, error) {
+	snap := watchSnapshot{}
+	err := walkTree(root, exclude, func(rel string, fi fs.FileInfo) error {
+		if len(snap) >= maxManifestEntries {
+			return fileErrorf(http.StatusRequestEntityTooLarge, api.CodeTooLarge,
+				"'%s' has more than %d entries; exclude some", root, maxManifestEntries)
+		}
+		snap[rel] = watchEntry{size: fi.Size(), modTime: fi.ModTime(), isDir: fi.IsDir()}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return watchSnapshot{}, nil
+	}
+	return snap, err
+}
+
+// diffSnapshots lists the changes from prev to next, sorted by path, that
+// match include (everything if it is empty). Directories are reported when
+// they appear or go away, not when their contents change.
+func diffSnapshots(prev, next watchSnapshot, include []string) []api.WatchEvent {
+	var events []api.WatchEvent
+	add := func(typ, rel string, e watchEntry) {
+		if len(include) > 0 && !api.Excluded(rel, include) {
+			return
+		}
+		ev := api.WatchEvent{Type: typ, Path: rel, IsDir: e.isDir}
+		if typ != api.WatchDelete {
+			ev.ModTime = e.modTime.UTC().Format(time.RFC3339Nano)
+			if !e.isDir {
+				ev.Size = e.size
+			}
+		}
+		events = append(events, ev)
+	}
+	for rel, old := range prev {
+		cur, ok := next[rel]
+		switch {
+		case !ok:
+			add(api.WatchDelete, rel, old)
+		case cur.isDir != old.isDir:
+			add(api.WatchDelete, rel, old)
+			add(api.WatchCreate, rel, cur)
+		case !cur.isDir && (cur.size != old.size || !cur.modTime.Equal(old.modTime)):
+			add(api.WatchModify, rel, cur)
+		}
+	}
+	for rel, cur := range next {
+		if _, ok := prev[rel]; !ok {
+			add(api.WatchCreate, rel, cur)
+		}
+	}
+	// A path deleted and recreated as another kind keeps delete first.
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events
+}
+
+// watchTree scans root every interval and calls emit with the changes
+// since base once the tree has been quiet for debounce, or has kept
+// changing for ten times that. It returns the snapshot last reported,
+// when emit returns false, ctx is done or a scan fails.
+func watchTree(ctx context.Context, root string, req api.WatchRequest, base watchSnapshot, interval, debounce time.Duration, emit func([]api.WatchEvent) bool) (watchSnapshot, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	prev := base
+	var first, last time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return base, nil
+		case <-ticker.C:
+		}
+		cur, err := scanTree(root, req.Exclude)
+		if err != nil {
+			return base, err
+		}
+		now := time.Now()
+		if len(diffSnapshots(prev, cur, nil)) > 0 {
+			if first.IsZero() {
+				first = now
+			}
+			last = now
+		}
+		prev = cur
+		if first.IsZero() || (now.Sub(last) < debounce && now.Sub(first) < 10*debounce) {
+			continue
+		}
+		events := diffSnapshots(base, cur, req.Include)
+		base, first = cur, time.Time{}
+		if len(events) > 0 && !emit(events) {
+			return base, nil
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/mscrnt/DevProxy/pkg/api/v1"
+)
+
+func fastWatches(cfg *api.Config) {
+	cfg.Files.WatchIntervalMS = 100
+	cfg.Files.MaxWatches = 2
+}
+
+func eventList(events []api.WatchEvent) string {
+	var s []string
+	for _, ev := range events {
+		s = append(s, ev.Type+" "+ev.Path)
+	}
+	return strings.Join(s, ", ")
+}
+
+func TestWatchPoll(t *testing.T) {
+	ts, cfg := newTestServer(t, fastWatches)
+	dir := cfg.AllowedPaths[0]
+	writeFiles(t, dir, map[string]string{"keep.txt": "a", "gone.txt": "b"})
+
+	poll := func(cursor string) api.WatchResponse {
+		t.Helper()
+		body := `{"path":` + mustJSON(dir) + `,"include":["*.txt"],"exclude":["build"],"debounce_ms":50,"timeout_seconds":2,"cursor":"` + cursor + `"}`
+		resp, data := request(t, ts, "POST", "/v1/files/watch", cfg.APIToken, body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("watch: %d %s", resp.StatusCode, data)
+		}
+		var wr api.WatchResponse
+		json.Unmarshal(data, &wr)
+		return wr
+	}
+
+	// Changes while the request waits are returned as one batch; the
+	// excluded and unmatched files are not.
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		os.Mkdir(filepath.Join(dir, "build"), 0755)
+		for _, name := range []string{"new.txt", "notes.log", "build/out.txt"} {
+			os.WriteFile(filepath.Join(dir, name), []byte("c"), 0644)
+		}
+	}()
+	wr := poll("")
+	if got, want := eventList(wr.Events), "create new.txt"; got != want || wr.Cursor == "" || wr.Reset {
+		t.Fatalf("first poll: %q, want %q (%+v)", got, want, wr)
+	}
+	if ev := wr.Events[0]; ev.Size != 1 || ev.ModTime == "" {
+		t.Errorf("event %+v has no size or mod time", ev)
+	}
+
+	// Changes between polls are reported by the next one.
+	writeFiles(t, dir, map[string]string{"keep.txt": "changed"})
+	os.Remove(filepath.Join(dir, "gone.txt"))
+	wr = poll(wr.Cursor)
+	if got, want := eventList(wr.Events), "delete gone.txt, modify keep.txt"; got != want || wr.Reset {
+		t.Errorf("second poll: %q, want %q", got, want)
+	}
+
+	// A used or unknown cursor starts over.
+	start := time.Now()
+	wr = poll("0123")
+	if len(wr.Events) != 0 || !wr.Reset || time.Since(start) < 2*time.Second {
+		t.Errorf("poll with an unknown cursor: %+v after %v", wr, time.Since(start))
+	}
+}
+
+func TestWatchStream(t *testing.T) {
+	ts, cfg := newTestServer(t, fastWatches)
+	dir := cfg.AllowedPaths[0]
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "POST", ts.URL+"/v1/files/watch",
+		strings.NewReader(`{"path":`+mustJSON(dir)+`,"debounce_ms":50}`))
+	req.Header.Set("X-Admin-Token", cfg.APIToken)
+	req.Header.Set("Accept", api.StreamContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != api.StreamContentType {
+		t.Fatalf("stream: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	// Both watch slots are taken while the stream and a poll run.
+	poll, _ := http.NewRequest("POST", ts.URL+"/v1/files/watch", strings.NewReader(`{"path":`+mustJSON(dir)+`,"timeout_seconds":1}`))
+	poll.Header.Set("X-Admin-Token", cfg.APIToken)
+	go func() {
+		if resp, err := http.DefaultClient.Do(poll); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+	r, data := request(t, ts, "POST", "/v1/files/watch", cfg.APIToken, `{"path":`+mustJSON(dir)+`}`)
+	if r.StatusCode != http.StatusTooManyRequests || errorCode(t, data) != api.CodeTooManyWatches {
+		t.Errorf("third watch: %d %s, want 429", r.StatusCode, data)
+	}
+
+	sc := bufio.NewScanner(resp.Body)
+	var events []api.WatchEvent
+	for _, step := range []func(){
+		func() { os.Mkdir(filepath.Join(dir, "sub"), 0755) },
+		func() { os.Remove(filepath.Join(dir, "sub")) },
+	} {
+		step()
+		if !sc.Scan() {
+			t.Fatalf("stream ended: %v", sc.Err())
+		}
+		var ev api.WatchEvent
+		json.Unmarshal(sc.Bytes(), &ev)
+		events = append(events, ev)
+	}
+	if got, want := eventList(events), "create sub, delete sub"; got != want || !events[0].IsDir {
+		t.Errorf("streamed %q, want %q", got, want)
+	}
+}
+
+func TestWatchRejects(t *testing.T) {
+	ts, cfg := newTestServer(t, fastWatches)
+	dir := cfg.AllowedPaths[0]
+	writeFiles(t, dir, map[string]string{"f": ""})
+
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"path":` + mustJSON(t.TempDir()) + `}`, http.StatusForbidden},
+		{`{"path":` + mustJSON(filepath.Join(dir, "f")) + `}`, http.StatusBadRequest},
+		{`{"path":` + mustJSON(dir) + `,"include":["["]}`, http.StatusBadRequest},
+		{`{"path":` + mustJSON(dir) + `,"timeout_seconds":301}`, http.StatusBadRequest},
+		{`{"path":` + mustJSON(dir) + `,"debounce_ms":-1}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		resp, data := request(t, ts, "POST", "/v1/files/watch", cfg.APIToken, tt.body)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %d %s, want %d", tt.body, resp.StatusCode, data, tt.status)
+		}
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	t0 := time.Now()
+	prev := watchSnapshot{
+		"a":     {size: 1, modTime: t0},
+		"b":     {isDir: true, modTime: t0},
+		"b/c":   {size: 1, modTime: t0},
+		"d":     {size: 1, modTime: t0},
+		"e":     {isDir: true, modTime: t0},
+		"f.txt": {size: 1, modTime: t0},
+	}
+	next := watchSnapshot{
+		"a":     {size: 1, modTime: t0.Add(time.Second)},
+		"b":     {isDir: true, modTime: t0.Add(time.Second)},
+		"d":     {isDir: true, modTime: t0},
+		"e":     {isDir: true, modTime: t0},
+		"f.txt": {size: 2, modTime: t0},
+		"g":     {size: 1, modTime: t0},
+	}
+	got := eventList(diffSnapshots(prev, next, nil))
+	if want := "modify a, delete b/c, delete d, create d, modify f.txt, create g"; got != want {
+		t.Errorf("diff: %q, want %q", got, want)
+	}
+	got = eventList(diffSnapshots(prev, next, []string{"*.txt", "b"}))
+	if want := "delete b/c, modify f.txt"; got != want {
+		t.Errorf("diff with include: %q, want %q", got, want)
+	}
+}
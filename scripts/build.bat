@@ -8,7 +8,7 @@ set GOARCH=amd64
 
 REM Build the main DevProxy executable
 echo Building devproxy.exe...
-go build -o devproxy.exe cmd/devproxy/main.go
+go build -o devproxy.exe ./cmd/devproxy
 if %errorlevel% neq 0 (
     echo Failed to build devproxy.exe
     pause
@@ -17,7 +17,7 @@ if %errorlevel% neq 0 (
 
 REM Build the devctl client tool
 echo Building devctl.exe...
-go build -o devctl.exe cmd/devctl/main.go
+go build -o devctl.exe ./cmd/devctl
 if %errorlevel% neq 0 (
     echo Failed to build devctl.exe
     pause
@@ -26,7 +26,7 @@ if %errorlevel% neq 0 (
 
 REM Build the tray application
 echo Building devproxy-tray.exe...
-go build -ldflags="-H windowsgui" -o devproxy-tray.exe cmd/devproxy-tray/main.go cmd/devproxy-tray/icon.go
+go build -ldflags="-H windowsgui" -o devproxy-tray.exe ./cmd/devproxy-tray
 if %errorlevel% neq 0 (
     echo Warning: Failed to build devproxy-tray.exe (GUI dependencies may be missing)
     echo You can still use DevProxy without the tray application
@@ -26,7 +26,7 @@ popd
 REM Check if devproxy.exe exists
 if not exist "%DEVPROXY_PATH%" (
     echo ERROR: devproxy.exe not found at %DEVPROXY_PATH%
-    echo Please build the project first using: go build -o devproxy.exe cmd/devproxy/main.go
+    echo Please build the project first using: go build -o devproxy.exe ./cmd/devproxy
     pause
     exit /b 1
 )